@@ -0,0 +1,279 @@
+package argos
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alonsovidales/pit/log"
+)
+
+const (
+	typeCounter   = "counter"
+	typeGauge     = "gauge"
+	typeHistogram = "histogram"
+)
+
+// LatencyBuckets are the default buckets of the histograms, in seconds
+var LatencyBuckets = []float64{0.0005, 0.001, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Registry contains all the metrics exposed on the Prometheus text format
+type Registry struct {
+	mutex   sync.Mutex
+	metrics []*metric
+}
+
+// Default is the registry used by all the packages
+var Default = &Registry{}
+
+// series is the value of a metric for a set of label values
+type series struct {
+	labels  []string
+	value   float64
+	buckets []uint64
+	count   uint64
+}
+
+type metric struct {
+	mutex   sync.Mutex
+	name    string
+	help    string
+	kind    string
+	labels  []string
+	buckets []float64
+	series  map[string]*series
+}
+
+// Counter is a metric that only increases
+type Counter struct {
+	m *metric
+}
+
+// Gauge is a metric that can be set to any value
+type Gauge struct {
+	m *metric
+}
+
+// Histogram counts the observed values on buckets
+type Histogram struct {
+	m *metric
+}
+
+func (reg *Registry) register(name, help, kind string, buckets []float64, labels []string) *metric {
+	reg.mutex.Lock()
+	defer reg.mutex.Unlock()
+
+	for _, m := range reg.metrics {
+		if m.name == name {
+			return m
+		}
+	}
+	m := &metric{
+		name:    name,
+		help:    help,
+		kind:    kind,
+		labels:  labels,
+		buckets: buckets,
+		series:  make(map[string]*series),
+	}
+	reg.metrics = append(reg.metrics, m)
+
+	return m
+}
+
+// GetCounter returns the counter with the given name on the default
+// registry, it is created if it doesn't exist
+func GetCounter(name, help string, labels ...string) *Counter {
+	return &Counter{Default.register(name, help, typeCounter, nil, labels)}
+}
+
+// GetGauge returns the gauge with the given name on the default registry,
+// it is created if it doesn't exist
+func GetGauge(name, help string, labels ...string) *Gauge {
+	return &Gauge{Default.register(name, help, typeGauge, nil, labels)}
+}
+
+// GetHistogram returns the histogram with the given name on the default
+// registry, it is created if it doesn't exist
+func GetHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	return &Histogram{Default.register(name, help, typeHistogram, buckets, labels)}
+}
+
+// get returns the series of the label values, the mutex has to be locked
+func (m *metric) get(values []string) *series {
+	key := strings.Join(values, "\xff")
+	s, ok := m.series[key]
+	if !ok {
+		s = &series{
+			labels:  append([]string{}, values...),
+			buckets: make([]uint64, len(m.buckets)),
+		}
+		m.series[key] = s
+	}
+
+	return s
+}
+
+// Add increases the counter, negative values are ignored
+func (c *Counter) Add(v float64, labels ...string) {
+	if v < 0 {
+		return
+	}
+
+	c.m.mutex.Lock()
+	c.m.get(labels).value += v
+	c.m.mutex.Unlock()
+}
+
+// Inc increases the counter by one
+func (c *Counter) Inc(labels ...string) {
+	c.Add(1, labels...)
+}
+
+// Set sets the value of the gauge
+func (g *Gauge) Set(v float64, labels ...string) {
+	g.m.mutex.Lock()
+	g.m.get(labels).value = v
+	g.m.mutex.Unlock()
+}
+
+// Add adds the value, that can be negative, to the gauge
+func (g *Gauge) Add(v float64, labels ...string) {
+	g.m.mutex.Lock()
+	g.m.get(labels).value += v
+	g.m.mutex.Unlock()
+}
+
+// Delete removes the series whose first label values are the given ones
+func (g *Gauge) Delete(labels ...string) {
+	g.m.delete(labels)
+}
+
+// delete removes the series that start with the label values
+func (m *metric) delete(values []string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	for key, s := range m.series {
+		if len(s.labels) >= len(values) && strings.Join(s.labels[:len(values)], "\xff") == strings.Join(values, "\xff") {
+			delete(m.series, key)
+		}
+	}
+}
+
+// Observe adds the value to the histogram
+func (h *Histogram) Observe(v float64, labels ...string) {
+	h.m.mutex.Lock()
+	defer h.m.mutex.Unlock()
+
+	s := h.m.get(labels)
+	s.value += v
+	s.count++
+	for i, bound := range h.m.buckets {
+		if v <= bound {
+			s.buckets[i]++
+		}
+	}
+}
+
+// Since observes the seconds elapsed since the given time
+func (h *Histogram) Since(start time.Time, labels ...string) {
+	h.Observe(time.Since(start).Seconds(), labels...)
+}
+
+func formatValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+
+	return fmt.Sprintf("%g", v)
+}
+
+// formatLabels returns the labels of a series with the extra label, if any,
+// on the Prometheus format
+func (m *metric) formatLabels(s *series, extra ...string) string {
+	pairs := []string{}
+	for i, name := range m.labels {
+		value := ""
+		if i < len(s.labels) {
+			value = s.labels[i]
+		}
+		pairs = append(pairs, fmt.Sprintf("%s=%q", name, value))
+	}
+	if len(extra) == 2 {
+		pairs = append(pairs, fmt.Sprintf("%s=%q", extra[0], extra[1]))
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func (m *metric) write(w io.Writer) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", m.name, m.help, m.name, m.kind)
+
+	keys := make([]string, 0, len(m.series))
+	for key := range m.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		s := m.series[key]
+		if m.kind != typeHistogram {
+			fmt.Fprintf(w, "%s%s %s\n", m.name, m.formatLabels(s), formatValue(s.value))
+			continue
+		}
+
+		for i, bound := range m.buckets {
+			fmt.Fprintf(w, "%s_bucket%s %d\n", m.name, m.formatLabels(s, "le", formatValue(bound)), s.buckets[i])
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", m.name, m.formatLabels(s, "le", "+Inf"), s.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", m.name, m.formatLabels(s), formatValue(s.value))
+		fmt.Fprintf(w, "%s_count%s %d\n", m.name, m.formatLabels(s), s.count)
+	}
+}
+
+// Write writes all the metrics on the Prometheus text format
+func (reg *Registry) Write(w io.Writer) {
+	reg.mutex.Lock()
+	metrics := append([]*metric{}, reg.metrics...)
+	reg.mutex.Unlock()
+
+	sort.Slice(metrics, func(i, j int) bool { return metrics[i].name < metrics[j].name })
+	for _, m := range metrics {
+		m.write(w)
+	}
+}
+
+// ServeHTTP exposes the metrics of the registry
+func (reg *Registry) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	reg.Write(w)
+}
+
+// Serve exposes the metrics of the default registry on the /metrics path of
+// the given port
+func Serve(port int) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", Default)
+
+	go func() {
+		log.Info("Starting metrics endpoint on port:", port)
+		if err := http.ListenAndServe(fmt.Sprintf(":%d", port), mux); err != nil {
+			log.Fatal("The metrics endpoint can't be started:", err)
+		}
+	}()
+}
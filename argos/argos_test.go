@@ -0,0 +1,72 @@
+package argos
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMetricsFormat(t *testing.T) {
+	reg := &Registry{}
+	counter := &Counter{reg.register("test_ticks_total", "Ticks", typeCounter, nil, []string{"curr"})}
+	gauge := &Gauge{reg.register("test_open", "Open positions", typeGauge, nil, nil)}
+	hist := &Histogram{reg.register("test_latency_seconds", "Latency", typeHistogram, []float64{0.1, 1}, []string{"op"})}
+
+	counter.Inc("EUR")
+	counter.Add(2, "EUR")
+	counter.Add(-1, "EUR")
+	counter.Inc("GBP")
+	gauge.Set(5)
+	gauge.Add(-2)
+	hist.Observe(0.05, "order")
+	hist.Observe(0.5, "order")
+	hist.Observe(3, "order")
+
+	if again := reg.register("test_open", "Open positions", typeGauge, nil, nil); again != gauge.m {
+		t.Error("A metric registered twice has to be the same:", again, gauge.m)
+	}
+
+	buf := new(bytes.Buffer)
+	reg.Write(buf)
+	out := buf.String()
+	expected := []string{
+		"# TYPE test_ticks_total counter",
+		`test_ticks_total{curr="EUR"} 3`,
+		`test_ticks_total{curr="GBP"} 1`,
+		"# HELP test_open Open positions",
+		"test_open 3",
+		`test_latency_seconds_bucket{op="order",le="0.1"} 1`,
+		`test_latency_seconds_bucket{op="order",le="1"} 2`,
+		`test_latency_seconds_bucket{op="order",le="+Inf"} 3`,
+		`test_latency_seconds_sum{op="order"} 3.55`,
+		`test_latency_seconds_count{op="order"} 3`,
+	}
+	for _, line := range expected {
+		if !strings.Contains(out, line+"\n") {
+			t.Error("Line not found:", line, "Output:", out)
+		}
+	}
+	if strings.Index(out, "test_latency_seconds") > strings.Index(out, "test_open") {
+		t.Error("The metrics have to be sorted by name:", out)
+	}
+
+	start := time.Now().Add(-time.Second)
+	hist.Since(start, "close")
+	if s := hist.m.series["close"]; s == nil || s.value < 1 || s.buckets[0] != 0 {
+		t.Error("The elapsed seconds weren't observed:", s)
+	}
+}
+
+func TestGaugeDelete(t *testing.T) {
+	reg := &Registry{}
+	gauge := &Gauge{reg.register("test_pl", "P&L", typeGauge, nil, []string{"trader", "real"})}
+	gauge.Set(1, "1", "true")
+	gauge.Set(2, "1", "false")
+	gauge.Set(3, "12", "true")
+
+	gauge.Delete("1")
+	if len(gauge.m.series) != 1 || gauge.m.series["12\xfftrue"] == nil {
+		t.Error("Only the series of the trader should be removed:", gauge.m.series)
+	}
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alonsovidales/pit/cfg"
+	"github.com/alonsovidales/pit/log"
+	"github.com/alonsovidales/v/charont"
+	"github.com/alonsovidales/v/hades"
+	"github.com/alonsovidales/v/hermes"
+	"github.com/alonsovidales/v/philoctetes"
+)
+
+const (
+	// bookTraderIDs is the range of trader IDs reserved for each book
+	bookTraderIDs = 1000000
+)
+
+// bookConf reads the config of a book, the values defined on the
+// "book-<name>-<section>" sections replace the ones of the global sections.
+// When no books are defined the process runs a single book without name
+// that uses the global sections
+type bookConf struct {
+	name string
+}
+
+// getBooks returns the books defined on the "names" key of the "books"
+// section
+func getBooks() (books []*bookConf) {
+	names := cfg.GetStr("books", "names")
+	if names == "" {
+		return []*bookConf{{}}
+	}
+
+	seen := make(map[string]bool)
+	for _, name := range strings.Split(names, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" || seen[name] {
+			log.Fatal("The book names have to be unique and not empty:", names)
+		}
+		seen[name] = true
+		books = append(books, &bookConf{name: name})
+	}
+
+	return
+}
+
+// checkBooks verifies that the books don't share the resources that can't be
+// shared, the admin API ports and the snapshots dirs
+func checkBooks(books []*bookConf) {
+	ports := make(map[int64]string)
+	dirs := make(map[string]string)
+	for _, book := range books {
+		if port := book.GetInt("admin", "http-port"); port != 0 {
+			if other, ok := ports[port]; ok {
+				log.Fatal("The books:", other, "and:", book.name, "use the same admin port:", port)
+			}
+			ports[port] = book.name
+		}
+		if dir := book.GetStr("persistence", "snapshots-dir"); dir != "" {
+			if other, ok := dirs[dir]; ok {
+				log.Fatal("The books:", other, "and:", book.name, "use the same snapshots dir:", dir)
+			}
+			dirs[dir] = book.name
+		}
+	}
+}
+
+// section returns the section that defines the key for the book
+func (bc *bookConf) section(section, key string) string {
+	if bc.name != "" {
+		if bookSection := "book-" + bc.name + "-" + section; cfg.GetStr(bookSection, key) != "" {
+			return bookSection
+		}
+	}
+
+	return section
+}
+
+func (bc *bookConf) GetStr(section, key string) string {
+	return cfg.GetStr(bc.section(section, key), key)
+}
+
+func (bc *bookConf) GetInt(section, key string) int64 {
+	return cfg.GetInt(bc.section(section, key), key)
+}
+
+func (bc *bookConf) getFloat(section, key string) float64 {
+	val, _ := strconv.ParseFloat(bc.GetStr(section, key), 64)
+
+	return val
+}
+
+func (bc *bookConf) currencies() []string {
+	return strings.Split(bc.GetStr("oanda", "currencies"), ",")
+}
+
+// allCurrencies returns the currencies of all the books without duplicates
+func allCurrencies(books []*bookConf) (currencies []string) {
+	seen := make(map[string]bool)
+	for _, book := range books {
+		for _, curr := range book.currencies() {
+			if !seen[curr] {
+				seen[curr] = true
+				currencies = append(currencies, curr)
+			}
+		}
+	}
+
+	return
+}
+
+// getOandaCollectors connects with the account of each book, the books on
+// the same endpoint and account currency share the feed of the first one.
+// Each feed is recorded on its own dir if recordDir is defined, the first feed
+// on recordDir and the others on recordDir followed by the name of the book
+// that collects it
+func getOandaCollectors(books []*bookConf, recordDir string) (collectors []charont.Int, recorders []*charont.Recorder, err error) {
+	feeds := make(map[string]*charont.Oanda)
+	for _, book := range books {
+		api, err := charont.InitOandaApi(
+			book.GetStr("oanda", "endpoint"),
+			book.GetStr("oanda", "token"),
+			int(book.GetInt("oanda", "account-id")),
+			book.currencies(),
+			nil,
+		)
+		if err != nil {
+			return nil, recorders, err
+		}
+
+		key := book.GetStr("oanda", "endpoint") + "/" + api.GetBaseCurrency()
+		if feed, ok := feeds[key]; ok {
+			if err = feed.ShareFeed(api); err != nil {
+				return nil, recorders, err
+			}
+			log.Info("The book:", book.name, "shares the prices feed of the endpoint:", key)
+		} else {
+			feeds[key] = api
+			if recordDir != "" {
+				dir := recordDir
+				if len(recorders) > 0 {
+					dir = recordDir + "-" + book.name
+				}
+				recorder, err := charont.GetRecorder(
+					dir,
+					int(cfg.GetInt("oanda", "exanges-log-max-size-mb")),
+					cfg.GetInt("oanda", "exanges-log-rotate-daily") != 0,
+				)
+				if err != nil {
+					return nil, recorders, err
+				}
+				api.SetRecorder(recorder)
+				recorders = append(recorders, recorder)
+				log.Info("The prices feed of the endpoint:", key, "is recorded on:", dir)
+			}
+		}
+		collectors = append(collectors, api)
+	}
+
+	return
+}
+
+// launchBook launches the traders of the book, the collector provides only
+// the currencies of the book
+func (bc *bookConf) launchBook(index int, collector charont.Int, tracer *hermes.Tracer) (manager *hades.Hades, groups []*hades.TradersGroup, err error) {
+	trainer := philoctetes.GetTrainerCorrelationsCrossCurr(
+		bc.GetStr("trainer", "training-set"),
+		bc.GetInt("trainer", "time-range-to-study"),
+	)
+
+	var book *hades.BookConf
+	if bc.name != "" {
+		book = &hades.BookConf{
+			Name:          bc.name,
+			FirstTraderID: index * bookTraderIDs,
+		}
+	}
+
+	groups = bc.getTradersGroups()
+	manager, err = hades.GetHades(
+		trainer,
+		groups,
+		collector,
+		int(bc.GetInt("traders-window", "units-to-use")),
+		int(bc.GetInt("traders-window", "last-ops-to-considerer")),
+		int(bc.GetInt("traders-window", "max-traders-that-can-play")),
+		&hades.Conf{
+			SnapshotsDir: bc.GetStr("persistence", "snapshots-dir"),
+			SnapshotSecs: int(bc.GetInt("persistence", "snapshot-every-secs")),
+			Tracer:       tracer,
+			Portfolio:    bc.getPortfolioLimits(),
+			Selection:    bc.getSelectionConf(),
+			Breaker:      bc.getBreakerConf(),
+			Evolution:    bc.getEvolutionConf(),
+			Allocation:   bc.getAllocationConf(),
+			Book:         book,
+		})
+	if err != nil {
+		return
+	}
+
+	if adminPort := int(bc.GetInt("admin", "http-port")); adminPort != 0 {
+		err = manager.StartAdmin(
+			adminPort,
+			bc.GetStr("admin", "token"),
+			bc.GetStr("admin", "audit-file"),
+		)
+	}
+
+	return
+}
+
+// reportBooks logs and exports periodically the status of the books
+func reportBooks(managers []*hades.Hades, every time.Duration) {
+	for _ = range time.Tick(every) {
+		for _, manager := range managers {
+			status := manager.GetStatus()
+			log.Info("Book:", status.Name, "Traders:", status.Traders, "Playing:", status.Playing, "Open positions:", status.OpenPositions, "Live ops:", status.LiveOps, "Live P&L:", status.LivePl, "Simulated ops:", status.SimulatedOps, "Simulated P&L:", status.SimulatedPl)
+		}
+	}
+}
+
+// stopBooks closes the positions of all the books at the same time
+func stopBooks(managers []*hades.Hades, conf *hades.ShutdownConf) {
+	var wg sync.WaitGroup
+	for _, manager := range managers {
+		wg.Add(1)
+		go func(manager *hades.Hades) {
+			defer wg.Done()
+			manager.CloseAllOpenOrdersAndFinish(conf)
+		}(manager)
+	}
+	wg.Wait()
+}
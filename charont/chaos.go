@@ -0,0 +1,161 @@
+package charont
+
+import (
+	"errors"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/alonsovidales/pit/log"
+)
+
+var (
+	ErrChaosOrderRejected = errors.New("chaos: order rejected by the broker")
+	ErrChaosCloseFailed   = errors.New("chaos: the broker failed closing the order")
+)
+
+// Chaos defines the faults to be injected into the Mock broker, all the
+// probabilities are in the [0, 1] range and are evaluated on each event. Using
+// the same Seed with the same feeds file reproduces exactly the same
+// sequence of faults
+type Chaos struct {
+	Seed int64
+
+	// Orders
+	RejectOrderProb   float64
+	DelayFillProb     float64
+	MaxFillDelayTicks int
+	CloseFailProb     float64
+
+	// Feeds
+	DropTickProb      float64
+	DupTickProb       float64
+	OutOfOrderProb    float64
+	MaxOutOfOrderSecs int
+	OutageProb        float64
+	MaxOutageTicks    int
+}
+
+// pendingFill is an order accepted by the broker that will be priced with
+// the values received after a number of ticks
+type pendingFill struct {
+	ord   *Order
+	ticks int
+}
+
+type chaosInjector struct {
+	conf         *Chaos
+	rnd          *rand.Rand
+	mutex        sync.Mutex
+	outageTicks  int
+	pendingFills map[string][]*pendingFill
+}
+
+func newChaosInjector(conf *Chaos) (ci *chaosInjector) {
+	if conf.Seed == 0 {
+		conf.Seed = time.Now().UnixNano()
+	}
+	log.Info("Chaos injection enabled on the Mock broker, seed:", conf.Seed)
+
+	return &chaosInjector{
+		conf:         conf,
+		rnd:          rand.New(rand.NewSource(conf.Seed)),
+		pendingFills: make(map[string][]*pendingFill),
+	}
+}
+
+func (ci *chaosInjector) happens(prob float64) bool {
+	if prob <= 0 {
+		return false
+	}
+
+	return ci.rnd.Float64() < prob
+}
+
+// feedTicks returns the ticks to be delivered to the listeners in place of the
+// given one, an empty slice means that the tick was lost
+func (ci *chaosInjector) feedTicks(feed *CurrVal, lastTs int64) []*CurrVal {
+	ci.mutex.Lock()
+	defer ci.mutex.Unlock()
+
+	if ci.outageTicks > 0 {
+		ci.outageTicks--
+		return nil
+	}
+	if ci.conf.MaxOutageTicks > 0 && ci.happens(ci.conf.OutageProb) {
+		ci.outageTicks = ci.rnd.Intn(ci.conf.MaxOutageTicks) + 1
+		log.Debug("Chaos: Feed outage started, ticks to lose:", ci.outageTicks)
+		return nil
+	}
+
+	if ci.happens(ci.conf.DropTickProb) {
+		return nil
+	}
+
+	if ci.conf.MaxOutOfOrderSecs > 0 && lastTs != 0 && ci.happens(ci.conf.OutOfOrderProb) {
+		feed.Ts = lastTs - int64(ci.rnd.Intn(ci.conf.MaxOutOfOrderSecs)+1)*tsMultToSecs
+	}
+
+	if ci.happens(ci.conf.DupTickProb) {
+		dup := *feed
+		return []*CurrVal{feed, &dup}
+	}
+
+	return []*CurrVal{feed}
+}
+
+func (ci *chaosInjector) rejectOrder() bool {
+	ci.mutex.Lock()
+	defer ci.mutex.Unlock()
+
+	return ci.happens(ci.conf.RejectOrderProb)
+}
+
+func (ci *chaosInjector) failClose() bool {
+	ci.mutex.Lock()
+	defer ci.mutex.Unlock()
+
+	return ci.happens(ci.conf.CloseFailProb)
+}
+
+// delayFill decides if the fill of the order has to be delayed, in that case
+// the order will be priced using the rates of the tick that fills it
+func (ci *chaosInjector) delayFill(ord *Order) bool {
+	ci.mutex.Lock()
+	defer ci.mutex.Unlock()
+
+	if ci.conf.MaxFillDelayTicks <= 0 || !ci.happens(ci.conf.DelayFillProb) {
+		return false
+	}
+
+	ci.pendingFills[ord.Curr] = append(ci.pendingFills[ord.Curr], &pendingFill{
+		ord:   ord,
+		ticks: ci.rnd.Intn(ci.conf.MaxFillDelayTicks) + 1,
+	})
+
+	return true
+}
+
+// fillPending prices all the delayed orders of the currency that have to be
+// filled with the given tick
+func (ci *chaosInjector) fillPending(curr string, val *CurrVal) {
+	ci.mutex.Lock()
+	defer ci.mutex.Unlock()
+
+	stillPending := []*pendingFill{}
+	for _, pending := range ci.pendingFills[curr] {
+		pending.ticks--
+		if pending.ticks > 0 {
+			stillPending = append(stillPending, pending)
+			continue
+		}
+
+		if pending.ord.Type == "buy" {
+			pending.ord.Price = val.Ask
+		} else {
+			pending.ord.CloseRate = val.Bid
+		}
+		log.Debug("Chaos: Delayed fill for order:", pending.ord.Id, "Curr:", curr, "Type:", pending.ord.Type, "Ts:", val.Ts)
+	}
+	ci.pendingFills[curr] = stillPending
+}
@@ -0,0 +1,74 @@
+package charont
+
+import (
+	"testing"
+)
+
+func runChaosScenario(seed int64) (delivered []int64, rejected []bool) {
+	ci := newChaosInjector(&Chaos{
+		Seed:              seed,
+		RejectOrderProb:   0.3,
+		DropTickProb:      0.1,
+		DupTickProb:       0.1,
+		OutOfOrderProb:    0.1,
+		MaxOutOfOrderSecs: 5,
+		OutageProb:        0.05,
+		MaxOutageTicks:    10,
+	})
+
+	lastTs := int64(0)
+	for i := 0; i < 1000; i++ {
+		ts := int64(i) * tsMultToSecs
+		for _, tick := range ci.feedTicks(&CurrVal{Ts: ts, Bid: 1, Ask: 1}, lastTs) {
+			delivered = append(delivered, tick.Ts)
+		}
+		lastTs = ts
+		rejected = append(rejected, ci.rejectOrder())
+	}
+
+	return
+}
+
+func TestChaosReplay(t *testing.T) {
+	delivered, rejected := runChaosScenario(42)
+	replayDelivered, replayRejected := runChaosScenario(42)
+
+	if len(delivered) != len(replayDelivered) {
+		t.Fatal("The replayed scenario delivered:", len(replayDelivered), "ticks, but:", len(delivered), "were expected")
+	}
+	for i, ts := range delivered {
+		if replayDelivered[i] != ts {
+			t.Error("The tick:", i, "was delivered with ts:", replayDelivered[i], "on the replay, but:", ts, "was expected")
+		}
+	}
+	for i, rej := range rejected {
+		if replayRejected[i] != rej {
+			t.Error("The order:", i, "rejection differs on the replay")
+		}
+	}
+
+	if len(delivered) == 1000 {
+		t.Error("No faults were injected into the feeds")
+	}
+}
+
+func TestChaosDelayedFill(t *testing.T) {
+	ci := newChaosInjector(&Chaos{
+		Seed:              1,
+		DelayFillProb:     1,
+		MaxFillDelayTicks: 1,
+	})
+
+	ord := &Order{Curr: "USD", Type: "buy", Price: 1.1}
+	if !ci.delayFill(ord) {
+		t.Fatal("The fill of the order was not delayed")
+	}
+
+	ci.fillPending("USD", &CurrVal{Bid: 1.2, Ask: 1.3})
+	if ord.Price != 1.3 {
+		t.Error("The delayed order was filled at:", ord.Price, "but 1.3 was expected")
+	}
+	if len(ci.pendingFills["USD"]) != 0 {
+		t.Error("The order is still pending to be filled")
+	}
+}
@@ -22,6 +22,21 @@ type Order struct {
 	CloseRate float64
 	BuyTs     int64
 	SellTs    int64
+	// CloseReason is the rule that closed the order, set by the trader
+	CloseReason string
+	// OpenRef and CloseRef are the prices of the last tick when the order
+	// was placed and closed, Spread is the spread when the order was placed
+	OpenRef  float64
+	CloseRef float64
+	Spread   float64
+	// Pl, SpreadCost and SlippageCost are in the account currency, Profit
+	// is always the ratio over the open price
+	Pl           float64
+	SpreadCost   float64
+	SlippageCost float64
+	// Legs are the orders of a trade composed by several orders, the order
+	// contains the aggregated results of all of them
+	Legs []*Order `json:",omitempty"`
 }
 
 type CurrVal struct {
@@ -43,6 +58,19 @@ type Int interface {
 	CloseAllOpenOrders()
 }
 
+// AccountInt is implemented by the collectors that can provide the state of
+// the account
+type AccountInt interface {
+	GetEquity() (equity float64, err error)
+}
+
+// BrokerOrdersInt is implemented by the collectors that can report the real
+// orders open on the broker, the orders placed by the collector are returned
+// as they were placed
+type BrokerOrdersInt interface {
+	GetBrokerOpenOrders() (orders []*Order, err error)
+}
+
 type OrderInt interface {
 	Close() (rate float64, profit float64, err error)
 }
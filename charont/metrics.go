@@ -0,0 +1,12 @@
+package charont
+
+import (
+	"github.com/alonsovidales/v/argos"
+)
+
+var (
+	ticksReceived = argos.GetCounter("v_charont_ticks_total", "Ticks received by currency", "curr")
+	feedLatency   = argos.GetHistogram("v_charont_feed_latency_seconds", "Seconds between the time of the price on the broker and its reception", argos.LatencyBuckets, "curr")
+	brokerLatency = argos.GetHistogram("v_charont_broker_request_seconds", "Latency of the requests to the broker by operation", argos.LatencyBuckets, "op")
+	brokerErrors  = argos.GetCounter("v_charont_broker_errors_total", "Failed requests to the broker by operation", "op")
+)
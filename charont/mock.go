@@ -4,8 +4,8 @@ import (
 	"bufio"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
-	"os"
 	"strings"
 	"sync"
 	"time"
@@ -24,11 +24,12 @@ type Mock struct {
 	mutexCurr      map[string]*sync.Mutex
 	openOrders     map[int64]*Order
 	ordersByCurr   map[string][]*Order
-	currLogsFile   *os.File
+	currLogsFile   io.ReadCloser
 	listeners      map[string][]func(currency string, ts int64)
 	orders         int64
 	currencies     []string
 	currentWin     float64
+	chaos          *chaosInjector
 }
 
 type currOpsInfo struct {
@@ -55,7 +56,7 @@ func GetMock(feedsFile string, feedsBySecond int, currencies []string, httpPort
 	}
 
 	if feedsFile != "" {
-		mock.currLogsFile, err = os.Open(feedsFile)
+		mock.currLogsFile, err = OpenFeeds(feedsFile)
 		if err != nil {
 			log.Error("Currency logs file can't be open, Error:", err)
 			return
@@ -78,6 +79,12 @@ func GetMock(feedsFile string, feedsBySecond int, currencies []string, httpPort
 	return
 }
 
+// SetChaos enables the fault injection on the broker using the given
+// configuration, it has to be called before Run
+func (mock *Mock) SetChaos(chaos *Chaos) {
+	mock.chaos = newChaosInjector(chaos)
+}
+
 func (mock *Mock) GetBaseCurrency() string {
 	return "EUR"
 }
@@ -165,6 +172,11 @@ func (mock *Mock) getCurrentRealProfit() (profit float64) {
 
 func (mock *Mock) placeMarketOrder(inst string, units int, side string, price float64, realOps bool, ts int64) (order *Order, err error) {
 	// TODO Place market order
+	if mock.chaos != nil && mock.chaos.rejectOrder() {
+		log.Debug("Chaos: Order rejected, Curr:", inst, "Type:", side, "Units:", units)
+		return nil, ErrChaosOrderRejected
+	}
+
 	mock.mutex.Lock()
 	defer mock.mutex.Unlock()
 	orderID := mock.orders
@@ -184,6 +196,10 @@ func (mock *Mock) placeMarketOrder(inst string, units int, side string, price fl
 	} else {
 		mock.openOrders[orderID].CloseRate = price
 	}
+	mock.openOrders[orderID].setOpenRef(lastVal(mock.currencyValues[inst]))
+	if mock.chaos != nil {
+		mock.chaos.delayFill(mock.openOrders[orderID])
+	}
 	return mock.openOrders[orderID], nil
 }
 
@@ -198,13 +214,19 @@ func (mock *Mock) Sell(currency string, units int, bound float64, realOps bool,
 func (mock *Mock) CloseOrder(ord *Order, ts int64) (err error) {
 	var realOrder string
 
+	if mock.chaos != nil && mock.chaos.failClose() {
+		log.Debug("Chaos: Close failed for order:", ord.Id, "Curr:", ord.Curr)
+		return ErrChaosCloseFailed
+	}
+
 	currVals := mock.currencyValues[ord.Curr]
 	if ord.Type == "buy" {
 		ord.CloseRate = currVals[len(currVals)-1].Bid
 	} else {
 		ord.Price = currVals[len(currVals)-1].Ask
 	}
-	ord.Profit = ord.CloseRate/ord.Price - 1
+	ord.setCloseRef(lastVal(currVals))
+	ord.settle()
 	ord.SellTs = ts
 
 	mock.mutex.Lock()
@@ -214,7 +236,7 @@ func (mock *Mock) CloseOrder(ord *Order, ts int64) (err error) {
 	mock.mutex.Unlock()
 
 	if ord.Real {
-		mock.currentWin += ord.Profit * float64(ord.Units)
+		mock.currentWin += ord.Pl
 		realOrder = "Real"
 	} else {
 		realOrder = "Simultaion"
@@ -224,9 +246,26 @@ func (mock *Mock) CloseOrder(ord *Order, ts int64) (err error) {
 	return
 }
 
+// GetBrokerOpenOrders returns the real orders still open
+func (mock *Mock) GetBrokerOpenOrders() (orders []*Order, err error) {
+	mock.mutex.Lock()
+	defer mock.mutex.Unlock()
+
+	for _, ord := range mock.openOrders {
+		if ord.Real {
+			orders = append(orders, ord)
+		}
+	}
+
+	return
+}
+
+// CloseAllOpenOrders closes the real orders still open, the simulated ones
+// are closed by the traders
 func (mock *Mock) CloseAllOpenOrders() {
-	for ordId, _ := range mock.openOrders {
-		mock.CloseOrder(mock.openOrders[ordId], 0)
+	orders, _ := mock.GetBrokerOpenOrders()
+	for _, ord := range orders {
+		mock.CloseOrder(ord, 0)
 	}
 }
 
@@ -260,20 +299,35 @@ func (mock *Mock) ratesCollector() {
 		}
 
 		mock.mutexCurr[curr].Lock()
-		//log.Debug("New price for currency:", curr, "Bid:", feed.Bid, "Ask:", feed.Ask)
-		mock.currencyValues[curr] = append(mock.currencyValues[curr], &CurrVal{
-			Ts:  feed.Ts,
-			Bid: feed.Bid,
-			Ask: feed.Ask,
-		})
-
-		if listeners, ok := mock.listeners[curr]; ok {
-			for _, listener := range listeners {
-				listener(curr, feed.Ts)
+		ticks := []*CurrVal{&feed}
+		if mock.chaos != nil {
+			lastTs := int64(0)
+			if len(mock.currencyValues[curr]) > 0 {
+				lastTs = mock.currencyValues[curr][len(mock.currencyValues[curr])-1].Ts
 			}
+			ticks = mock.chaos.feedTicks(&feed, lastTs)
 		}
-		if len(mock.currencyValues[curr]) > MAX_RATES_TO_STORE {
-			mock.currencyValues[curr] = mock.currencyValues[curr][1:]
+
+		for _, tick := range ticks {
+			//log.Debug("New price for currency:", curr, "Bid:", tick.Bid, "Ask:", tick.Ask)
+			ticksReceived.Inc(curr)
+			mock.currencyValues[curr] = append(mock.currencyValues[curr], &CurrVal{
+				Ts:  tick.Ts,
+				Bid: tick.Bid,
+				Ask: tick.Ask,
+			})
+			if mock.chaos != nil {
+				mock.chaos.fillPending(curr, tick)
+			}
+
+			if listeners, ok := mock.listeners[curr]; ok {
+				for _, listener := range listeners {
+					listener(curr, tick.Ts)
+				}
+			}
+			if len(mock.currencyValues[curr]) > MAX_RATES_TO_STORE {
+				mock.currencyValues[curr] = mock.currencyValues[curr][1:]
+			}
 		}
 		mock.mutexCurr[curr].Unlock()
 
@@ -6,7 +6,6 @@ import (
 	"io/ioutil"
 	"net/http"
 	"net/url"
-	"os"
 	"strings"
 	"sync"
 	"time"
@@ -21,6 +20,7 @@ const (
 	PLACE_ORDER_URL           = "https://%s/v1/accounts/%d/orders"
 	FEEDS_URL                 = "https://%s/v1/prices?instruments="
 	CHECK_ORDER_URL           = "https://%s/v1/accounts/%d/trades/%d"
+	OPEN_TRADES_URL           = "https://%s/v1/accounts/%d/trades?count=500"
 )
 
 type feedStruc struct {
@@ -39,6 +39,18 @@ type orderStruc struct {
 	Info  *orderInfoStruc `json:"tradeOpened"`
 }
 
+type tradeStruc struct {
+	Id         int64   `json:"id"`
+	Units      int     `json:"units"`
+	Side       string  `json:"side"`
+	Instrument string  `json:"instrument"`
+	Price      float64 `json:"price"`
+}
+
+type tradesStruc struct {
+	Trades []*tradeStruc `json:"trades"`
+}
+
 type accountStruc struct {
 	AccountId       int     `json:"accountId"`
 	AccountName     string  `json:"accountName"`
@@ -63,12 +75,17 @@ type Oanda struct {
 	account         *accountStruc
 	openOrders      map[int64]*Order
 	simulatedOrders int64
-	currLogsFile    *os.File
+	recorder        *Recorder
 	currentWin      float64
 	listeners       map[string][]func(currency string, ts int64)
+	// feed is the API that collects the prices used by this one, nil if it
+	// collects its own prices, and feedCurrencies the currencies collected
+	// for all the APIs that share its feed
+	feed           *Oanda
+	feedCurrencies []string
 }
 
-func InitOandaApi(endpoint string, authToken string, accountId int, currencies []string, currLogsFile string) (api *Oanda, err error) {
+func InitOandaApi(endpoint string, authToken string, accountId int, currencies []string, recorder *Recorder) (api *Oanda, err error) {
 	var resp []byte
 
 	api = &Oanda{
@@ -76,18 +93,13 @@ func InitOandaApi(endpoint string, authToken string, accountId int, currencies [
 		openOrders:      make(map[int64]*Order),
 		authToken:       authToken,
 		currencies:      currencies,
+		feedCurrencies:  append([]string{}, currencies...),
 		listeners:       make(map[string][]func(currency string, ts int64)),
 		currentWin:      0,
 		simulatedOrders: 0,
+		recorder:        recorder,
 	}
 
-	if currLogsFile != "" {
-		api.currLogsFile, err = os.Create(currLogsFile)
-		if err != nil {
-			log.Error("Currency logs file can't be open, Error:", err)
-			return
-		}
-	}
 	api.mutex.Lock()
 
 	if accountId == -1 {
@@ -106,11 +118,11 @@ func InitOandaApi(endpoint string, authToken string, accountId int, currencies [
 		if err != nil {
 			return nil, err
 		}
-		resp, err = api.doRequest("GET", fmt.Sprintf(ACCOUNT_INFO_URL, api.endpoint), nil)
+		resp, err = api.doRequest("account", "GET", fmt.Sprintf(ACCOUNT_INFO_URL, api.endpoint), nil)
 
 		log.Info("New account generated:", int(accInfo["accountId"].(float64)))
 	} else {
-		resp, err = api.doRequest("GET", fmt.Sprintf("%s%d", fmt.Sprintf(ACCOUNT_INFO_URL, api.endpoint), accountId), nil)
+		resp, err = api.doRequest("account", "GET", fmt.Sprintf("%s%d", fmt.Sprintf(ACCOUNT_INFO_URL, api.endpoint), accountId), nil)
 	}
 
 	if err != nil {
@@ -128,13 +140,88 @@ func InitOandaApi(endpoint string, authToken string, accountId int, currencies [
 }
 
 func (api *Oanda) Run() {
+	if api.feed != nil {
+		log.Info("The prices are collected by the shared feed of the account:", api.feed.account.AccountId)
+		return
+	}
+
 	go api.ratesCollector()
 }
 
+// ShareFeed makes the account take the prices from the feed of this API
+// instead of collecting them, the currencies of the account are added to the
+// collected ones. Both accounts have to use the same endpoint and account
+// currency, it has to be called before Run
+func (api *Oanda) ShareFeed(account *Oanda) (err error) {
+	if account.endpoint != api.endpoint || account.GetBaseCurrency() != api.GetBaseCurrency() {
+		return fmt.Errorf("charont: the feed of the account %d can't be shared with the account %d, the endpoint or the currency are different", api.account.AccountId, account.account.AccountId)
+	}
+
+	api.mutex.Lock()
+	defer api.mutex.Unlock()
+
+	account.feed = api
+	for _, curr := range account.currencies {
+		collected := false
+		for _, feedCurr := range api.feedCurrencies {
+			collected = collected || feedCurr == curr
+		}
+		if !collected {
+			api.feedCurrencies = append(api.feedCurrencies, curr)
+		}
+	}
+
+	return
+}
+
+// SetRecorder stores the prices collected by the API on the recorder, it has
+// to be called before Run
+func (api *Oanda) SetRecorder(recorder *Recorder) {
+	api.mutex.Lock()
+	defer api.mutex.Unlock()
+
+	api.recorder = recorder
+}
+
+// source returns the API that collects the prices
+func (api *Oanda) source() *Oanda {
+	if api.feed != nil {
+		return api.feed
+	}
+
+	return api
+}
+
+// lastPrice returns the last price collected for the currency, nil if there
+// are no prices
+func (api *Oanda) lastPrice(curr string) *CurrVal {
+	src := api.source()
+	src.mutex.Lock()
+	defer src.mutex.Unlock()
+
+	return lastVal(src.currencyValues[curr])
+}
+
 func (api *Oanda) GetBaseCurrency() string {
 	return api.account.AccountCurrency
 }
 
+// GetEquity returns the balance of the account plus the unrealized profit of
+// the open trades
+func (api *Oanda) GetEquity() (equity float64, err error) {
+	resp, err := api.doRequest("equity", "GET", fmt.Sprintf("%s%d", fmt.Sprintf(ACCOUNT_INFO_URL, api.endpoint), api.account.AccountId), nil)
+	if err != nil {
+		return
+	}
+
+	account := &accountStruc{}
+	if err = json.Unmarshal(resp, account); err != nil {
+		return
+	}
+
+	return account.Balance + account.UnrealizedPl, nil
+}
+
 func (api *Oanda) GetCurrencies() []string {
 	return api.currencies
 }
@@ -142,28 +229,31 @@ func (api *Oanda) GetCurrencies() []string {
 func (api *Oanda) GetAllCurrVals() (result map[string][]*CurrVal) {
 	result = make(map[string][]*CurrVal)
 
-	api.mutex.Lock()
-	for curr, values := range api.currencyValues {
+	src := api.source()
+	src.mutex.Lock()
+	for curr, values := range src.currencyValues {
 		result[curr] = values
 	}
-	api.mutex.Unlock()
+	src.mutex.Unlock()
 
 	return
 }
 
 func (api *Oanda) GetRange(curr string, from, to int64) []*CurrVal {
-	api.mutex.Lock()
-	defer api.mutex.Unlock()
+	src := api.source()
+	src.mutex.Lock()
+	defer src.mutex.Unlock()
 
-	if len(api.currencyValues[curr]) <= 1 {
+	values := src.currencyValues[curr]
+	if len(values) <= 1 {
 		return nil
 	}
 
 	min := 0
-	max := len(api.currencyValues[curr])
+	max := len(values)
 	for min != max && max-min != 1 {
 		c := ((max - min) / 2) + min
-		if api.currencyValues[curr][c].Ts > from {
+		if values[c].Ts > from {
 			max = c
 		} else {
 			min = c
@@ -171,22 +261,22 @@ func (api *Oanda) GetRange(curr string, from, to int64) []*CurrVal {
 	}
 
 	fromPos := max
-	if fromPos >= len(api.currencyValues[curr]) {
+	if fromPos >= len(values) {
 		fromPos--
 	}
-	if api.currencyValues[curr][fromPos].Ts >= from {
+	if values[fromPos].Ts >= from {
 		fromPos = min
 	}
 
 	if to == -1 {
-		return api.currencyValues[curr][fromPos:]
+		return values[fromPos:]
 	}
 
 	min = fromPos
-	max = len(api.currencyValues[curr])
+	max = len(values)
 	for min != max && max-min != 1 {
 		c := ((max - min) / 2) + min
-		if api.currencyValues[curr][c].Ts > to {
+		if values[c].Ts > to {
 			max = c
 		} else {
 			min = c
@@ -194,18 +284,19 @@ func (api *Oanda) GetRange(curr string, from, to int64) []*CurrVal {
 	}
 
 	toPos := max
-	if toPos >= len(api.currencyValues[curr]) {
+	if toPos >= len(values) {
 		toPos--
 	}
-	if api.currencyValues[curr][toPos].Ts >= to {
+	if values[toPos].Ts >= to {
 		toPos = min
 	}
 
-	return api.currencyValues[curr][fromPos:toPos]
+	return values[fromPos:toPos]
 }
 
 func (api *Oanda) placeMarketOrder(inst string, units int, side string, price float64, realOps bool, ts int64) (order *Order, err error) {
 	if !realOps {
+		ref := api.lastPrice(inst[4:])
 		api.mutex.Lock()
 		defer api.mutex.Unlock()
 
@@ -223,6 +314,7 @@ func (api *Oanda) placeMarketOrder(inst string, units int, side string, price fl
 		} else {
 			api.openOrders[api.simulatedOrders].CloseRate = price
 		}
+		api.openOrders[api.simulatedOrders].setOpenRef(ref)
 		api.simulatedOrders++
 		return api.openOrders[api.simulatedOrders-1], nil
 	}
@@ -236,7 +328,7 @@ func (api *Oanda) placeMarketOrder(inst string, units int, side string, price fl
 		bound = "upperBound"
 	}
 
-	resp, err := api.doRequest("POST", fmt.Sprintf(PLACE_ORDER_URL, api.endpoint, api.account.AccountId),
+	resp, err := api.doRequest("order", "POST", fmt.Sprintf(PLACE_ORDER_URL, api.endpoint, api.account.AccountId),
 		url.Values{
 			"instrument": {inst},
 			"units":      {fmt.Sprintf("%d", int(units))},
@@ -253,6 +345,9 @@ func (api *Oanda) placeMarketOrder(inst string, units int, side string, price fl
 	err = json.Unmarshal(resp, &orderInfo)
 	if err != nil || orderInfo.Info == nil {
 		log.Error("The response from the server to place an order can't be parsed:", string(resp), "Error:", err)
+		if err == nil {
+			err = fmt.Errorf("charont: no trade opened on the response: %s", string(resp))
+		}
 		return
 	}
 	log.Debug("Values: instrument:", inst, "units", units, "side:", side, "type: market ID:", orderInfo, "\nOrder response:", string(resp))
@@ -273,6 +368,7 @@ func (api *Oanda) placeMarketOrder(inst string, units int, side string, price fl
 		order.CloseRate = orderInfo.Price
 	}
 
+	order.setOpenRef(api.lastPrice(inst[4:]))
 	api.mutex.Lock()
 	api.openOrders[order.Id] = order
 	api.mutex.Unlock()
@@ -297,7 +393,7 @@ func (api *Oanda) CloseOrder(ord *Order, ts int64) (err error) {
 	ord.SellTs = ts
 	ord.Open = false
 	if ord.Real {
-		resp, err := api.doRequest("DELETE", fmt.Sprintf(CHECK_ORDER_URL, api.endpoint, api.account.AccountId, ord.Id), nil)
+		resp, err := api.doRequest("close", "DELETE", fmt.Sprintf(CHECK_ORDER_URL, api.endpoint, api.account.AccountId, ord.Id), nil)
 		if err != nil {
 			log.Error("Problem trying to close an open position, Error:", err)
 			return err
@@ -305,24 +401,34 @@ func (api *Oanda) CloseOrder(ord *Order, ts int64) (err error) {
 		generic := map[string]float64{}
 		json.Unmarshal(resp, &generic)
 
-		ord.CloseRate = generic["price"]
-		ord.Profit = generic["profit"] / float64(ord.Units)
+		if ord.Type == "buy" {
+			ord.CloseRate = generic["price"]
+		} else {
+			ord.Price = generic["price"]
+		}
+		ord.setCloseRef(api.lastPrice(ord.Curr[4:]))
 		api.mutex.Lock()
 		delete(api.openOrders, ord.Id)
 		api.mutex.Unlock()
 
-		api.currentWin += ord.Profit
+		// The profit reported by the broker includes the financing and
+		// commissions
+		ord.settle()
+		ord.Pl = generic["profit"]
+		api.currentWin += ord.Pl
 		realOrder = "Real"
 	} else {
-		api.mutex.Lock()
-		lastPrice := api.currencyValues[ord.Curr[4:]][len(api.currencyValues[ord.Curr[4:]])-1]
-		api.mutex.Unlock()
+		lastPrice := api.lastPrice(ord.Curr[4:])
+		if lastPrice == nil {
+			return fmt.Errorf("charont: no prices to close the order %d", ord.Id)
+		}
 		if ord.Type == "buy" {
 			ord.CloseRate = lastPrice.Bid
 		} else {
 			ord.Price = lastPrice.Ask
 		}
-		ord.Profit = ord.CloseRate/ord.Price - 1
+		ord.setCloseRef(lastPrice)
+		ord.settle()
 		realOrder = "Simultaion"
 	}
 	log.Debug("Closed Order:", ord.Id, "BuyTs:", time.Unix(ord.BuyTs/tsMultToSecs, 0), "TimeToSell:", (ord.SellTs-ord.BuyTs)/tsMultToSecs, "Curr:", ord.Curr, "OpenRate:", ord.Price, "Close rate:", ord.CloseRate, "And Profit:", ord.Profit, "Current Win:", api.currentWin, "Type:", realOrder)
@@ -330,9 +436,55 @@ func (api *Oanda) CloseOrder(ord *Order, ts int64) (err error) {
 	return
 }
 
+// GetBrokerOpenOrders returns the real orders that the broker reports as
+// open, the ones placed by this API are returned as they were placed
+func (api *Oanda) GetBrokerOpenOrders() (orders []*Order, err error) {
+	var trades tradesStruc
+
+	resp, err := api.doRequest("trades", "GET", fmt.Sprintf(OPEN_TRADES_URL, api.endpoint, api.account.AccountId), nil)
+	if err != nil {
+		return
+	}
+	if err = json.Unmarshal(resp, &trades); err != nil {
+		return
+	}
+
+	api.mutex.Lock()
+	defer api.mutex.Unlock()
+	for _, trade := range trades.Trades {
+		if ord, ok := api.openOrders[trade.Id]; ok && ord.Real {
+			orders = append(orders, ord)
+			continue
+		}
+		ord := &Order{
+			Id:    trade.Id,
+			Units: trade.Units,
+			Curr:  trade.Instrument,
+			Real:  true,
+			Type:  trade.Side,
+			Open:  true,
+		}
+		if trade.Side == "buy" {
+			ord.Price = trade.Price
+		} else {
+			ord.CloseRate = trade.Price
+		}
+		orders = append(orders, ord)
+	}
+
+	return
+}
+
+// CloseAllOpenOrders closes the real orders that the broker reports as open,
+// the simulated ones are closed by the traders
 func (api *Oanda) CloseAllOpenOrders() {
-	for ordId, _ := range api.openOrders {
-		api.CloseOrder(api.openOrders[ordId], time.Now().UnixNano())
+	orders, err := api.GetBrokerOpenOrders()
+	if err != nil {
+		log.Error("The open orders can't be obtained from the broker, Error:", err)
+		return
+	}
+	for _, ord := range orders {
+		api.CloseOrder(ord, time.Now().UnixNano())
 	}
 }
 
@@ -341,12 +493,12 @@ func (api *Oanda) ratesCollector() {
 
 	api.mutex.Lock()
 	api.currencyValues = make(map[string][]*CurrVal)
-	currExange := make([]string, len(api.currencies))
+	currExange := make([]string, len(api.feedCurrencies))
 	lasCurrPriceA := make(map[string]float64)
 	lasCurrPriceB := make(map[string]float64)
 
-	log.Debug("Curr:", api.currencies)
-	for i, curr := range api.currencies {
+	log.Debug("Curr:", api.feedCurrencies)
+	for i, curr := range api.feedCurrencies {
 		api.currencyValues[curr] = []*CurrVal{}
 		currExange[i] = fmt.Sprintf("%s_%s", api.account.AccountCurrency, curr)
 		lasCurrPriceA[curr] = 0
@@ -359,7 +511,7 @@ func (api *Oanda) ratesCollector() {
 
 	c := time.Tick((1000 / COLLECT_BY_SECOND) * time.Millisecond)
 	for _ = range c {
-		resp, err := api.doRequest("GET", feedsUrl, nil)
+		resp, err := api.doRequest("prices", "GET", feedsUrl, nil)
 		if err != nil {
 			log.Error("The feeds URL can't be parsed, Error:", err)
 			continue
@@ -375,6 +527,10 @@ func (api *Oanda) ratesCollector() {
 			curr := feed.Instrument[len(api.account.AccountCurrency)+1:]
 			if lasCurrPriceA[curr] != feed.Ask || lasCurrPriceB[curr] != feed.Bid {
 				log.Debug("New price for currency:", curr, "Bid:", feed.Bid, "Ask:", feed.Ask)
+				ticksReceived.Inc(curr)
+				if feedTs, err := time.Parse(time.RFC3339Nano, feed.Time); err == nil {
+					feedLatency.Since(feedTs, curr)
+				}
 				api.mutex.Lock()
 				api.currencyValues[curr] = append(api.currencyValues[curr], &CurrVal{
 					Ts:  time.Now().UnixNano(),
@@ -383,10 +539,9 @@ func (api *Oanda) ratesCollector() {
 				})
 				api.mutex.Unlock()
 
-				if api.currLogsFile != nil {
+				if api.recorder != nil {
 					api.mutex.Lock()
-					b, _ := json.Marshal(api.currencyValues[curr][len(api.currencyValues[curr])-1])
-					_, err := api.currLogsFile.WriteString(fmt.Sprintf("%s:%s\n", curr, string(b)))
+					err := api.recorder.Write(curr, api.currencyValues[curr][len(api.currencyValues[curr])-1])
 					api.mutex.Unlock()
 					if err != nil {
 						log.Error("Can't write into the currencies logs file, Error:", err)
@@ -411,6 +566,11 @@ func (api *Oanda) ratesCollector() {
 }
 
 func (api *Oanda) AddListerner(currency string, fn func(currency string, ts int64)) {
+	if api.feed != nil {
+		api.feed.AddListerner(currency, fn)
+		return
+	}
+
 	api.mutex.Lock()
 	if _, ok := api.listeners[currency]; !ok {
 		api.listeners[currency] = []func(currency string, ts int64){}
@@ -419,10 +579,20 @@ func (api *Oanda) AddListerner(currency string, fn func(currency string, ts int6
 	api.mutex.Unlock()
 }
 
-func (api *Oanda) doRequest(method string, url string, data url.Values) (body []byte, err error) {
+// doRequest sends a request to the broker, the latency and the errors are
+// recorded by operation
+func (api *Oanda) doRequest(op string, method string, url string, data url.Values) (body []byte, err error) {
 	var req *http.Request
 	client := &http.Client{}
 
+	start := time.Now()
+	defer func() {
+		brokerLatency.Since(start, op)
+		if err != nil {
+			brokerErrors.Inc(op)
+		}
+	}()
+
 	if data != nil {
 		req, err = http.NewRequest(method, url, strings.NewReader(data.Encode()))
 	} else {
@@ -437,8 +607,12 @@ func (api *Oanda) doRequest(method string, url string, data url.Values) (body []
 	if err != nil {
 		return
 	}
+	defer resp.Body.Close()
 
 	body, err = ioutil.ReadAll(resp.Body)
+	if err == nil && resp.StatusCode >= http.StatusBadRequest {
+		err = fmt.Errorf("charont: the broker returned the status %d on %s: %s", resp.StatusCode, op, string(body))
+	}
 
 	return
 }
@@ -1,6 +1,8 @@
 package charont
 
 import (
+	"net/http"
+	"net/http/httptest"
 	"strings"
 	"testing"
 	"time"
@@ -17,7 +19,7 @@ func TestPlaceOrder(t *testing.T) {
 		cfg.GetStr("oanda", "token"),
 		int(cfg.GetInt("oanda", "account-id")),
 		strings.Split(cfg.GetStr("oanda", "currencies"), ","),
-		cfg.GetStr("oanda", "exanges-log"),
+		nil,
 	)
 
 	if err != nil {
@@ -72,3 +74,22 @@ func TestPlaceOrder(t *testing.T) {
 		t.Error("Problem closing an order, Error:", err)
 	}
 }
+
+func TestDoRequestStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/fail" {
+			http.Error(w, `{"message": "rate limited"}`, http.StatusTooManyRequests)
+			return
+		}
+		w.Write([]byte(`{"price": 1}`))
+	}))
+	defer server.Close()
+
+	api := getOandaTest(1, "api", "EUR", []string{"USD"})
+	if body, err := api.doRequest("test", "GET", server.URL+"/ok", nil); err != nil || string(body) != `{"price": 1}` {
+		t.Error("The body should be returned, Body:", string(body), "Error:", err)
+	}
+	if _, err := api.doRequest("test", "GET", server.URL+"/fail", nil); err == nil || !strings.Contains(err.Error(), "429") {
+		t.Error("An error should be returned for the error status, Error:", err)
+	}
+}
@@ -0,0 +1,118 @@
+package charont
+
+// All the instruments are quoted against the account currency, the profit of
+// an order is obtained on the quote currency and converted to the account
+// currency using the price at which the order was closed
+
+// direction returns 1 for the buy orders and -1 for the sell ones
+func (ord *Order) direction() float64 {
+	if ord.Type == "buy" {
+		return 1
+	}
+
+	return -1
+}
+
+// Fills returns the prices at which the order was opened and closed
+func (ord *Order) Fills() (open, close float64) {
+	if ord.Type == "buy" {
+		return ord.Price, ord.CloseRate
+	}
+
+	return ord.CloseRate, ord.Price
+}
+
+// toAccount converts an amount of the quote currency to the account currency
+func (ord *Order) toAccount(amount float64) float64 {
+	_, close := ord.Fills()
+	if close == 0 {
+		return 0
+	}
+
+	return amount / close
+}
+
+// FillPl returns the profit in the account currency obtained from the fill
+// prices, without the financing or commissions applied by the broker. The
+// result of an order with legs is the sum of the results of its legs
+func (ord *Order) FillPl() (pl float64) {
+	if len(ord.Legs) > 0 {
+		for _, leg := range ord.Legs {
+			pl += leg.FillPl()
+		}
+
+		return
+	}
+
+	open, close := ord.Fills()
+
+	return ord.toAccount(ord.direction() * (close - open) * float64(ord.Units))
+}
+
+// OpenPl returns the profit in the account currency that the open order would
+// obtain if it was closed at the prices of the tick
+func (ord *Order) OpenPl(val *CurrVal) float64 {
+	closed := *ord
+	closed.Legs = nil
+	if ord.Type == "buy" {
+		closed.CloseRate = val.Bid
+	} else {
+		closed.Price = val.Ask
+	}
+
+	return closed.FillPl()
+}
+
+// setOpenRef records the tick used as reference to place the order
+func (ord *Order) setOpenRef(val *CurrVal) {
+	if val == nil {
+		return
+	}
+
+	ord.Spread = val.Ask - val.Bid
+	ord.OpenRef = val.Bid
+	if ord.Type == "buy" {
+		ord.OpenRef = val.Ask
+	}
+}
+
+// setCloseRef records the tick used as reference to close the order
+func (ord *Order) setCloseRef(val *CurrVal) {
+	if val == nil {
+		return
+	}
+
+	ord.CloseRef = val.Ask
+	if ord.Type == "buy" {
+		ord.CloseRef = val.Bid
+	}
+}
+
+// settle calculates the normalized profit of a closed order, the profit
+// ratio, and the profit, spread and slippage costs on the account currency
+func (ord *Order) settle() {
+	open, close := ord.Fills()
+	units := float64(ord.Units)
+
+	ord.Profit = ord.CloseRate/ord.Price - 1
+	ord.Pl = ord.FillPl()
+	ord.SpreadCost = ord.toAccount(ord.Spread * units)
+
+	slippage := 0.0
+	if ord.OpenRef != 0 {
+		slippage += ord.direction() * (open - ord.OpenRef)
+	}
+	if ord.CloseRef != 0 {
+		slippage += ord.direction() * (ord.CloseRef - close)
+	}
+	ord.SlippageCost = ord.toAccount(slippage * units)
+}
+
+// lastVal returns the last value of the list or nil if it is empty
+func lastVal(vals []*CurrVal) *CurrVal {
+	if len(vals) == 0 {
+		return nil
+	}
+
+	return vals[len(vals)-1]
+}
@@ -0,0 +1,45 @@
+package charont
+
+import (
+	"math"
+	"testing"
+)
+
+func TestOrderSettle(t *testing.T) {
+	ord := &Order{
+		Type:  "buy",
+		Units: 1000,
+		Price: 1.101,
+	}
+	ord.setOpenRef(&CurrVal{Bid: 1.0998, Ask: 1.1})
+	ord.CloseRate = 1.199
+	ord.setCloseRef(&CurrVal{Bid: 1.2, Ask: 1.2002})
+	ord.settle()
+
+	if math.Abs(ord.Profit-(1.199/1.101-1)) > 1e-9 {
+		t.Error("The profit should be a ratio over the open price:", ord.Profit)
+	}
+	if math.Abs(ord.Pl-98/1.199) > 1e-9 {
+		t.Error("Unexpected profit on the account currency:", ord.Pl)
+	}
+	if math.Abs(ord.SlippageCost-2/1.199) > 1e-9 || math.Abs(ord.SpreadCost-0.2/1.199) > 1e-9 {
+		t.Error("Unexpected costs, Slippage:", ord.SlippageCost, "Spread:", ord.SpreadCost)
+	}
+
+	// The sell orders store the open price on CloseRate
+	ord = &Order{
+		Type:      "sell",
+		Units:     1000,
+		CloseRate: 1.2,
+	}
+	ord.setOpenRef(&CurrVal{Bid: 1.2, Ask: 1.2002})
+	if pl := ord.OpenPl(&CurrVal{Bid: 1.0998, Ask: 1.1}); math.Abs(pl-100/1.1) > 1e-9 || ord.Price != 0 {
+		t.Error("Unexpected profit of the open order:", pl)
+	}
+	ord.Price = 1.1
+	ord.setCloseRef(&CurrVal{Bid: 1.0998, Ask: 1.1})
+	ord.settle()
+	if math.Abs(ord.Pl-100/1.1) > 1e-9 || ord.SlippageCost != 0 || ord.Profit <= 0 {
+		t.Error("Unexpected sell results, Pl:", ord.Pl, "Slippage:", ord.SlippageCost, "Profit:", ord.Profit)
+	}
+}
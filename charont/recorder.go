@@ -0,0 +1,465 @@
+package charont
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alonsovidales/pit/log"
+)
+
+const (
+	ManifestFile          = "manifest.json"
+	recorderSegmentPrefix = "exanges-"
+	recorderSegmentExt    = ".log"
+	recorderCompressedExt = ".gz"
+)
+
+// Segment describes one of the files where the feeds are stored, the From and
+// To are the timestamps of the first and the last tick stored on it. The
+// closed segments are compressed on background
+type Segment struct {
+	File       string   `json:"file"`
+	From       int64    `json:"from"`
+	To         int64    `json:"to"`
+	Currencies []string `json:"currencies"`
+	Closed     bool     `json:"closed,omitempty"`
+	Compressed bool     `json:"compressed"`
+}
+
+// Manifest contains all the segments of a recording sorted by time
+type Manifest struct {
+	Segments []*Segment `json:"segments"`
+}
+
+// Recorder stores all the received feeds into a directory, appending them to
+// the last open segment, rotating the segments by size or by day and
+// compressing the closed ones. The manifest is written when a segment is
+// opened or closed
+type Recorder struct {
+	mutex       sync.Mutex
+	dir         string
+	maxSize     int64
+	rotateDaily bool
+	file        *os.File
+	size        int64
+	segment     *Segment
+	manifest    *Manifest
+	// compressing are the closed segments being compressed
+	compressing sync.WaitGroup
+}
+
+// GetRecorder returns a recorder that stores the feeds on the dir. If the dir
+// is the feeds file of a previous version, the file is moved into a new dir
+// with the same name as its first segment
+func GetRecorder(dir string, maxSizeMb int, rotateDaily bool) (rec *Recorder, err error) {
+	rec = &Recorder{
+		dir:         dir,
+		maxSize:     int64(maxSizeMb) * 1024 * 1024,
+		rotateDaily: rotateDaily,
+	}
+
+	if info, statErr := os.Stat(dir); statErr == nil && !info.IsDir() {
+		if err = rec.importFeedsFile(); err != nil {
+			return
+		}
+	} else {
+		if err = os.MkdirAll(dir, 0755); err != nil {
+			return
+		}
+		if rec.manifest, err = readManifest(filepath.Join(dir, ManifestFile)); err != nil {
+			if !os.IsNotExist(err) {
+				return
+			}
+			rec.manifest = &Manifest{}
+			err = nil
+		}
+	}
+
+	// Continue with the last segment if it was not closed, the ticks
+	// written after the last sync of the manifest are read from the file
+	last := len(rec.manifest.Segments) - 1
+	if last >= 0 && !rec.manifest.Segments[last].Closed && !rec.manifest.Segments[last].Compressed {
+		rec.segment = rec.manifest.Segments[last]
+		path := filepath.Join(dir, rec.segment.File)
+		if err = scanSegment(path, rec.segment); err != nil && !os.IsNotExist(err) {
+			return
+		}
+		if rec.file, err = os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644); err != nil {
+			return
+		}
+		var info os.FileInfo
+		if info, err = rec.file.Stat(); err != nil {
+			return
+		}
+		rec.size = info.Size()
+		log.Info("Appending feeds to the segment:", rec.segment.File, "Size:", rec.size)
+	}
+
+	// The segments closed but not compressed before a restart
+	for _, segment := range rec.manifest.Segments {
+		if segment.Closed && !segment.Compressed {
+			rec.compressing.Add(1)
+			go rec.compressSegment(segment)
+		}
+	}
+
+	return
+}
+
+// Write stores the value for the currency, the segment is rotated if the
+// value can't be stored on the current one
+func (rec *Recorder) Write(curr string, val *CurrVal) (err error) {
+	rec.mutex.Lock()
+	defer rec.mutex.Unlock()
+
+	if rec.segment != nil && rec.shouldRotate(val.Ts) {
+		if err = rec.closeSegment(); err != nil {
+			return
+		}
+	}
+	if rec.segment == nil {
+		if err = rec.openSegment(val.Ts); err != nil {
+			return
+		}
+	}
+
+	b, _ := json.Marshal(val)
+	n, err := rec.file.WriteString(fmt.Sprintf("%s:%s\n", curr, string(b)))
+	rec.size += int64(n)
+	if err != nil {
+		return
+	}
+
+	rec.segment.add(curr, val.Ts)
+
+	return
+}
+
+// add records a tick of the currency on the segment
+func (segment *Segment) add(curr string, ts int64) {
+	if segment.From == 0 {
+		segment.From = ts
+	}
+	segment.To = ts
+	if !inSlice(curr, segment.Currencies) {
+		segment.Currencies = append(segment.Currencies, curr)
+		sort.Strings(segment.Currencies)
+	}
+}
+
+// Close closes the current segment and waits until all the closed segments
+// are compressed
+func (rec *Recorder) Close() (err error) {
+	rec.mutex.Lock()
+	if rec.segment != nil {
+		err = rec.closeSegment()
+	}
+	rec.mutex.Unlock()
+
+	rec.compressing.Wait()
+
+	return
+}
+
+func (rec *Recorder) shouldRotate(ts int64) bool {
+	if rec.maxSize > 0 && rec.size >= rec.maxSize {
+		return true
+	}
+	if rec.rotateDaily && rec.segment.From != 0 {
+		from := time.Unix(0, rec.segment.From).UTC()
+		current := time.Unix(0, ts).UTC()
+
+		return from.YearDay() != current.YearDay() || from.Year() != current.Year()
+	}
+
+	return false
+}
+
+func (rec *Recorder) openSegment(ts int64) (err error) {
+	name := fmt.Sprintf("%s%s%s", recorderSegmentPrefix, time.Unix(0, ts).UTC().Format("20060102-150405.000000000"), recorderSegmentExt)
+	if rec.file, err = os.OpenFile(filepath.Join(rec.dir, name), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644); err != nil {
+		return
+	}
+
+	rec.size = 0
+	rec.segment = &Segment{
+		File:       name,
+		From:       ts,
+		Currencies: []string{},
+	}
+	rec.manifest.Segments = append(rec.manifest.Segments, rec.segment)
+	log.Info("New feeds segment:", name)
+
+	return rec.writeManifest()
+}
+
+// closeSegment closes the current segment and starts its compression, the
+// mutex has to be locked
+func (rec *Recorder) closeSegment() (err error) {
+	if err = rec.file.Close(); err != nil {
+		return
+	}
+
+	log.Info("Feeds segment closed:", rec.segment.File, "From:", time.Unix(0, rec.segment.From), "To:", time.Unix(0, rec.segment.To))
+	segment := rec.segment
+	segment.Closed = true
+	rec.segment = nil
+	rec.file = nil
+	if err = rec.writeManifest(); err != nil {
+		return
+	}
+
+	rec.compressing.Add(1)
+	go rec.compressSegment(segment)
+
+	return
+}
+
+// compressSegment compresses a closed segment, the plain file is removed once
+// the manifest points to the compressed one
+func (rec *Recorder) compressSegment(segment *Segment) {
+	defer rec.compressing.Done()
+
+	rec.mutex.Lock()
+	plainPath := filepath.Join(rec.dir, segment.File)
+	rec.mutex.Unlock()
+
+	if err := compressFile(plainPath, plainPath+recorderCompressedExt); err != nil {
+		log.Error("The feeds segment:", plainPath, "can't be compressed, Error:", err)
+		return
+	}
+
+	rec.mutex.Lock()
+	segment.File += recorderCompressedExt
+	segment.Compressed = true
+	err := rec.writeManifest()
+	rec.mutex.Unlock()
+	if err != nil {
+		log.Error("The manifest of the feeds can't be written, Error:", err)
+		return
+	}
+
+	if err = os.Remove(plainPath); err != nil {
+		log.Error("The compressed feeds segment:", plainPath, "can't be removed, Error:", err)
+	}
+}
+
+func (rec *Recorder) writeManifest() (err error) {
+	b, err := json.MarshalIndent(rec.manifest, "", "\t")
+	if err != nil {
+		return
+	}
+
+	tmpPath := filepath.Join(rec.dir, ManifestFile+".tmp")
+	if err = ioutil.WriteFile(tmpPath, b, 0644); err != nil {
+		return
+	}
+
+	return os.Rename(tmpPath, filepath.Join(rec.dir, ManifestFile))
+}
+
+func compressFile(from, to string) (err error) {
+	src, err := os.Open(from)
+	if err != nil {
+		return
+	}
+	defer src.Close()
+
+	dst, err := os.Create(to)
+	if err != nil {
+		return
+	}
+	defer dst.Close()
+
+	gz := gzip.NewWriter(dst)
+	if _, err = io.Copy(gz, src); err != nil {
+		return
+	}
+
+	return gz.Close()
+}
+
+// scanSegment completes the segment with the ticks stored on its file
+func scanSegment(path string, segment *Segment) (err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		parts := strings.SplitN(scanner.Text(), ":", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		val := &CurrVal{}
+		if json.Unmarshal([]byte(parts[1]), val) == nil {
+			segment.add(parts[0], val.Ts)
+		}
+	}
+
+	return scanner.Err()
+}
+
+// importFeedsFile moves the feeds file on the path of the recording into a new
+// dir with the same path, the file is the first closed segment of the
+// recording
+func (rec *Recorder) importFeedsFile() (err error) {
+	segment := &Segment{
+		Currencies: []string{},
+		Closed:     true,
+	}
+	if err = scanSegment(rec.dir, segment); err != nil {
+		return
+	}
+	segment.File = fmt.Sprintf("%s%s%s", recorderSegmentPrefix, time.Unix(0, segment.From).UTC().Format("20060102-150405.000000000"), recorderSegmentExt)
+
+	tmpPath := rec.dir + ".tmp"
+	if err = os.Rename(rec.dir, tmpPath); err != nil {
+		return
+	}
+	if err = os.MkdirAll(rec.dir, 0755); err != nil {
+		return
+	}
+	if err = os.Rename(tmpPath, filepath.Join(rec.dir, segment.File)); err != nil {
+		return
+	}
+	log.Info("Feeds file imported into the recording:", rec.dir, "Segment:", segment.File)
+
+	rec.manifest = &Manifest{Segments: []*Segment{segment}}
+
+	return rec.writeManifest()
+}
+
+func readManifest(path string) (manifest *Manifest, err error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return
+	}
+
+	manifest = &Manifest{}
+	err = json.Unmarshal(b, manifest)
+
+	return
+}
+
+// OpenFeeds returns a reader with all the feeds stored on the path, it can be
+// a single file, compressed or not, a recording directory or its manifest, in
+// the last two cases all the segments are read in order
+func OpenFeeds(path string) (reader io.ReadCloser, err error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return
+	}
+
+	dir := filepath.Dir(path)
+	manifestPath := path
+	if info.IsDir() {
+		dir = path
+		manifestPath = filepath.Join(path, ManifestFile)
+	} else if filepath.Base(path) != ManifestFile {
+		return openSegmentFile(path, strings.HasSuffix(path, recorderCompressedExt))
+	}
+
+	manifest, err := readManifest(manifestPath)
+	if err != nil {
+		return
+	}
+
+	feeds := &feedsReader{}
+	for _, segment := range manifest.Segments {
+		f, err := openSegmentFile(filepath.Join(dir, segment.File), segment.Compressed)
+		if err != nil {
+			feeds.Close()
+			return nil, err
+		}
+		feeds.segments = append(feeds.segments, f)
+	}
+
+	return feeds, nil
+}
+
+type gzipFile struct {
+	*gzip.Reader
+	file *os.File
+}
+
+func (gf *gzipFile) Close() error {
+	gf.Reader.Close()
+	return gf.file.Close()
+}
+
+func openSegmentFile(path string, compressed bool) (reader io.ReadCloser, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	if !compressed {
+		return f, nil
+	}
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		f.Close()
+		return
+	}
+
+	return &gzipFile{
+		Reader: gz,
+		file:   f,
+	}, nil
+}
+
+// feedsReader reads all the segments one after the other
+type feedsReader struct {
+	segments []io.ReadCloser
+	current  int
+}
+
+func (fr *feedsReader) Read(p []byte) (n int, err error) {
+	for fr.current < len(fr.segments) {
+		n, err = fr.segments[fr.current].Read(p)
+		if err == io.EOF {
+			fr.current++
+			if n > 0 {
+				return n, nil
+			}
+			continue
+		}
+
+		return
+	}
+
+	return 0, io.EOF
+}
+
+func (fr *feedsReader) Close() (err error) {
+	for _, segment := range fr.segments {
+		if segErr := segment.Close(); segErr != nil {
+			err = segErr
+		}
+	}
+
+	return
+}
+
+func inSlice(str string, list []string) bool {
+	for _, s := range list {
+		if s == str {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,90 @@
+package charont
+
+import (
+	"bufio"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+const dayNanosecs = 24 * 3600 * tsMultToSecs
+
+func TestRecorderRotateAndRead(t *testing.T) {
+	dir := t.TempDir()
+
+	rec, err := GetRecorder(dir, 0, true)
+	if err != nil {
+		t.Fatal("Problem creating the recorder, Error:", err)
+	}
+	rec.Write("USD", &CurrVal{Ts: 1, Bid: 1.1, Ask: 1.2})
+	rec.Write("GBP", &CurrVal{Ts: 2, Bid: 0.8, Ask: 0.9})
+	rec.Write("USD", &CurrVal{Ts: dayNanosecs + 1, Bid: 1.1, Ask: 1.2})
+
+	// A restart has to append to the open segment instead of truncate it
+	rec.compressing.Wait()
+	rec, err = GetRecorder(dir, 0, true)
+	if err != nil {
+		t.Fatal("Problem reopening the recorder, Error:", err)
+	}
+	rec.Write("USD", &CurrVal{Ts: dayNanosecs + 2, Bid: 1.1, Ask: 1.2})
+	if err = rec.Close(); err != nil {
+		t.Fatal("Problem closing the recorder, Error:", err)
+	}
+
+	manifest, err := readManifest(filepath.Join(dir, ManifestFile))
+	if err != nil {
+		t.Fatal("Problem reading the manifest, Error:", err)
+	}
+	if len(manifest.Segments) != 2 {
+		t.Fatal("Two segments were expected, but:", len(manifest.Segments), "were found")
+	}
+	if manifest.Segments[0].From != 1 || manifest.Segments[0].To != 2 || len(manifest.Segments[0].Currencies) != 2 {
+		t.Error("Unexpected first segment:", manifest.Segments[0])
+	}
+	if manifest.Segments[1].To != dayNanosecs+2 || !manifest.Segments[1].Compressed {
+		t.Error("Unexpected second segment:", manifest.Segments[1])
+	}
+
+	for _, path := range []string{dir, filepath.Join(dir, ManifestFile)} {
+		feeds, err := OpenFeeds(path)
+		if err != nil {
+			t.Fatal("Problem opening the feeds from:", path, "Error:", err)
+		}
+
+		lines := 0
+		scanner := bufio.NewScanner(feeds)
+		for scanner.Scan() {
+			lines++
+		}
+		feeds.Close()
+
+		if lines != 4 {
+			t.Error("Four lines were expected from:", path, "but:", lines, "were read")
+		}
+	}
+}
+
+func TestRecorderImportFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "exanges.log")
+	feeds := "USD:{\"b\":1.1,\"a\":1.2,\"t\":1}\nGBP:{\"b\":0.8,\"a\":0.9,\"t\":2}\n"
+	if err := ioutil.WriteFile(path, []byte(feeds), 0644); err != nil {
+		t.Fatal("Problem writing the feeds file, Error:", err)
+	}
+
+	rec, err := GetRecorder(path, 0, false)
+	if err != nil {
+		t.Fatal("The feeds file should be imported into the recording, Error:", err)
+	}
+	rec.Write("USD", &CurrVal{Ts: 3, Bid: 1.1, Ask: 1.2})
+	if err = rec.Close(); err != nil {
+		t.Fatal("Problem closing the recorder, Error:", err)
+	}
+
+	manifest, err := readManifest(filepath.Join(path, ManifestFile))
+	if err != nil || len(manifest.Segments) != 2 {
+		t.Fatal("The imported file should be the first segment, Manifest:", manifest, "Error:", err)
+	}
+	if imported := manifest.Segments[0]; imported.From != 1 || imported.To != 2 || len(imported.Currencies) != 2 || !imported.Compressed {
+		t.Error("Unexpected imported segment:", imported)
+	}
+}
@@ -0,0 +1,103 @@
+package charont
+
+import (
+	"sync"
+)
+
+// Shared is a collector used by several books, each book sees only its
+// currencies and its orders. Run doesn't start the collector, it has to be
+// started once all the books are listening to it so all of them receive the
+// same prices
+type Shared struct {
+	Int
+
+	mutex      sync.Mutex
+	currencies []string
+	// orders are the orders placed by the book still open
+	orders map[*Order]bool
+}
+
+func GetShared(collector Int, currencies []string) *Shared {
+	return &Shared{
+		Int:        collector,
+		currencies: currencies,
+		orders:     make(map[*Order]bool),
+	}
+}
+
+func (sh *Shared) Run() {
+}
+
+func (sh *Shared) GetCurrencies() []string {
+	return sh.currencies
+}
+
+// GetAllCurrVals returns the prices of the currencies of the book
+func (sh *Shared) GetAllCurrVals() map[string][]*CurrVal {
+	all := sh.Int.GetAllCurrVals()
+	result := make(map[string][]*CurrVal)
+	for _, curr := range sh.currencies {
+		if vals, ok := all[curr]; ok {
+			result[curr] = vals
+		}
+	}
+
+	return result
+}
+
+func (sh *Shared) placed(order *Order, err error) (*Order, error) {
+	if err == nil && order != nil {
+		sh.mutex.Lock()
+		sh.orders[order] = true
+		sh.mutex.Unlock()
+	}
+
+	return order, err
+}
+
+func (sh *Shared) Buy(currency string, units int, bound float64, realOps bool, ts int64) (order *Order, err error) {
+	return sh.placed(sh.Int.Buy(currency, units, bound, realOps, ts))
+}
+
+func (sh *Shared) Sell(currency string, units int, bound float64, realOps bool, ts int64) (order *Order, err error) {
+	return sh.placed(sh.Int.Sell(currency, units, bound, realOps, ts))
+}
+
+func (sh *Shared) CloseOrder(ord *Order, ts int64) (err error) {
+	if err = sh.Int.CloseOrder(ord, ts); err == nil {
+		sh.mutex.Lock()
+		delete(sh.orders, ord)
+		sh.mutex.Unlock()
+	}
+
+	return
+}
+
+// GetBrokerOpenOrders returns the real orders of the book still open
+func (sh *Shared) GetBrokerOpenOrders() (orders []*Order, err error) {
+	sh.mutex.Lock()
+	defer sh.mutex.Unlock()
+
+	for ord := range sh.orders {
+		if ord.Real {
+			orders = append(orders, ord)
+		}
+	}
+
+	return
+}
+
+// CloseAllOpenOrders closes the real orders of the book at the time of the
+// last price of their currencies, the orders of the other books are not
+// affected
+func (sh *Shared) CloseAllOpenOrders() {
+	orders, _ := sh.GetBrokerOpenOrders()
+	vals := sh.Int.GetAllCurrVals()
+	for _, ord := range orders {
+		ts := int64(0)
+		if last := lastVal(vals[ord.Curr]); last != nil {
+			ts = last.Ts
+		}
+		sh.CloseOrder(ord, ts)
+	}
+}
@@ -0,0 +1,104 @@
+package charont
+
+import (
+	"testing"
+)
+
+func getOandaTest(accountID int, endpoint, accountCurr string, currencies []string) *Oanda {
+	return &Oanda{
+		endpoint:       endpoint,
+		currencies:     currencies,
+		feedCurrencies: append([]string{}, currencies...),
+		account:        &accountStruc{AccountId: accountID, AccountCurrency: accountCurr},
+		openOrders:     make(map[int64]*Order),
+		listeners:      make(map[string][]func(currency string, ts int64)),
+	}
+}
+
+func TestShareFeed(t *testing.T) {
+	feed := getOandaTest(1, "api", "EUR", []string{"USD", "GBP"})
+	account := getOandaTest(2, "api", "EUR", []string{"GBP", "JPY"})
+	if err := feed.ShareFeed(account); err != nil {
+		t.Fatal("The feed should be shared, Error:", err)
+	}
+	if len(feed.feedCurrencies) != 3 || feed.feedCurrencies[2] != "JPY" || len(feed.GetCurrencies()) != 2 {
+		t.Error("The currencies of the account should be collected by the feed:", feed.feedCurrencies, feed.GetCurrencies())
+	}
+	if err := feed.ShareFeed(getOandaTest(3, "api", "USD", []string{"EUR"})); err == nil {
+		t.Error("The feed can't be shared with an account on a different currency")
+	}
+
+	account.AddListerner("JPY", func(currency string, ts int64) {})
+	if len(feed.listeners["JPY"]) != 1 || len(account.listeners) != 0 {
+		t.Error("The listeners should be added to the feed")
+	}
+
+	feed.currencyValues = map[string][]*CurrVal{
+		"JPY": {{Ts: 1, Bid: 100, Ask: 101}, {Ts: 2, Bid: 102, Ask: 103}, {Ts: 3, Bid: 104, Ask: 105}},
+	}
+	if vals := account.GetAllCurrVals()["JPY"]; len(vals) != 3 {
+		t.Error("The prices should be taken from the feed:", vals)
+	}
+	if vals := account.GetRange("JPY", 1, -1); len(vals) != 3 {
+		t.Error("The range should be taken from the feed:", vals)
+	}
+
+	ord, err := account.Buy("JPY", 10, 105, false, 3)
+	if err != nil || ord.OpenRef != 105 {
+		t.Fatal("The simulated order should use the price of the feed as reference, Error:", err, "Order:", ord)
+	}
+	if err = account.CloseOrder(ord, 4); err != nil || ord.CloseRate != 104 {
+		t.Error("The simulated order should be closed at the price of the feed, Error:", err, "Order:", ord)
+	}
+}
+
+type sharedTest struct {
+	Int
+
+	closed  int
+	closeTs int64
+}
+
+func (st *sharedTest) GetAllCurrVals() map[string][]*CurrVal {
+	return map[string][]*CurrVal{
+		"USD": {{Ts: 1, Bid: 1, Ask: 1}},
+		"GBP": {{Ts: 1, Bid: 2, Ask: 2}},
+	}
+}
+
+func (st *sharedTest) Buy(currency string, units int, bound float64, realOps bool, ts int64) (*Order, error) {
+	return &Order{Curr: currency, Units: units, Real: realOps, Open: true}, nil
+}
+
+func (st *sharedTest) CloseOrder(ord *Order, ts int64) error {
+	ord.Open = false
+	st.closed++
+	st.closeTs = ts
+	return nil
+}
+
+func TestShared(t *testing.T) {
+	collector := &sharedTest{}
+	shared := GetShared(collector, []string{"GBP"})
+	other := GetShared(collector, []string{"USD"})
+	if currs := shared.GetCurrencies(); len(currs) != 1 || currs[0] != "GBP" {
+		t.Error("Only the currencies of the book should be provided:", currs)
+	}
+	if vals := shared.GetAllCurrVals(); len(vals) != 1 || len(vals["GBP"]) != 1 {
+		t.Error("Only the prices of the currencies of the book should be provided:", vals)
+	}
+
+	realOrd, _ := shared.Buy("GBP", 10, 0, true, 1)
+	simulated, _ := shared.Buy("GBP", 10, 0, false, 1)
+	otherReal, _ := other.Buy("USD", 10, 0, true, 1)
+	shared.CloseAllOpenOrders()
+	if realOrd.Open || !simulated.Open || !otherReal.Open || collector.closed != 1 {
+		t.Error("Only the real orders of the book should be closed")
+	}
+	if collector.closeTs != 1 {
+		t.Error("The orders should be closed at the time of the last price, Ts:", collector.closeTs)
+	}
+	if orders, _ := other.GetBrokerOpenOrders(); len(orders) != 1 || orders[0] != otherReal {
+		t.Error("The orders of the other books should be still open:", orders)
+	}
+}
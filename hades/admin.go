@@ -0,0 +1,514 @@
+package hades
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alonsovidales/pit/log"
+	"github.com/alonsovidales/v/charont"
+	"github.com/alonsovidales/v/hermes"
+)
+
+const (
+	// auditEntriesToKeep is the number of the last audit entries returned by
+	// the API, all of them are stored on the audit file
+	auditEntriesToKeep = 1000
+)
+
+// TraderInfo is the state of a trader returned by the admin API, Forced is
+// "start" or "stop" if the trader was forced to play or not to play
+type TraderInfo struct {
+	ID          int                  `json:"id"`
+	Type        string               `json:"type"`
+	Currencies  []string             `json:"currencies"`
+	Playing     bool                 `json:"playing"`
+	Forced      string               `json:"forced,omitempty"`
+	Ops         int                  `json:"ops"`
+	Score       float64              `json:"score"`
+	TotalProfit float64              `json:"total_profit"`
+	Metrics     hermes.Metrics       `json:"metrics"`
+	Risk        hermes.RiskState     `json:"risk"`
+	RiskLimits  hermes.RiskLimits    `json:"risk_limits"`
+	Throttle    hermes.ThrottleState `json:"throttle"`
+	OpenOrders  []*charont.Order     `json:"open_orders"`
+}
+
+// AdminRequest is the body of the requests that modify the state, only the
+// fields used by each action are required
+type AdminRequest struct {
+	TraderID *int               `json:"trader,omitempty"`
+	OrderID  int64              `json:"order,omitempty"`
+	Value    int                `json:"value,omitempty"`
+	Curr     string             `json:"curr,omitempty"`
+	Risk     *hermes.RiskLimits `json:"risk,omitempty"`
+}
+
+// AuditEntry is a change requested using the admin API
+type AuditEntry struct {
+	Ts      int64         `json:"ts"`
+	Remote  string        `json:"remote"`
+	Action  string        `json:"action"`
+	Request *AdminRequest `json:"request"`
+	Result  string        `json:"result,omitempty"`
+	Error   string        `json:"error,omitempty"`
+}
+
+// auditor stores the audit entries as JSON lines on a file and keeps the last
+// ones in memory
+type auditor struct {
+	mutex   sync.Mutex
+	file    *os.File
+	entries []*AuditEntry
+}
+
+func getAuditor(path string) (au *auditor, err error) {
+	au = &auditor{}
+	if path != "" {
+		if au.file, err = os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644); err != nil {
+			return nil, err
+		}
+	}
+
+	return
+}
+
+func (au *auditor) record(entry *AuditEntry) {
+	au.mutex.Lock()
+	defer au.mutex.Unlock()
+
+	au.entries = append(au.entries, entry)
+	if len(au.entries) > auditEntriesToKeep {
+		au.entries = au.entries[len(au.entries)-auditEntriesToKeep:]
+	}
+
+	log.Info("Admin action:", entry.Action, "From:", entry.Remote, "Result:", entry.Result, "Error:", entry.Error)
+	if au.file == nil {
+		return
+	}
+	b, _ := json.Marshal(entry)
+	if _, err := au.file.Write(append(b, '\n')); err != nil {
+		log.Error("The audit entry can't be stored, Error:", err)
+	}
+}
+
+func (au *auditor) getEntries() []*AuditEntry {
+	au.mutex.Lock()
+	defer au.mutex.Unlock()
+
+	return append([]*AuditEntry{}, au.entries...)
+}
+
+func (au *auditor) close() {
+	au.mutex.Lock()
+	defer au.mutex.Unlock()
+
+	if au.file == nil {
+		return
+	}
+	if err := au.file.Close(); err != nil {
+		log.Error("The audit file can't be closed, Error:", err)
+	}
+	au.file = nil
+}
+
+// StartAdmin launches the admin HTTP API on the given port, all the requests
+// have to include the token as "Authorization: Bearer <token>" and all the
+// changes are stored on the audit file
+func (hades *Hades) StartAdmin(port int, token, auditFile string) (err error) {
+	if token == "" {
+		return fmt.Errorf("hades: the admin API requires a token")
+	}
+	if hades.auditor, err = getAuditor(auditFile); err != nil {
+		return
+	}
+
+	go func() {
+		log.Info("Starting admin API on port:", port)
+		if err := http.ListenAndServe(fmt.Sprintf(":%d", port), hades.adminHandler(token)); err != nil {
+			log.Fatal("The admin API can't be started:", err)
+		}
+	}()
+
+	return
+}
+
+// adminHandler returns the handler of all the admin API endpoints
+func (hades *Hades) adminHandler(token string) http.Handler {
+	actions := map[string]func(req *AdminRequest) (string, error){
+		"/admin/traders/start":         hades.adminStartTrader,
+		"/admin/traders/stop":          hades.adminStopTrader,
+		"/admin/traders/release":       hades.adminReleaseTrader,
+		"/admin/traders-that-can-play": hades.adminTradersThatCanPlay,
+		"/admin/risk":                  hades.adminRiskLimits,
+		"/admin/risk/reset":            hades.adminResetRisk,
+		"/admin/orders/close":          hades.adminCloseOrder,
+		"/admin/orders/close-all":      hades.adminCloseAll,
+		"/admin/currencies/pause":      hades.adminPause,
+		"/admin/currencies/resume":     hades.adminResume,
+		"/admin/breaker/trip":          hades.adminTripBreaker,
+		"/admin/breaker/reset":         hades.adminResetBreaker,
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/admin/traders", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, hades.GetTradersInfo())
+	})
+	mux.HandleFunc("/admin/status", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, hades.GetStatus())
+	})
+	mux.HandleFunc("/admin/portfolio", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, hades.GetPortfolioState())
+	})
+	mux.HandleFunc("/admin/currencies", func(w http.ResponseWriter, r *http.Request) {
+		hades.mutex.Lock()
+		currs := map[string][]string{
+			"paused":   {},
+			"disabled": {},
+		}
+		for curr := range hades.paused {
+			currs["paused"] = append(currs["paused"], curr)
+		}
+		for curr := range hades.disabled {
+			currs["disabled"] = append(currs["disabled"], curr)
+		}
+		hades.mutex.Unlock()
+
+		writeJSON(w, http.StatusOK, currs)
+	})
+	mux.HandleFunc("/admin/breaker", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, hades.GetBreakerState())
+	})
+	mux.HandleFunc("/admin/allocations", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, hades.GetAllocations())
+	})
+	mux.HandleFunc("/admin/lineage", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, hades.GetLineage())
+	})
+	mux.HandleFunc("/admin/audit", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, hades.auditor.getEntries())
+	})
+	for path, action := range actions {
+		mux.HandleFunc(path, hades.adminAction(strings.TrimPrefix(path, "/admin/"), action))
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth := r.Header.Get("Authorization")
+		if !strings.HasPrefix(auth, "Bearer ") || subtle.ConstantTimeCompare([]byte(auth[7:]), []byte(token)) != 1 {
+			log.Info("Unauthorized admin request from:", r.RemoteAddr, "Path:", r.URL.Path)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+// adminAction decodes the request, applies the action and records it on the
+// audit trail
+func (hades *Hades) adminAction(name string, action func(req *AdminRequest) (string, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		req := &AdminRequest{}
+		if r.ContentLength != 0 {
+			if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+				http.Error(w, fmt.Sprintf("Invalid request: %s", err), http.StatusBadRequest)
+				return
+			}
+		}
+
+		entry := &AuditEntry{
+			Ts:      time.Now().Unix(),
+			Remote:  r.RemoteAddr,
+			Action:  name,
+			Request: req,
+		}
+		result, err := action(req)
+		entry.Result = result
+		if err != nil {
+			entry.Error = err.Error()
+		} else {
+			hades.requestSelection()
+		}
+		hades.auditor.record(entry)
+
+		status := http.StatusOK
+		if err != nil {
+			status = http.StatusBadRequest
+		}
+		writeJSON(w, status, entry)
+	}
+}
+
+// writeJSON encodes the response before writing it, if it can't be encoded
+// an error is returned instead of a partial response
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		log.Error("The admin response can't be encoded, Error:", err)
+		http.Error(w, "The response can't be encoded", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(append(b, '\n'))
+}
+
+// GetTradersInfo returns the stats and playing state of all the traders
+func (hades *Hades) GetTradersInfo() (info []*TraderInfo) {
+	hades.mutex.Lock()
+	defer hades.mutex.Unlock()
+
+	for _, trader := range hades.traders {
+		ti := &TraderInfo{
+			ID:          trader.GetID(),
+			Type:        trader.GetType(),
+			Currencies:  trader.GetCurrencies(),
+			Playing:     trader.IsPlaying(),
+			Ops:         trader.GetNumOps(),
+			Score:       trader.GetScore(LastOpsToHaveInConsideration),
+			TotalProfit: trader.GetTotalProfit(),
+			Metrics:     trader.GetMetrics(),
+			Risk:        trader.GetRiskState(),
+			RiskLimits:  trader.GetRiskLimits(),
+			Throttle:    trader.GetThrottleState(),
+			OpenOrders:  trader.GetOpenOrders(),
+		}
+		if forced, ok := hades.forced[ti.ID]; ok {
+			ti.Forced = "stop"
+			if forced {
+				ti.Forced = "start"
+			}
+		}
+		info = append(info, ti)
+	}
+
+	return
+}
+
+// getTrader returns the trader of the request, the mutex has to be locked
+func (hades *Hades) getTrader(req *AdminRequest) (hermes.Int, error) {
+	if req.TraderID == nil {
+		return nil, fmt.Errorf("hades: the trader is required")
+	}
+	if trader := hades.traderByID(*req.TraderID); trader != nil {
+		return trader, nil
+	}
+
+	return nil, fmt.Errorf("hades: unknown trader %d", *req.TraderID)
+}
+
+// tradersOf returns the trader of the request or all the traders if no one
+// is specified, the mutex has to be locked
+func (hades *Hades) tradersOf(req *AdminRequest) ([]hermes.Int, error) {
+	if req.TraderID == nil {
+		return hades.traders, nil
+	}
+	trader, err := hades.getTrader(req)
+	if err != nil {
+		return nil, err
+	}
+
+	return []hermes.Int{trader}, nil
+}
+
+func (hades *Hades) forceTrader(req *AdminRequest, play bool) (string, error) {
+	hades.mutex.Lock()
+	defer hades.mutex.Unlock()
+
+	trader, err := hades.getTrader(req)
+	if err != nil {
+		return "", err
+	}
+	hades.forced[trader.GetID()] = play
+	if play {
+		return fmt.Sprintf("trader %d forced to play", trader.GetID()), nil
+	}
+
+	// the trader stops playing as soon as its positions are closed
+	if trader.StopPlaying() {
+		delete(hades.tradersPlaying, trader.GetID())
+		return fmt.Sprintf("trader %d stopped", trader.GetID()), nil
+	}
+
+	return fmt.Sprintf("trader %d will stop after closing its positions", trader.GetID()), nil
+}
+
+func (hades *Hades) adminStartTrader(req *AdminRequest) (string, error) {
+	return hades.forceTrader(req, true)
+}
+
+func (hades *Hades) adminStopTrader(req *AdminRequest) (string, error) {
+	return hades.forceTrader(req, false)
+}
+
+// adminReleaseTrader returns the control of the trader to the selection
+// policy
+func (hades *Hades) adminReleaseTrader(req *AdminRequest) (string, error) {
+	hades.mutex.Lock()
+	defer hades.mutex.Unlock()
+
+	trader, err := hades.getTrader(req)
+	if err != nil {
+		return "", err
+	}
+	delete(hades.forced, trader.GetID())
+
+	return fmt.Sprintf("trader %d managed by the selection policy", trader.GetID()), nil
+}
+
+func (hades *Hades) adminTradersThatCanPlay(req *AdminRequest) (string, error) {
+	if req.Value < 0 {
+		return "", fmt.Errorf("hades: the traders that can play can't be negative")
+	}
+
+	hades.mutex.Lock()
+	defer hades.mutex.Unlock()
+
+	previous := hades.tradesThatCanPlay
+	hades.tradesThatCanPlay = req.Value
+
+	return fmt.Sprintf("traders that can play changed from %d to %d", previous, req.Value), nil
+}
+
+func (hades *Hades) adminRiskLimits(req *AdminRequest) (string, error) {
+	if req.Risk == nil {
+		return "", fmt.Errorf("hades: the risk limits are required")
+	}
+
+	hades.mutex.Lock()
+	defer hades.mutex.Unlock()
+
+	traders, err := hades.tradersOf(req)
+	if err != nil {
+		return "", err
+	}
+	for _, trader := range traders {
+		trader.SetRiskLimits(*req.Risk)
+	}
+
+	return fmt.Sprintf("risk limits of %d traders changed", len(traders)), nil
+}
+
+func (hades *Hades) adminResetRisk(req *AdminRequest) (string, error) {
+	hades.mutex.Lock()
+	defer hades.mutex.Unlock()
+
+	traders, err := hades.tradersOf(req)
+	if err != nil {
+		return "", err
+	}
+	for _, trader := range traders {
+		trader.ResetRisk()
+	}
+
+	return fmt.Sprintf("risk state of %d traders reset", len(traders)), nil
+}
+
+func (hades *Hades) adminCloseOrder(req *AdminRequest) (string, error) {
+	hades.mutex.Lock()
+	defer hades.mutex.Unlock()
+
+	traders, err := hades.tradersOf(req)
+	if err != nil {
+		return "", err
+	}
+	for _, trader := range traders {
+		found, err := trader.CloseOrder(req.OrderID)
+		if found {
+			if err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("order %d of the trader %d closed", req.OrderID, trader.GetID()), nil
+		}
+	}
+
+	return "", fmt.Errorf("hades: the order %d is not open", req.OrderID)
+}
+
+// adminCloseAll closes all the positions of the trader of the request or of
+// all the traders
+func (hades *Hades) adminCloseAll(req *AdminRequest) (string, error) {
+	hades.mutex.Lock()
+	defer hades.mutex.Unlock()
+
+	traders, err := hades.tradersOf(req)
+	if err != nil {
+		return "", err
+	}
+
+	total := 0
+	for _, trader := range traders {
+		closed, closeErr := trader.CloseAllPositions(hermes.CloseManual)
+		total += closed
+		if closeErr != nil {
+			err = closeErr
+		}
+	}
+
+	return fmt.Sprintf("%d positions closed", total), err
+}
+
+func (hades *Hades) setPaused(req *AdminRequest, paused bool) (string, error) {
+	if req.Curr == "" {
+		return "", fmt.Errorf("hades: the currency is required")
+	}
+
+	hades.mutex.Lock()
+	defer hades.mutex.Unlock()
+
+	if paused {
+		hades.paused[req.Curr] = true
+	} else {
+		delete(hades.paused, req.Curr)
+	}
+	hades.updatePaused(req.Curr)
+
+	if paused {
+		return fmt.Sprintf("new entries on %s paused", req.Curr), nil
+	}
+	return fmt.Sprintf("new entries on %s resumed", req.Curr), nil
+}
+
+func (hades *Hades) adminPause(req *AdminRequest) (string, error) {
+	return hades.setPaused(req, true)
+}
+
+func (hades *Hades) adminResume(req *AdminRequest) (string, error) {
+	return hades.setPaused(req, false)
+}
+
+// adminTripBreaker is the kill switch, the breaker is tripped manually
+func (hades *Hades) adminTripBreaker(req *AdminRequest) (string, error) {
+	if hades.breaker == nil {
+		return "", fmt.Errorf("hades: the circuit breaker is not enabled")
+	}
+	if hades.breaker.IsTripped() {
+		return "", fmt.Errorf("hades: the circuit breaker is already tripped")
+	}
+	hades.breaker.Trip()
+
+	return "circuit breaker tripped", nil
+}
+
+func (hades *Hades) adminResetBreaker(req *AdminRequest) (string, error) {
+	if hades.breaker == nil {
+		return "", fmt.Errorf("hades: the circuit breaker is not enabled")
+	}
+	state := hades.breaker.GetState()
+	if !state.Tripped {
+		return "", fmt.Errorf("hades: the circuit breaker is not tripped")
+	}
+	hades.breaker.Reset()
+
+	return fmt.Sprintf("circuit breaker reset, it was tripped by: %s", state.Reason), nil
+}
@@ -0,0 +1,132 @@
+package hades
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/alonsovidales/v/hermes"
+)
+
+func (tt *traderTest) GetRiskState() hermes.RiskState {
+	return hermes.RiskState{State: hermes.TraderActive}
+}
+
+func (tt *traderTest) IsPlaying() bool {
+	return tt.playing
+}
+
+func (tt *traderTest) StartPlaying() {
+	tt.playing = true
+}
+
+func (tt *traderTest) StopPlaying() bool {
+	if len(tt.open) > 0 {
+		return false
+	}
+	tt.playing = false
+	return true
+}
+
+func (tt *traderTest) SetPaused(curr string, paused bool) {
+	if tt.paused == nil {
+		tt.paused = make(map[string]bool)
+	}
+	tt.paused[curr] = paused
+}
+
+func TestAdminAPI(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hades-admin")
+	if err != nil {
+		t.Fatal("Problem creating the temp dir:", err)
+	}
+	defer os.RemoveAll(dir)
+
+	selection, _ := GetSelectionPolicy(&SelectionConf{Policy: SelectionGreedy, Window: 3, MinOps: 3})
+	hades := &Hades{
+		traders:           getTradersTest(),
+		tradesThatCanPlay: 0,
+		tradersPlaying:    make(map[int]hermes.Int),
+		selection:         selection,
+		forced:            make(map[int]bool),
+		paused:            make(map[string]bool),
+	}
+	auditFile := filepath.Join(dir, "audit.log")
+	if hades.auditor, err = getAuditor(auditFile); err != nil {
+		t.Fatal("Problem opening the audit file:", err)
+	}
+	server := httptest.NewServer(hades.adminHandler("secret"))
+	defer server.Close()
+
+	call := func(token, path, body string) int {
+		req, _ := http.NewRequest(http.MethodPost, server.URL+path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal("Problem calling the admin API:", err)
+		}
+		resp.Body.Close()
+
+		return resp.StatusCode
+	}
+
+	if status := call("wrong", "/admin/traders/start", `{"trader": 3}`); status != http.StatusUnauthorized {
+		t.Error("The requests without the token should be rejected, status:", status)
+	}
+	if status := call("secret", "/admin/traders/start", `{"trader": 3}`); status != http.StatusOK {
+		t.Error("The trader should be forced to play, status:", status)
+	}
+	if status := call("secret", "/admin/traders/stop", `{"trader": 1}`); status != http.StatusOK {
+		t.Error("The trader should be forced to stop, status:", status)
+	}
+	if status := call("secret", "/admin/traders/start", `{"trader": 10}`); status != http.StatusBadRequest {
+		t.Error("Unknown traders should be rejected, status:", status)
+	}
+	if status := call("secret", "/admin/currencies/pause", `{"curr": "EUR"}`); status != http.StatusOK {
+		t.Error("The currency should be paused, status:", status)
+	}
+
+	hades.selectTraders()
+	if !hades.traders[3].IsPlaying() || hades.traders[1].IsPlaying() || len(hades.tradersPlaying) != 1 {
+		t.Error("Only the forced trader should be playing, playing:", hades.tradersPlaying)
+	}
+	if !hades.traders[0].(*traderTest).paused["EUR"] {
+		t.Error("The currency should be paused on all the traders")
+	}
+
+	call("secret", "/admin/traders/release", `{"trader": 1}`)
+	call("secret", "/admin/traders-that-can-play", `{"value": 2}`)
+	hades.selectTraders()
+	if !hades.traders[1].IsPlaying() {
+		t.Error("The released trader should be chosen by the selection policy")
+	}
+
+	hades.auditor.close()
+	f, err := os.Open(auditFile)
+	if err != nil {
+		t.Fatal("Problem opening the audit file:", err)
+	}
+	defer f.Close()
+
+	var entries []*AuditEntry
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		entry := &AuditEntry{}
+		if err = json.Unmarshal(scanner.Bytes(), entry); err != nil {
+			t.Fatal("Invalid audit entry:", err)
+		}
+		entries = append(entries, entry)
+	}
+	if len(entries) != 6 {
+		t.Fatal("All the changes should be audited, entries:", len(entries))
+	}
+	if entries[2].Action != "traders/start" || entries[2].Error == "" || *entries[2].Request.TraderID != 10 {
+		t.Error("Unexpected audit entry for the failed change:", entries[2])
+	}
+}
@@ -0,0 +1,377 @@
+package hades
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/alonsovidales/v/hermes"
+	"github.com/alonsovidales/v/philoctetes"
+)
+
+const (
+	AllocationRiskParity        = "risk-parity"
+	AllocationScore             = "score"
+	AllocationInverseVolatility = "inverse-volatility"
+
+	// riskParityIterations is the number of iterations used to find the
+	// weights with the same risk contribution
+	riskParityIterations = 100
+
+	// minTraderShare is the ratio of the equal share of the budget that each
+	// playing trader receives at least, a trader without capital can't open
+	// positions and its score would never change
+	minTraderShare = 0.1
+)
+
+// AllocationConf defines how the capital Budget, on the account currency, is
+// distributed across the playing traders. The score scheme weights the
+// traders by the profit of their last Window ops, the inverse volatility one
+// by the inverse of the volatility of the profits of these ops and the risk
+// parity one gives the same contribution to the risk to each trader using the
+// covariance of the returns of their currencies during the last VolWindowSecs
+// resampled on VolSamples points. The capital of a trader is limited to
+// MaxTraderRatio of the budget and to MaxTraderCapital, the excess is
+// distributed across the other traders. Each trader receives a min part of
+// the budget even if its weight is zero
+type AllocationConf struct {
+	Scheme           string
+	Budget           float64
+	MaxTraderRatio   float64
+	MaxTraderCapital float64
+	Window           int
+	VolWindowSecs    int
+	VolSamples       int
+}
+
+// Validate checks that the scheme is known and the budget and caps are
+// consistent
+func (conf *AllocationConf) Validate() error {
+	switch conf.Scheme {
+	case AllocationRiskParity:
+		if conf.VolWindowSecs <= 0 || conf.VolSamples < 3 {
+			return fmt.Errorf("hades: the risk parity allocation requires a positive window and at least three samples")
+		}
+	case AllocationScore, AllocationInverseVolatility:
+	default:
+		return fmt.Errorf("hades: unknown allocation scheme: %s", conf.Scheme)
+	}
+	if conf.Budget <= 0 {
+		return fmt.Errorf("hades: the allocation budget has to be positive")
+	}
+	if conf.MaxTraderRatio < 0 || conf.MaxTraderRatio > 1 || conf.MaxTraderCapital < 0 {
+		return fmt.Errorf("hades: invalid allocation caps")
+	}
+
+	return nil
+}
+
+// allocate returns the capital of each one of the traders, the mutex has to
+// be locked
+func (hades *Hades) allocate(traders []hermes.Int) (capital map[int]float64) {
+	conf := hades.allocation
+	capital = make(map[int]float64)
+	if len(traders) == 0 {
+		return
+	}
+
+	var weights []float64
+	switch conf.Scheme {
+	case AllocationScore:
+		weights = scoreWeights(traders, conf.Window)
+	case AllocationInverseVolatility:
+		weights = inverseVolWeights(traders, conf.Window)
+	case AllocationRiskParity:
+		weights = hades.riskParityWeights(traders)
+	}
+
+	max := conf.Budget
+	if conf.MaxTraderRatio > 0 {
+		max = math.Min(max, conf.MaxTraderRatio*conf.Budget)
+	}
+	if conf.MaxTraderCapital > 0 {
+		max = math.Min(max, conf.MaxTraderCapital)
+	}
+	n := float64(len(traders))
+	min := math.Min(minTraderShare*conf.Budget/n, max)
+	for i, c := range capWeights(weights, conf.Budget-min*n, max-min) {
+		capital[traders[i].GetID()] = min + c
+	}
+
+	return
+}
+
+// normalize returns the weights divided by their sum, equal weights if all of
+// them are zero
+func normalize(weights []float64) []float64 {
+	sum := 0.0
+	for _, w := range weights {
+		sum += w
+	}
+	for i := range weights {
+		if sum > 0 {
+			weights[i] /= sum
+		} else {
+			weights[i] = 1 / float64(len(weights))
+		}
+	}
+
+	return weights
+}
+
+// capWeights distributes the budget proportionally to the weights limiting
+// each part to max, the excess of the capped parts is distributed across the
+// others until all of them are capped
+func capWeights(weights []float64, budget, max float64) (capital []float64) {
+	weights = normalize(weights)
+	capital = make([]float64, len(weights))
+	capped := make([]bool, len(weights))
+
+	remaining := budget
+	for remaining > 1e-9 {
+		free := 0.0
+		for i, w := range weights {
+			if !capped[i] {
+				free += w
+			}
+		}
+		if free == 0 {
+			break
+		}
+
+		distributed := 0.0
+		for i, w := range weights {
+			if capped[i] {
+				continue
+			}
+			part := remaining * w / free
+			if capital[i]+part >= max {
+				part = max - capital[i]
+				capped[i] = true
+			}
+			capital[i] += part
+			distributed += part
+		}
+		if distributed <= 1e-9 {
+			break
+		}
+		remaining -= distributed
+	}
+
+	return
+}
+
+// scoreWeights weights the traders by the profit of their last ops
+func scoreWeights(traders []hermes.Int, window int) (weights []float64) {
+	for _, trader := range traders {
+		weights = append(weights, math.Max(trader.GetScore(window)-1, 0))
+	}
+
+	return
+}
+
+// inverseVolWeights weights the traders by the inverse of the volatility of
+// the profits of their last ops, the traders without volatility take the min
+// one of the others
+func inverseVolWeights(traders []hermes.Int, window int) (weights []float64) {
+	vols := make([]float64, len(traders))
+	minVol := math.Inf(1)
+	for i, trader := range traders {
+		vols[i] = stdDev(trader.GetLastProfits(window))
+		if vols[i] > 0 && vols[i] < minVol {
+			minVol = vols[i]
+		}
+	}
+
+	for _, vol := range vols {
+		switch {
+		case vol > 0:
+			weights = append(weights, 1/vol)
+		case !math.IsInf(minVol, 1):
+			weights = append(weights, 1/minVol)
+		default:
+			weights = append(weights, 1)
+		}
+	}
+
+	return
+}
+
+func stdDev(values []float64) float64 {
+	if len(values) < 2 {
+		return 0
+	}
+
+	mean := 0.0
+	for _, v := range values {
+		mean += v
+	}
+	mean /= float64(len(values))
+
+	sumSq := 0.0
+	for _, v := range values {
+		sumSq += (v - mean) * (v - mean)
+	}
+
+	return math.Sqrt(sumSq / float64(len(values)-1))
+}
+
+// riskParityWeights returns the weights that give the same contribution to
+// the risk of the traders, the risk is measured using the covariance of the
+// returns of the currency of each trader. Equal weights are used if the
+// currencies don't have enough history
+func (hades *Hades) riskParityWeights(traders []hermes.Int) (weights []float64) {
+	currVals := hades.collector.GetAllCurrVals()
+	var to int64
+	for _, vals := range currVals {
+		if len(vals) > 0 && vals[len(vals)-1].Ts > to {
+			to = vals[len(vals)-1].Ts
+		}
+	}
+	from := to - int64(hades.allocation.VolWindowSecs)*tsMultToSecs
+
+	returns := make([][]float64, len(traders))
+	byCurr := make(map[string][]float64)
+	for i, trader := range traders {
+		curr := trader.GetCurrencies()[0]
+		if _, ok := byCurr[curr]; !ok {
+			r, ok := philoctetes.Returns(currVals[curr], from, to, hades.allocation.VolSamples)
+			if !ok {
+				return normalize(make([]float64, len(traders)))
+			}
+			byCurr[curr] = r
+		}
+		returns[i] = byCurr[curr]
+	}
+
+	return riskParity(covariance(returns))
+}
+
+// covariance returns the covariance matrix of the series
+func covariance(series [][]float64) (cov [][]float64) {
+	means := make([]float64, len(series))
+	for i, s := range series {
+		for _, v := range s {
+			means[i] += v
+		}
+		means[i] /= float64(len(s))
+	}
+
+	cov = make([][]float64, len(series))
+	for i := range series {
+		cov[i] = make([]float64, len(series))
+		for j := range series {
+			for k := range series[i] {
+				cov[i][j] += (series[i][k] - means[i]) * (series[j][k] - means[j])
+			}
+			cov[i][j] /= float64(len(series[i]) - 1)
+		}
+	}
+
+	return
+}
+
+// riskParity returns the weights with the same risk contribution, w_i * (C w)_i,
+// using a damped fixed point iteration. The assets without variance take
+// the weight of the less volatile of the others
+func riskParity(cov [][]float64) (weights []float64) {
+	n := len(cov)
+	minVar := math.Inf(1)
+	for i := range cov {
+		if cov[i][i] > 0 && cov[i][i] < minVar {
+			minVar = cov[i][i]
+		}
+	}
+	if math.IsInf(minVar, 1) {
+		return normalize(make([]float64, n))
+	}
+	for i := range cov {
+		if cov[i][i] <= 0 {
+			cov[i][i] = minVar
+		}
+	}
+
+	weights = make([]float64, n)
+	for i := range weights {
+		weights[i] = 1 / math.Sqrt(cov[i][i])
+	}
+	weights = normalize(weights)
+
+	for it := 0; it < riskParityIterations; it++ {
+		next := make([]float64, n)
+		for i := range cov {
+			marginal := 0.0
+			for j := range cov {
+				marginal += cov[i][j] * weights[j]
+			}
+			if marginal <= 0 {
+				next[i] = weights[i]
+				continue
+			}
+			// the geometric mean with the previous weight damps the
+			// oscillations
+			next[i] = math.Sqrt(weights[i] / marginal)
+		}
+		weights = normalize(next)
+	}
+
+	return
+}
+
+// rebalance allocates the capital across the playing traders and passes it
+// to their sizing, the traders that stopped playing are released. The mutex
+// has to be locked
+func (hades *Hades) rebalance() {
+	playing := []hermes.Int{}
+	for _, trader := range hades.tradersPlaying {
+		playing = append(playing, trader)
+	}
+	sort.Slice(playing, func(i, j int) bool { return playing[i].GetID() < playing[j].GetID() })
+
+	capital := hades.allocate(playing)
+	for id := range hades.allocations {
+		if _, ok := capital[id]; !ok {
+			if trader := hades.traderByID(id); trader != nil {
+				trader.SetAllocation(hermes.NoAllocation)
+			}
+			traderAllocation.Set(0, fmt.Sprint(id))
+		}
+	}
+	for _, trader := range playing {
+		if allocated, ok := hades.allocations[trader.GetID()]; !ok || allocated != capital[trader.GetID()] {
+			trader.SetAllocation(capital[trader.GetID()])
+			traderAllocation.Set(capital[trader.GetID()], fmt.Sprint(trader.GetID()))
+		}
+	}
+	hades.allocations = capital
+}
+
+// traderByID returns the trader with the given ID, nil if it is not managed,
+// the mutex has to be locked
+func (hades *Hades) traderByID(id int) hermes.Int {
+	for _, trader := range hades.traders {
+		if trader.GetID() == id {
+			return trader
+		}
+	}
+
+	return nil
+}
+
+// GetAllocations returns the capital allocated to each playing trader, nil if
+// the capital is not allocated
+func (hades *Hades) GetAllocations() map[int]float64 {
+	if hades.allocation == nil {
+		return nil
+	}
+
+	hades.mutex.Lock()
+	defer hades.mutex.Unlock()
+
+	allocations := make(map[int]float64)
+	for id, capital := range hades.allocations {
+		allocations[id] = capital
+	}
+
+	return allocations
+}
@@ -0,0 +1,107 @@
+package hades
+
+import (
+	"math"
+	"testing"
+
+	"github.com/alonsovidales/v/hermes"
+)
+
+func (tt *traderTest) SetAllocation(capital float64) {
+	tt.allocation = capital
+}
+
+func (tt *traderTest) GetCurrencies() []string {
+	return []string{"EUR"}
+}
+
+func TestRiskParity(t *testing.T) {
+	weights := riskParity([][]float64{{4, 0}, {0, 1}})
+	if math.Abs(weights[0]-1.0/3) > 1e-6 || math.Abs(weights[1]-2.0/3) > 1e-6 {
+		t.Error("The weights should be proportional to the inverse of the volatility:", weights)
+	}
+
+	cov := [][]float64{{4, 1, 0}, {1, 1, -0.2}, {0, -0.2, 2}}
+	weights = riskParity(cov)
+	contributions := make([]float64, len(cov))
+	for i := range cov {
+		for j := range cov {
+			contributions[i] += weights[i] * cov[i][j] * weights[j]
+		}
+	}
+	for i := range contributions {
+		if math.Abs(contributions[i]-contributions[0]) > 1e-6 {
+			t.Error("All the risk contributions should be the same:", contributions, "Weights:", weights)
+		}
+	}
+}
+
+func TestCapWeights(t *testing.T) {
+	capital := capWeights([]float64{6, 3, 1}, 1000, 400)
+	if math.Abs(capital[0]-400) > 1e-6 || math.Abs(capital[1]-400) > 1e-6 || math.Abs(capital[2]-200) > 1e-6 {
+		t.Error("The excess of the capped traders should be distributed across the others:", capital)
+	}
+
+	capital = capWeights([]float64{1, 1}, 1000, 300)
+	if capital[0] != 300 || capital[1] != 300 {
+		t.Error("The capital over the caps should not be allocated:", capital)
+	}
+}
+
+func TestAllocation(t *testing.T) {
+	traders := getTradersTest()
+	hades := &Hades{
+		traders:        traders,
+		collector:      &collectorTest{},
+		tradersPlaying: make(map[int]hermes.Int),
+		allocations:    make(map[int]float64),
+		allocation: &AllocationConf{
+			Scheme:         AllocationScore,
+			Budget:         1000,
+			MaxTraderRatio: 0.8,
+			Window:         3,
+		},
+	}
+	for _, trader := range traders[:2] {
+		hades.tradersPlaying[trader.GetID()] = trader
+	}
+
+	hades.rebalance()
+	// the score of the last three ops is 1.157625 for the first trader and
+	// 1.030301 for the second one, the first is capped to 800
+	if a0, a1 := traders[0].(*traderTest).allocation, traders[1].(*traderTest).allocation; math.Abs(a0-800) > 1e-6 || math.Abs(a1-200) > 1e-6 {
+		t.Error("The capital should be allocated by score with the cap applied:", a0, a1)
+	}
+
+	// the losing trader has no weight but keeps the min capital, the rest
+	// of the budget is distributed by score
+	hades.tradersPlaying[3] = traders[3]
+	hades.rebalance()
+	allocations := hades.GetAllocations()
+	if a3 := allocations[3]; math.Abs(a3-100.0/3) > 1e-6 {
+		t.Error("The trader without weight should receive the min capital:", a3)
+	}
+	if sum := allocations[0] + allocations[1] + allocations[3]; math.Abs(sum-1000) > 1e-6 || allocations[0] <= allocations[1] {
+		t.Error("The budget should be distributed by score:", allocations)
+	}
+
+	hades.allocation.Scheme = AllocationInverseVolatility
+	delete(hades.tradersPlaying, 1)
+	hades.rebalance()
+	if traders[1].(*traderTest).allocation != hermes.NoAllocation {
+		t.Error("The allocation of the stopped trader should be released:", traders[1].(*traderTest).allocation)
+	}
+	// the last ops of both traders have the same profit, without volatility
+	// both get the same capital
+	if allocations := hades.GetAllocations(); len(allocations) != 2 || math.Abs(allocations[0]-500) > 1e-6 || math.Abs(allocations[3]-500) > 1e-6 {
+		t.Error("The capital should be allocated by the inverse of the volatility:", allocations)
+	}
+
+	hades.allocation.Scheme = AllocationRiskParity
+	hades.allocation.VolWindowSecs = 60
+	hades.allocation.VolSamples = 10
+	hades.rebalance()
+	if allocations := hades.GetAllocations(); math.Abs(allocations[0]-500) > 1e-6 || math.Abs(allocations[3]-500) > 1e-6 {
+		t.Error("Equal weights are expected without history of the currencies:", allocations)
+	}
+}
@@ -0,0 +1,70 @@
+package hades
+
+import (
+	"github.com/alonsovidales/pit/log"
+	"github.com/alonsovidales/v/hermes"
+)
+
+// BookConf identifies a book when several of them run on the same process,
+// each book has its own collector, trainer, traders and config. The IDs of
+// the traders of the book start on FirstTraderID in order to be unique
+// across the books, it has to be a multiple of the number of trainers to
+// keep the boundaries encoded on the IDs
+type BookConf struct {
+	Name          string
+	FirstTraderID int
+}
+
+// BookStatus is the state of the traders of a book and their results on the
+// account currency, Equity is only available if the collector provides the
+// state of the account
+type BookStatus struct {
+	Name          string        `json:"name"`
+	Traders       int           `json:"traders"`
+	Playing       int           `json:"playing"`
+	OpenPositions int           `json:"open_positions"`
+	SimulatedOps  int           `json:"simulated_ops"`
+	SimulatedPl   float64       `json:"simulated_pl"`
+	LiveOps       int           `json:"live_ops"`
+	LivePl        float64       `json:"live_pl"`
+	Equity        float64       `json:"equity,omitempty"`
+	Breaker       *BreakerState `json:"breaker,omitempty"`
+}
+
+// firstTraderID returns the ID of the first trader launched
+func (hades *Hades) firstTraderID() int {
+	return hades.book.FirstTraderID
+}
+
+// GetStatus returns the state and the results of the book, the results are
+// exported as metrics
+func (hades *Hades) GetStatus() (status *BookStatus) {
+	hades.mutex.Lock()
+	status = &BookStatus{
+		Name:    hades.book.Name,
+		Traders: len(hades.traders),
+		Playing: len(hades.tradersPlaying),
+	}
+	traders := append([]hermes.Int{}, hades.traders...)
+	hades.mutex.Unlock()
+
+	for _, trader := range traders {
+		status.OpenPositions += len(trader.GetOpenOrders())
+		rec := trader.Reconcile()
+		status.SimulatedOps += rec.Simulated.Ops
+		status.SimulatedPl += rec.Simulated.Pl
+		status.LiveOps += rec.Live.Ops
+		status.LivePl += rec.Live.Pl
+	}
+	if hades.account != nil {
+		equity, err := hades.account.GetEquity()
+		if err != nil {
+			log.Error("The equity of the book:", hades.book.Name, "can't be retrieved, Error:", err)
+		}
+		status.Equity = equity
+	}
+	status.Breaker = hades.GetBreakerState()
+	hades.exportStatus(status)
+
+	return
+}
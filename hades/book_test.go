@@ -0,0 +1,43 @@
+package hades
+
+import (
+	"testing"
+
+	"github.com/alonsovidales/v/charont"
+	"github.com/alonsovidales/v/hermes"
+)
+
+func TestBookTraderIDs(t *testing.T) {
+	hades := getEvolutionTest(t, "")
+	hades.book = BookConf{Name: "majors", FirstTraderID: 200}
+	if err := hades.launchGroups(); err != nil {
+		t.Fatal("The traders can't be launched:", err)
+	}
+
+	if len(hades.traders) != 2 || hades.traders[0].GetID() != 200 || hades.traders[1].GetID() != 201 || hades.evolution.nextID != 202 {
+		t.Fatal("The IDs of the traders should start on the first ID of the book, next ID:", hades.evolution.nextID)
+	}
+	if genome := hades.evolution.members[201].Genome; genome[GeneEntry] != 0.1 || genome[GeneExit] != 0 {
+		t.Error("The boundaries shouldn't depend on the book:", genome)
+	}
+}
+
+func TestBookStatus(t *testing.T) {
+	traders := getTradersTest()
+	traders[0].(*traderTest).livePl = 10
+	traders[1].(*traderTest).livePl = -4
+	traders[1].(*traderTest).open = []*charont.Order{{Id: 1}}
+	hades := &Hades{
+		book:           BookConf{Name: "majors"},
+		traders:        traders,
+		tradersPlaying: map[int]hermes.Int{1: traders[1]},
+	}
+
+	status := hades.GetStatus()
+	if status.Name != "majors" || status.Traders != 4 || status.Playing != 1 || status.OpenPositions != 1 {
+		t.Error("Unexpected state of the book:", status)
+	}
+	if status.LiveOps != 18 || status.LivePl != 6 || status.Breaker != nil {
+		t.Error("The results of the traders should be aggregated:", status)
+	}
+}
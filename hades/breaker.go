@@ -0,0 +1,464 @@
+package hades
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/alonsovidales/pit/log"
+	"github.com/alonsovidales/v/charont"
+	"github.com/alonsovidales/v/hermes"
+)
+
+const (
+	BreakerDailyLoss         = "daily-loss"
+	BreakerDrawdown          = "drawdown"
+	BreakerConsecutiveLosses = "consecutive-losses"
+	BreakerErrorRate         = "broker-error-rate"
+	BreakerStaleFeed         = "stale-feed"
+	BreakerManual            = "manual"
+
+	defaultBreakerCheckSecs       = 5
+	defaultBreakerErrorWindowSecs = 300
+	defaultBreakerMinRequests     = 10
+)
+
+// ErrBreakerTripped is returned for the new real orders while the breaker is
+// tripped
+var ErrBreakerTripped = fmt.Errorf("hades: the circuit breaker is tripped")
+
+// ErrNoOrder is returned when the broker doesn't return the order placed
+var ErrNoOrder = fmt.Errorf("hades: the broker didn't return the order")
+
+// BreakerConf defines the conditions that trip the circuit breaker, all of
+// them are disabled with the zero value. MaxDailyLoss is in the account
+// currency and applies to the real ops closed since the start of the UTC day
+// of the feed, MaxDrawdown is the ratio of the equity peak, only available if
+// the broker provides the equity, and MaxErrorRate is the ratio of failed
+// requests to the broker during the last ErrorWindowSecs of the feed with at
+// least MinRequests. Flatten
+// closes all the open positions when the breaker trips. The breaker is tripped
+// while TripFile exists, it is created when the breaker trips and removed on
+// reset
+type BreakerConf struct {
+	MaxDailyLoss         float64
+	MaxDrawdown          float64
+	MaxConsecutiveLosses int
+	MaxErrorRate         float64
+	ErrorWindowSecs      int
+	MinRequests          int
+	MaxFeedStaleSecs     int
+	Flatten              bool
+	TripFile             string
+	CheckSecs            int
+}
+
+// BreakerState is the state of the circuit breaker and the values of the
+// monitored conditions
+type BreakerState struct {
+	Tripped           bool    `json:"tripped"`
+	Reason            string  `json:"reason,omitempty"`
+	TrippedAt         int64   `json:"tripped_at,omitempty"`
+	DailyPl           float64 `json:"daily_pl"`
+	Equity            float64 `json:"equity"`
+	EquityPeak        float64 `json:"equity_peak"`
+	ConsecutiveLosses int     `json:"consecutive_losses"`
+	Requests          int     `json:"requests"`
+	Errors            int     `json:"errors"`
+}
+
+type brokerRequest struct {
+	at     time.Time
+	failed bool
+}
+
+// Breaker wraps the collector used by the traders, monitors the real ops and
+// the requests to the broker and rejects the new real orders while it is
+// tripped, the orders can always be closed
+type Breaker struct {
+	charont.Int
+
+	mutex    sync.Mutex
+	conf     BreakerConf
+	account  charont.AccountInt
+	state    BreakerState
+	day      string
+	requests []brokerRequest
+	// lastTs and lastTickAt contain the last tick of each currency and when
+	// it was received
+	lastTs     map[string]int64
+	lastTickAt map[string]time.Time
+	// fileSeen is true if the trip file existed on the last check
+	fileSeen bool
+	onTrip   func(reason string)
+	onReset  func()
+}
+
+// Validate checks that the conditions are consistent
+func (conf *BreakerConf) Validate() error {
+	if conf.MaxDailyLoss < 0 || conf.MaxDrawdown < 0 || conf.MaxErrorRate < 0 {
+		return fmt.Errorf("hades: the breaker limits can't be negative")
+	}
+	if conf.MaxDrawdown >= 1 || conf.MaxErrorRate > 1 {
+		return fmt.Errorf("hades: the breaker drawdown and error rate are ratios")
+	}
+
+	return nil
+}
+
+// GetBreaker returns a breaker over the collector, the ones that already
+// existed are tripped if the trip file exists
+func GetBreaker(collector charont.Int, conf *BreakerConf) (br *Breaker) {
+	br = &Breaker{
+		Int:        collector,
+		conf:       *conf,
+		lastTs:     make(map[string]int64),
+		lastTickAt: make(map[string]time.Time),
+	}
+	if br.conf.CheckSecs <= 0 {
+		br.conf.CheckSecs = defaultBreakerCheckSecs
+	}
+	if br.conf.ErrorWindowSecs <= 0 {
+		br.conf.ErrorWindowSecs = defaultBreakerErrorWindowSecs
+	}
+	if br.conf.MinRequests <= 0 {
+		br.conf.MinRequests = defaultBreakerMinRequests
+	}
+	if account, ok := collector.(charont.AccountInt); ok {
+		br.account = account
+	} else if br.conf.MaxDrawdown > 0 {
+		log.Error("The collector doesn't provide the equity, the breaker drawdown is disabled")
+	}
+
+	if br.conf.TripFile != "" {
+		if b, err := ioutil.ReadFile(br.conf.TripFile); err == nil {
+			state := &BreakerState{}
+			if json.Unmarshal(b, state) != nil || state.Reason == "" {
+				state.Reason = BreakerManual
+			}
+			br.fileSeen = true
+			br.state.Tripped = true
+			br.state.Reason = state.Reason
+			br.state.TrippedAt = state.TrippedAt
+			log.Info("Circuit breaker tripped on startup, Reason:", br.state.Reason, "File:", br.conf.TripFile)
+		}
+	}
+
+	return
+}
+
+func (br *Breaker) Buy(currency string, units int, bound float64, realOps bool, ts int64) (order *charont.Order, err error) {
+	if realOps && br.IsTripped() {
+		return nil, ErrBreakerTripped
+	}
+	order, err = br.Int.Buy(currency, units, bound, realOps, ts)
+	if err == nil && order == nil {
+		err = ErrNoOrder
+	}
+	if realOps {
+		br.requestDone(err, tsTime(ts))
+	}
+
+	return
+}
+
+func (br *Breaker) Sell(currency string, units int, bound float64, realOps bool, ts int64) (order *charont.Order, err error) {
+	if realOps && br.IsTripped() {
+		return nil, ErrBreakerTripped
+	}
+	order, err = br.Int.Sell(currency, units, bound, realOps, ts)
+	if err == nil && order == nil {
+		err = ErrNoOrder
+	}
+	if realOps {
+		br.requestDone(err, tsTime(ts))
+	}
+
+	return
+}
+
+func (br *Breaker) CloseOrder(ord *charont.Order, ts int64) (err error) {
+	err = br.Int.CloseOrder(ord, ts)
+	if ord.Real {
+		if err != nil {
+			br.requestDone(err, tsTime(ts))
+		} else {
+			br.requestDone(err, tsTime(ord.SellTs))
+			br.opClosed(ord.Pl, tsTime(ord.SellTs))
+		}
+	}
+
+	return
+}
+
+// IsTripped returns true if the new real orders are rejected
+func (br *Breaker) IsTripped() bool {
+	br.mutex.Lock()
+	defer br.mutex.Unlock()
+
+	return br.state.Tripped
+}
+
+// GetState returns the state of the breaker
+func (br *Breaker) GetState() BreakerState {
+	br.mutex.Lock()
+	defer br.mutex.Unlock()
+
+	return br.state
+}
+
+// tsTime returns the time of a tick timestamp, the daily loss and the error
+// rate are measured on the time of the feed so the replays behave as the live
+// trading, the current time is used if the timestamp is unknown
+func tsTime(ts int64) time.Time {
+	if ts == 0 {
+		return time.Now()
+	}
+
+	return time.Unix(ts/tsMultToSecs, ts%tsMultToSecs)
+}
+
+// requestDone records the result of a request to the broker done at the given
+// time and trips the breaker if the error rate is over the limit
+func (br *Breaker) requestDone(err error, now time.Time) {
+	br.mutex.Lock()
+	defer br.mutex.Unlock()
+
+	br.requests = append(br.requests, brokerRequest{at: now, failed: err != nil})
+	br.pruneRequests(now)
+
+	if br.conf.MaxErrorRate > 0 && br.state.Requests >= br.conf.MinRequests &&
+		float64(br.state.Errors)/float64(br.state.Requests) >= br.conf.MaxErrorRate {
+		br.trip(BreakerErrorRate, now)
+	}
+}
+
+// pruneRequests removes the requests out of the window, the mutex has to be
+// locked
+func (br *Breaker) pruneRequests(now time.Time) {
+	from := now.Add(-time.Duration(br.conf.ErrorWindowSecs) * time.Second)
+	for len(br.requests) > 0 && br.requests[0].at.Before(from) {
+		br.requests = br.requests[1:]
+	}
+
+	br.state.Requests = len(br.requests)
+	br.state.Errors = 0
+	for _, req := range br.requests {
+		if req.failed {
+			br.state.Errors++
+		}
+	}
+}
+
+// opClosed adds the P&L of a closed real op and trips the breaker if the
+// daily loss or the consecutive losses are over the limits
+func (br *Breaker) opClosed(pl float64, now time.Time) {
+	br.mutex.Lock()
+	defer br.mutex.Unlock()
+
+	if day := now.UTC().Format("2006-01-02"); day != br.day {
+		br.day = day
+		br.state.DailyPl = 0
+	}
+	br.state.DailyPl += pl
+	if pl < 0 {
+		br.state.ConsecutiveLosses++
+	} else {
+		br.state.ConsecutiveLosses = 0
+	}
+
+	if br.conf.MaxDailyLoss > 0 && -br.state.DailyPl >= br.conf.MaxDailyLoss {
+		br.trip(BreakerDailyLoss, now)
+	}
+	if br.conf.MaxConsecutiveLosses > 0 && br.state.ConsecutiveLosses >= br.conf.MaxConsecutiveLosses {
+		br.trip(BreakerConsecutiveLosses, now)
+	}
+}
+
+// check verifies the trip file, the drawdown of the equity and the last tick
+// of each currency
+func (br *Breaker) check(now time.Time) {
+	fileExists := false
+	if br.conf.TripFile != "" {
+		_, err := os.Stat(br.conf.TripFile)
+		fileExists = err == nil
+	}
+
+	vals := br.GetAllCurrVals()
+	lastTs := int64(0)
+	for _, curr := range br.GetCurrencies() {
+		if currVals := vals[curr]; len(currVals) > 0 && currVals[len(currVals)-1].Ts > lastTs {
+			lastTs = currVals[len(currVals)-1].Ts
+		}
+	}
+	equity, equityErr := 0.0, error(nil)
+	if br.account != nil {
+		equity, equityErr = br.account.GetEquity()
+		br.requestDone(equityErr, tsTime(lastTs))
+	}
+
+	br.mutex.Lock()
+	defer br.mutex.Unlock()
+
+	if br.conf.TripFile != "" {
+		switch {
+		case fileExists && !br.fileSeen:
+			log.Info("Circuit breaker trip file found:", br.conf.TripFile)
+			br.trip(BreakerManual, now)
+		case !fileExists && br.fileSeen && br.state.Tripped:
+			log.Info("Circuit breaker trip file removed:", br.conf.TripFile)
+			br.reset(now)
+		}
+		br.fileSeen = fileExists
+	}
+
+	if br.account != nil && equityErr == nil {
+		br.state.Equity = equity
+		if equity > br.state.EquityPeak {
+			br.state.EquityPeak = equity
+		}
+		if br.conf.MaxDrawdown > 0 && br.state.EquityPeak > 0 && 1-equity/br.state.EquityPeak >= br.conf.MaxDrawdown {
+			br.trip(BreakerDrawdown, now)
+		}
+	}
+
+	for _, curr := range br.GetCurrencies() {
+		currVals := vals[curr]
+		if len(currVals) > 0 && currVals[len(currVals)-1].Ts != br.lastTs[curr] {
+			br.lastTs[curr] = currVals[len(currVals)-1].Ts
+			br.lastTickAt[curr] = now
+		}
+		if _, ok := br.lastTickAt[curr]; !ok {
+			br.lastTickAt[curr] = now
+		}
+		if br.conf.MaxFeedStaleSecs > 0 && now.Sub(br.lastTickAt[curr]) >= time.Duration(br.conf.MaxFeedStaleSecs)*time.Second {
+			log.Info("Stale feed, Curr:", curr, "Last tick received at:", br.lastTickAt[curr])
+			br.trip(BreakerStaleFeed, now)
+		}
+	}
+}
+
+// trip trips the breaker if it is not already tripped, the mutex has to be
+// locked
+func (br *Breaker) trip(reason string, now time.Time) {
+	if br.state.Tripped {
+		return
+	}
+
+	br.state.Tripped = true
+	br.state.Reason = reason
+	br.state.TrippedAt = now.Unix()
+	log.Error("Circuit breaker tripped, Reason:", reason, "State:", br.state)
+
+	if br.conf.TripFile != "" {
+		b, _ := json.Marshal(br.state)
+		if err := ioutil.WriteFile(br.conf.TripFile, b, 0644); err != nil {
+			log.Error("The circuit breaker trip file can't be written:", err)
+		} else {
+			br.fileSeen = true
+		}
+	}
+	if br.onTrip != nil {
+		// the breaker can trip while a trader is closing an order, the
+		// traders are stopped without blocking it
+		go br.onTrip(reason)
+	}
+}
+
+// Trip trips the breaker manually, the kill switch
+func (br *Breaker) Trip() {
+	br.mutex.Lock()
+	defer br.mutex.Unlock()
+
+	br.trip(BreakerManual, time.Now())
+}
+
+// Reset closes the breaker again, the counters are reset and the equity peak
+// and the feed are measured again from now
+func (br *Breaker) Reset() {
+	br.mutex.Lock()
+	defer br.mutex.Unlock()
+
+	br.reset(time.Now())
+}
+
+// reset closes the breaker, the mutex has to be locked
+func (br *Breaker) reset(now time.Time) {
+	log.Info("Circuit breaker reset, Previous state:", br.state)
+
+	br.state = BreakerState{}
+	br.requests = nil
+	for curr := range br.lastTickAt {
+		br.lastTickAt[curr] = now
+	}
+	if br.conf.TripFile != "" && br.fileSeen {
+		if err := os.Remove(br.conf.TripFile); err != nil && !os.IsNotExist(err) {
+			log.Error("The circuit breaker trip file can't be removed:", err)
+		}
+		br.fileSeen = false
+	}
+	if br.onReset != nil {
+		br.onReset()
+	}
+}
+
+// monitorBreaker checks periodically the conditions of the breaker
+func (hades *Hades) monitorBreaker() {
+	c := time.Tick(time.Duration(hades.breaker.conf.CheckSecs) * time.Second)
+	for now := range c {
+		hades.breaker.check(now)
+	}
+}
+
+// breakerTripped stops the traders and, if configured, closes all the open
+// positions
+func (hades *Hades) breakerTripped(reason string) {
+	hades.mutex.Lock()
+	defer hades.mutex.Unlock()
+
+	closed := 0
+	if hades.breaker.conf.Flatten {
+		for _, trader := range hades.tradersPlaying {
+			n, err := trader.CloseAllPositions(hermes.CloseBreaker)
+			closed += n
+			if err != nil {
+				log.Error("Circuit breaker: the positions of the trader:", trader.GetID(), "can't be closed, Error:", err)
+			}
+		}
+	}
+	hades.stopAllPlaying()
+	log.Info("Circuit breaker: traders stopped, Reason:", reason, "Positions closed:", closed, "Traders with open positions:", len(hades.tradersPlaying))
+
+	if hades.auditor != nil {
+		hades.auditor.record(&AuditEntry{
+			Ts:     time.Now().Unix(),
+			Remote: "breaker",
+			Action: "breaker-trip",
+			Result: fmt.Sprintf("reason: %s, positions closed: %d", reason, closed),
+		})
+	}
+}
+
+// stopAllPlaying stops the playing traders without open positions, the mutex
+// has to be locked
+func (hades *Hades) stopAllPlaying() {
+	for id, trader := range hades.tradersPlaying {
+		if trader.StopPlaying() {
+			delete(hades.tradersPlaying, id)
+		}
+	}
+}
+
+// GetBreakerState returns the state of the circuit breaker, nil if there is
+// no breaker
+func (hades *Hades) GetBreakerState() *BreakerState {
+	if hades.breaker == nil {
+		return nil
+	}
+
+	state := hades.breaker.GetState()
+	return &state
+}
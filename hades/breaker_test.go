@@ -0,0 +1,219 @@
+package hades
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/alonsovidales/v/charont"
+	"github.com/alonsovidales/v/hermes"
+)
+
+// brokerTest fails the orders while fail is true, doesn't return them while
+// noOrder is true and provides the equity
+type brokerTest struct {
+	collectorTest
+
+	fail    bool
+	noOrder bool
+	equity  float64
+}
+
+func (bt *brokerTest) Buy(curr string, units int, bound float64, realOps bool, ts int64) (*charont.Order, error) {
+	if bt.fail {
+		return nil, fmt.Errorf("broker not available")
+	}
+	if bt.noOrder {
+		return nil, nil
+	}
+
+	return bt.collectorTest.Buy(curr, units, bound, realOps, ts)
+}
+
+func (bt *brokerTest) GetEquity() (float64, error) {
+	return bt.equity, nil
+}
+
+func closeWithPl(br *Breaker, pl float64) {
+	ord, _ := br.Int.Buy("EUR", 10, 0, true, 1)
+	ord.Pl = pl
+	br.CloseOrder(ord, 2)
+}
+
+func TestBreakerLosses(t *testing.T) {
+	br := GetBreaker(&brokerTest{}, &BreakerConf{MaxDailyLoss: 100, MaxConsecutiveLosses: 3})
+
+	for _, pl := range []float64{-10, -10, 5, -10, -10} {
+		closeWithPl(br, pl)
+	}
+	if br.IsTripped() {
+		t.Fatal("The breaker shouldn't be tripped, state:", br.GetState())
+	}
+	closeWithPl(br, -10)
+	if state := br.GetState(); !state.Tripped || state.Reason != BreakerConsecutiveLosses || state.DailyPl != -45 {
+		t.Error("The breaker should be tripped by the consecutive losses, state:", state)
+	}
+
+	if _, err := br.Buy("EUR", 10, 0, true, 3); err != ErrBreakerTripped {
+		t.Error("The real orders should be rejected, Error:", err)
+	}
+	if _, err := br.Sell("EUR", 10, 0, false, 3); err != nil {
+		t.Error("The simulated orders should be accepted, Error:", err)
+	}
+
+	br.Reset()
+	closeWithPl(br, -60)
+	closeWithPl(br, 1)
+	if br.IsTripped() {
+		t.Fatal("The breaker should be reset, state:", br.GetState())
+	}
+	closeWithPl(br, -50)
+	if state := br.GetState(); state.Reason != BreakerDailyLoss {
+		t.Error("The breaker should be tripped by the daily loss, state:", state)
+	}
+}
+
+func TestBreakerFeedDays(t *testing.T) {
+	br := GetBreaker(&brokerTest{}, &BreakerConf{MaxDailyLoss: 100})
+
+	day := int64(24*3600) * tsMultToSecs
+	for i := int64(1); i <= 3; i++ {
+		ord, _ := br.Int.Buy("EUR", 10, 0, true, i*day)
+		ord.Pl = -60
+		ord.SellTs = i*day + tsMultToSecs
+		br.CloseOrder(ord, ord.SellTs)
+	}
+	if state := br.GetState(); state.Tripped || state.DailyPl != -60 {
+		t.Error("The daily loss should be measured on the days of the feed, state:", state)
+	}
+}
+
+func TestBreakerBrokerAndFeed(t *testing.T) {
+	broker := &brokerTest{equity: 1000}
+	broker.vals = map[string][]*charont.CurrVal{
+		"EUR": {{Ts: 1}},
+		"GBP": {{Ts: 1}},
+	}
+	br := GetBreaker(broker, &BreakerConf{MaxErrorRate: 0.5, MinRequests: 4, MaxDrawdown: 0.1, MaxFeedStaleSecs: 30})
+
+	now := time.Now()
+	br.check(now)
+	broker.equity = 1200
+	broker.vals["EUR"] = append(broker.vals["EUR"], &charont.CurrVal{Ts: 2})
+	br.check(now.Add(20 * time.Second))
+	if state := br.GetState(); state.Tripped || state.EquityPeak != 1200 || state.Requests != 2 {
+		t.Fatal("The breaker shouldn't be tripped, state:", state)
+	}
+	broker.equity = 1050
+	br.check(now.Add(25 * time.Second))
+	if state := br.GetState(); state.Reason != BreakerDrawdown {
+		t.Error("The breaker should be tripped by the drawdown, state:", state)
+	}
+
+	br.Reset()
+	br.Buy("EUR", 10, 0, true, 1)
+	br.Buy("EUR", 10, 0, true, 1)
+	broker.fail = true
+	br.Buy("EUR", 10, 0, true, 1)
+	if state := br.GetState(); state.Tripped || state.Requests != 3 || state.Errors != 1 {
+		t.Fatal("The breaker shouldn't be tripped, state:", state)
+	}
+	broker.fail = false
+	broker.noOrder = true
+	if _, err := br.Buy("EUR", 10, 0, true, 1); err != ErrNoOrder {
+		t.Error("An error should be returned if the broker doesn't return the order, Error:", err)
+	}
+	if state := br.GetState(); state.Reason != BreakerErrorRate {
+		t.Error("The breaker should be tripped by the errors, state:", state)
+	}
+
+	br.Reset()
+	broker.noOrder = false
+	now = time.Now()
+	br.check(now)
+	if state := br.GetState(); state.Tripped || state.EquityPeak != 1050 {
+		t.Fatal("The equity peak and the feed should be measured again after the reset, state:", state)
+	}
+	broker.vals["EUR"] = append(broker.vals["EUR"], &charont.CurrVal{Ts: 3})
+	br.check(now.Add(40 * time.Second))
+	if state := br.GetState(); state.Reason != BreakerStaleFeed {
+		t.Error("The breaker should be tripped by the stale GBP feed, state:", state)
+	}
+}
+
+func TestBreakerTripFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hades-breaker")
+	if err != nil {
+		t.Fatal("Problem creating the temp dir:", err)
+	}
+	defer os.RemoveAll(dir)
+	tripFile := filepath.Join(dir, "tripped")
+
+	conf := &BreakerConf{MaxConsecutiveLosses: 1, TripFile: tripFile}
+	br := GetBreaker(&brokerTest{}, conf)
+	closeWithPl(br, -1)
+	if _, err := os.Stat(tripFile); err != nil {
+		t.Fatal("The trip file should be created:", err)
+	}
+
+	restarted := GetBreaker(&brokerTest{}, conf)
+	if state := restarted.GetState(); !state.Tripped || state.Reason != BreakerConsecutiveLosses {
+		t.Error("The breaker should be tripped after a restart, state:", state)
+	}
+
+	os.Remove(tripFile)
+	restarted.check(time.Now())
+	if restarted.IsTripped() {
+		t.Error("The breaker should be reset removing the trip file")
+	}
+
+	ioutil.WriteFile(tripFile, nil, 0644)
+	restarted.check(time.Now())
+	if state := restarted.GetState(); state.Reason != BreakerManual {
+		t.Error("The breaker should be tripped creating the trip file, state:", state)
+	}
+	restarted.Reset()
+	if _, err := os.Stat(tripFile); !os.IsNotExist(err) {
+		t.Error("The trip file should be removed on reset, Error:", err)
+	}
+}
+
+func TestBreakerStopsTraders(t *testing.T) {
+	traders := getTradersTest()
+	hades := &Hades{
+		traders:           traders,
+		tradersPlaying:    make(map[int]hermes.Int),
+		tradesThatCanPlay: 4,
+		forced:            map[int]bool{1: true},
+		selection:         &greedySelection{conf: &SelectionConf{Window: LastOpsToHaveInConsideration}},
+		breaker:           GetBreaker(&brokerTest{}, &BreakerConf{Flatten: true}),
+	}
+	for _, trader := range traders[:2] {
+		trader.StartPlaying()
+		hades.tradersPlaying[trader.GetID()] = trader
+	}
+	traders[0].(*traderTest).open = []*charont.Order{{Id: 1}}
+	traders[1].(*traderTest).open = []*charont.Order{{Id: 2}}
+	traders[1].(*traderTest).failCloses = 1
+
+	hades.breaker.Trip()
+	hades.breakerTripped(BreakerManual)
+	if traders[0].IsPlaying() || !traders[1].IsPlaying() || len(traders[1].GetOpenOrders()) != 1 {
+		t.Error("Only the trader with open positions should continue playing, playing:", hades.tradersPlaying)
+	}
+
+	traders[1].(*traderTest).open = nil
+	hades.selectTraders()
+	if len(hades.tradersPlaying) != 0 {
+		t.Error("No trader should play while the breaker is tripped, playing:", hades.tradersPlaying)
+	}
+
+	hades.breaker.Reset()
+	hades.selectTraders()
+	if !traders[1].IsPlaying() {
+		t.Error("The traders should play again after the reset")
+	}
+}
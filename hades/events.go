@@ -0,0 +1,74 @@
+package hades
+
+import (
+	"sync"
+
+	"github.com/alonsovidales/pit/log"
+	"github.com/alonsovidales/v/hermes"
+)
+
+// selectionEvents coalesces the events of the traders and the changes of the
+// config or the admin API until the next price, when the traders are
+// selected again
+type selectionEvents struct {
+	mutex   sync.Mutex
+	traders map[int]bool
+	all     bool
+}
+
+// incrementalPolicyInt is implemented by the selection policies that evaluate
+// again only the traders with events
+type incrementalPolicyInt interface {
+	update(traders map[int]bool, all bool)
+}
+
+// traderEvent records the event of a trader, it is called while the trader
+// is locked so it can't lock the hades mutex
+func (hades *Hades) traderEvent(ev *hermes.Event) {
+	hades.events.mutex.Lock()
+	defer hades.events.mutex.Unlock()
+
+	if hades.events.traders == nil {
+		hades.events.traders = make(map[int]bool)
+	}
+	hades.events.traders[ev.TraderID] = true
+	log.Debug("Trader event, ID:", ev.TraderID, "Type:", ev.Type, "Risk:", ev.Risk)
+}
+
+// requestSelection selects the traders again with the next price
+func (hades *Hades) requestSelection() {
+	hades.events.mutex.Lock()
+	defer hades.events.mutex.Unlock()
+
+	hades.events.all = true
+}
+
+// drain returns the traders with events and if a full selection was requested
+// since the last call
+func (se *selectionEvents) drain() (traders map[int]bool, all bool) {
+	se.mutex.Lock()
+	defer se.mutex.Unlock()
+
+	traders, all = se.traders, se.all
+	se.traders, se.all = nil, false
+
+	return
+}
+
+// newPrices selects the traders if something changed since the last price,
+// the selection follows the clock of the collector and not the wall clock so
+// the replays choose the same traders
+func (hades *Hades) newPrices(curr string, ts int64) {
+	traders, all := hades.events.drain()
+	if len(traders) == 0 && !all {
+		return
+	}
+
+	log.Debug("Selecting traders, Curr:", curr, "Ts:", ts, "Traders with events:", len(traders), "Full:", all)
+	hades.mutex.Lock()
+	if policy, ok := hades.selection.(incrementalPolicyInt); ok {
+		policy.update(traders, all)
+	}
+	hades.mutex.Unlock()
+	hades.selectTraders()
+}
@@ -0,0 +1,60 @@
+package hades
+
+import (
+	"testing"
+
+	"github.com/alonsovidales/v/hermes"
+)
+
+func TestEventsSelection(t *testing.T) {
+	policy, err := GetSelectionPolicy(&SelectionConf{Policy: SelectionGreedy, Window: 3, MinOps: 3})
+	if err != nil {
+		t.Fatal("Problem creating the policy:", err)
+	}
+	traders := getTradersTest()
+	hades := &Hades{
+		traders:           traders,
+		tradersPlaying:    make(map[int]hermes.Int),
+		tradesThatCanPlay: 4,
+		forced:            make(map[int]bool),
+		selection:         policy,
+	}
+
+	hades.newPrices("EUR", 1)
+	if len(hades.tradersPlaying) != 0 {
+		t.Fatal("The traders shouldn't be selected without events, playing:", hades.tradersPlaying)
+	}
+	hades.requestSelection()
+	hades.newPrices("EUR", 2)
+	if len(hades.tradersPlaying) != 1 || !traders[1].IsPlaying() {
+		t.Fatal("The consistent winner should play, playing:", hades.tradersPlaying)
+	}
+	cached := policy.(*greedySelection).entries[1].stats
+
+	newTrader := traders[2].(*traderTest)
+	newTrader.profits = append(newTrader.profits, 0.05, 0.05)
+	hades.newPrices("GBP", 3)
+	if newTrader.IsPlaying() {
+		t.Error("The new op wasn't notified, the traders shouldn't be selected again")
+	}
+	hades.traderEvent(&hermes.Event{TraderID: 2, Type: hermes.EventOpClosed})
+	hades.traderEvent(&hermes.Event{TraderID: 2, Type: hermes.EventRiskChanged})
+	hades.newPrices("GBP", 4)
+	if len(hades.tradersPlaying) != 2 || !newTrader.IsPlaying() {
+		t.Error("The trader with the new ops should play, playing:", hades.tradersPlaying)
+	}
+	if policy.(*greedySelection).entries[1].stats != cached {
+		t.Error("The trader without new ops shouldn't be evaluated again")
+	}
+
+	winner := traders[1].(*traderTest)
+	winner.profits = append(winner.profits, -0.5)
+	hades.traderEvent(&hermes.Event{TraderID: 2, Type: hermes.EventOpClosed})
+	hades.newPrices("GBP", 5)
+	if policy.(*greedySelection).entries[1].stats != cached {
+		t.Error("Only the traders with events should be evaluated again")
+	}
+	if traders, all := hades.events.drain(); len(traders) != 0 || all {
+		t.Error("The events should be consumed by the selection, traders:", traders, "Full:", all)
+	}
+}
@@ -0,0 +1,636 @@
+package hades
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/alonsovidales/pit/log"
+	"github.com/alonsovidales/v/hermes"
+	"github.com/alonsovidales/v/philoctetes"
+)
+
+const (
+	// GeneEntry and GeneExit are the boundaries of the trainer, the other
+	// genes are numeric params of the trader types
+	GeneEntry = "entry"
+	GeneExit  = "exit"
+
+	LineageBorn    = "born"
+	LineageRetired = "retired"
+
+	populationFile = "population.json"
+	// lineageEntriesToKeep is the number of the last lineage entries kept in
+	// memory, all of them are stored on the lineage file
+	lineageEntriesToKeep = 1000
+
+	defaultRetireRatio   = 0.1
+	defaultElite         = 2
+	defaultMutationRate  = 0.2
+	defaultMutationScale = 0.1
+)
+
+// GeneRange is the range of the values that a gene can take, the values of
+// the Int genes are rounded
+type GeneRange struct {
+	Name string
+	Min  float64
+	Max  float64
+	Int  bool
+}
+
+// EvolutionConf defines the evolution of the traders of each group and
+// currency. On each generation the traders with at least MinOps ops and a
+// score under one on the last Window ops during BadGenerations generations are
+// retired, at most RetireRatio of the population, and new ones are spawned
+// until PopulationSize crossing over and mutating the genes of the Elite best
+// traders. The traders playing or with open positions are never retired
+type EvolutionConf struct {
+	PopulationSize int
+	GenerationSecs int
+	Genes          []GeneRange
+	MinOps         int
+	Window         int
+	RetireRatio    float64
+	BadGenerations int
+	Elite          int
+	// MutationRate is the probability of mutating each gene and
+	// MutationScale the standard deviation of the mutation as ratio of the
+	// range of the gene
+	MutationRate  float64
+	MutationScale float64
+	LineageFile   string
+	Seed          int64
+}
+
+// Genome contains the value of each gene of a trader
+type Genome map[string]float64
+
+// Member is a live trader of the population
+type Member struct {
+	ID         int    `json:"id"`
+	Type       string `json:"type"`
+	Curr       string `json:"curr"`
+	Generation int    `json:"generation"`
+	Parents    []int  `json:"parents"`
+	Genome     Genome `json:"genome"`
+}
+
+// LineageEntry records the birth or the retirement of a trader
+type LineageEntry struct {
+	Ts      int64   `json:"ts"`
+	Event   string  `json:"event"`
+	Ops     int     `json:"ops,omitempty"`
+	Fitness float64 `json:"fitness,omitempty"`
+	Member
+}
+
+// populationSnapshot is stored with the snapshots of the traders in order to
+// launch again the same population after a restart
+type populationSnapshot struct {
+	Generation int       `json:"generation"`
+	NextID     int       `json:"next_id"`
+	Members    []*Member `json:"members"`
+}
+
+// evolution contains the state of the population, it is protected by the
+// mutex of hades
+type evolution struct {
+	conf       EvolutionConf
+	genes      map[string]GeneRange
+	rnd        *rand.Rand
+	generation int
+	nextID     int
+	members    map[int]*Member
+	bad        map[int]int
+	lineage    *os.File
+	entries    []*LineageEntry
+}
+
+// Validate checks that the ranges and the ratios are consistent
+func (conf *EvolutionConf) Validate() error {
+	if conf.GenerationSecs <= 0 {
+		return fmt.Errorf("hades: the generation interval has to be positive")
+	}
+	if len(conf.Genes) == 0 {
+		return fmt.Errorf("hades: at least one gene is required to evolve the traders")
+	}
+	seen := make(map[string]bool)
+	for _, gene := range conf.Genes {
+		if gene.Min >= gene.Max {
+			return fmt.Errorf("hades: invalid range of the gene %s: %f-%f", gene.Name, gene.Min, gene.Max)
+		}
+		if seen[gene.Name] {
+			return fmt.Errorf("hades: the gene %s is defined twice", gene.Name)
+		}
+		seen[gene.Name] = true
+	}
+	if conf.RetireRatio < 0 || conf.RetireRatio > 1 || conf.MutationRate < 0 || conf.MutationRate > 1 {
+		return fmt.Errorf("hades: the retire ratio and the mutation rate have to be between zero and one")
+	}
+
+	return nil
+}
+
+func getEvolution(conf *EvolutionConf, lastOpsToConsider int) (ev *evolution, err error) {
+	if err = conf.Validate(); err != nil {
+		return
+	}
+
+	ev = &evolution{
+		conf:    *conf,
+		genes:   make(map[string]GeneRange),
+		members: make(map[int]*Member),
+		bad:     make(map[int]int),
+	}
+	for _, gene := range conf.Genes {
+		ev.genes[gene.Name] = gene
+	}
+	if ev.conf.Window == 0 {
+		ev.conf.Window = LastOpsToHaveInConsideration
+	}
+	if ev.conf.MinOps == 0 {
+		ev.conf.MinOps = lastOpsToConsider
+	}
+	if ev.conf.RetireRatio == 0 {
+		ev.conf.RetireRatio = defaultRetireRatio
+	}
+	if ev.conf.BadGenerations == 0 {
+		ev.conf.BadGenerations = 1
+	}
+	if ev.conf.Elite == 0 {
+		ev.conf.Elite = defaultElite
+	}
+	if ev.conf.MutationRate == 0 {
+		ev.conf.MutationRate = defaultMutationRate
+	}
+	if ev.conf.MutationScale == 0 {
+		ev.conf.MutationScale = defaultMutationScale
+	}
+	seed := conf.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	ev.rnd = rand.New(rand.NewSource(seed))
+
+	if conf.LineageFile != "" {
+		ev.lineage, err = os.OpenFile(conf.LineageFile, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	}
+
+	return
+}
+
+// genesOf returns the genes that apply to the traders of the group, the
+// boundaries require a trainer that implements philoctetes.BoundariesInt
+func (ev *evolution) genesOf(group *TradersGroup, trainer philoctetes.TrainerInt) (genes []GeneRange, err error) {
+	tt, ok := hermes.GetTraderType(group.Type)
+	if !ok {
+		return nil, fmt.Errorf("hades: unknown trader type: %s", group.Type)
+	}
+	params := make(map[string]bool)
+	for _, param := range tt.Params {
+		params[param.Name] = true
+	}
+	_, boundaries := trainer.(philoctetes.BoundariesInt)
+
+	for _, gene := range ev.conf.Genes {
+		switch {
+		case gene.Name == GeneEntry || gene.Name == GeneExit:
+			if !boundaries {
+				return nil, fmt.Errorf("hades: the trainer doesn't allow to evolve the gene %s", gene.Name)
+			}
+			genes = append(genes, gene)
+		case params[gene.Name]:
+			genes = append(genes, gene)
+		}
+	}
+
+	return
+}
+
+// initialGenome returns the genome of a trader of the initial population,
+// the boundaries encoded on its ID and the params of its group
+func initialGenome(id int, group *TradersGroup, genes []GeneRange) (genome Genome) {
+	tt, _ := hermes.GetTraderType(group.Type)
+	defaults := make(map[string]string)
+	for _, param := range tt.Params {
+		defaults[param.Name] = param.Default
+	}
+
+	genome = make(Genome)
+	for _, gene := range genes {
+		switch gene.Name {
+		case GeneEntry:
+			genome[gene.Name] = philoctetes.GridBoundaries(id).Entry
+		case GeneExit:
+			genome[gene.Name] = philoctetes.GridBoundaries(id).Exit
+		default:
+			value, err := strconv.ParseFloat(group.Params[gene.Name], 64)
+			if err != nil {
+				if value, err = strconv.ParseFloat(defaults[gene.Name], 64); err != nil {
+					value = (gene.Min + gene.Max) / 2
+				}
+			}
+			genome[gene.Name] = value
+		}
+	}
+
+	return
+}
+
+// clamp returns the value limited to the range of the gene
+func (gene GeneRange) clamp(value float64) float64 {
+	value = math.Max(gene.Min, math.Min(gene.Max, value))
+	if gene.Int {
+		value = math.Round(value)
+	}
+
+	return value
+}
+
+// breed returns a new genome with each gene taken from one of the parents
+// and mutated, the genes are random if there are no parents
+func (ev *evolution) breed(genes []GeneRange, parents []*Member) (genome Genome) {
+	genome = make(Genome)
+	for _, gene := range genes {
+		if len(parents) == 0 {
+			genome[gene.Name] = gene.clamp(gene.Min + ev.rnd.Float64()*(gene.Max-gene.Min))
+			continue
+		}
+
+		value := parents[ev.rnd.Intn(len(parents))].Genome[gene.Name]
+		if ev.rnd.Float64() < ev.conf.MutationRate {
+			value += ev.rnd.NormFloat64() * ev.conf.MutationScale * (gene.Max - gene.Min)
+		}
+		genome[gene.Name] = gene.clamp(value)
+	}
+
+	return
+}
+
+func (ev *evolution) record(event string, member *Member, ops int, fitness float64) {
+	entry := &LineageEntry{
+		Ts:      time.Now().Unix(),
+		Event:   event,
+		Ops:     ops,
+		Fitness: fitness,
+		Member:  *member,
+	}
+	ev.entries = append(ev.entries, entry)
+	if len(ev.entries) > lineageEntriesToKeep {
+		ev.entries = ev.entries[len(ev.entries)-lineageEntriesToKeep:]
+	}
+
+	if ev.lineage != nil {
+		if b, err := json.Marshal(entry); err == nil {
+			if _, err = ev.lineage.Write(append(b, '\n')); err != nil {
+				log.Error("The lineage entry can't be written, Error:", err)
+			}
+		}
+	}
+}
+
+// launchTrader builds a trader of the group with the given genome, the genes
+// that are params of the trader type replace the ones of the group
+func (hades *Hades) launchTrader(group *TradersGroup, curr string, id int, genome Genome) (trader hermes.Int, err error) {
+	params := make(map[string]string)
+	for name, value := range group.Params {
+		params[name] = value
+	}
+	for name, value := range genome {
+		if name != GeneEntry && name != GeneExit {
+			params[name] = strconv.FormatFloat(value, 'f', -1, 64)
+		}
+	}
+	if trainer, ok := hades.trainer.(philoctetes.BoundariesInt); ok && genome != nil {
+		boundaries := philoctetes.GridBoundaries(id)
+		if entry, ok := genome[GeneEntry]; ok {
+			boundaries.Entry = entry
+		}
+		if exit, ok := genome[GeneExit]; ok {
+			boundaries.Exit = exit
+		}
+		trainer.SetBoundaries(id, boundaries)
+	}
+
+	log.Debug("Launching trader:", curr, "Type:", group.Type, "Id:", id, "Genome:", genome)
+	return hermes.GetTrader(group.Type, &hermes.TraderConf{
+		ID:        id,
+		Curr:      curr,
+		Trainer:   hades.trainer,
+		Collector: hades.traderCollector(id),
+		Units:     hades.units,
+		Risk:      group.Risk,
+		Tracer:    hades.tracer,
+		Params:    params,
+		OnEvent:   hades.traderEvent,
+	})
+}
+
+// launchPopulation launches the initial traders, the population of the last
+// snapshot if it exists or the traders of each group with the boundaries
+// encoded on their IDs
+func (hades *Hades) launchPopulation() (err error) {
+	snap, err := hades.loadPopulation()
+	if err != nil || snap == nil {
+		if err == nil {
+			err = hades.launchGroups()
+		}
+		return
+	}
+
+	groups := make(map[string]*TradersGroup)
+	for _, group := range hades.groups {
+		groups[group.Type] = group
+	}
+	hades.evolution.generation = snap.Generation
+	hades.evolution.nextID = snap.NextID
+	for _, member := range snap.Members {
+		group, ok := groups[member.Type]
+		if !ok {
+			log.Info("The trader type is not configured, the trader is not launched, ID:", member.ID, "Type:", member.Type)
+			continue
+		}
+		trader, err := hades.launchTrader(group, member.Curr, member.ID, member.Genome)
+		if err != nil {
+			return err
+		}
+		hades.traders = append(hades.traders, trader)
+		hades.evolution.members[member.ID] = member
+	}
+	log.Info("Population restored, Generation:", snap.Generation, "Traders:", len(hades.traders))
+
+	return
+}
+
+// launchGroups launches the traders of each group for each one of the
+// currencies
+func (hades *Hades) launchGroups() (err error) {
+	for _, group := range hades.groups {
+		currencies := group.Currencies
+		if len(currencies) == 0 {
+			currencies = hades.collector.GetCurrencies()
+		}
+		var genes []GeneRange
+		if hades.evolution != nil {
+			if genes, err = hades.evolution.genesOf(group, hades.trainer); err != nil {
+				return
+			}
+		}
+
+		for _, curr := range currencies {
+			for t := 0; t < group.Traders; t++ {
+				id := hades.firstTraderID() + len(hades.traders)
+				var genome Genome
+				if hades.evolution != nil {
+					genome = initialGenome(id, group, genes)
+				}
+				trader, err := hades.launchTrader(group, curr, id, genome)
+				if err != nil {
+					return err
+				}
+				hades.traders = append(hades.traders, trader)
+
+				if hades.evolution != nil {
+					member := &Member{ID: id, Type: group.Type, Curr: curr, Genome: genome}
+					hades.evolution.members[id] = member
+					hades.evolution.record(LineageBorn, member, 0, 0)
+				}
+			}
+		}
+	}
+	if hades.evolution != nil {
+		hades.evolution.nextID = hades.firstTraderID() + len(hades.traders)
+	}
+
+	return
+}
+
+func (hades *Hades) loadPopulation() (snap *populationSnapshot, err error) {
+	if hades.evolution == nil || hades.snapshotsDir == "" {
+		return
+	}
+
+	b, err := ioutil.ReadFile(filepath.Join(hades.snapshotsDir, populationFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return
+	}
+	snap = &populationSnapshot{}
+	err = json.Unmarshal(b, snap)
+
+	return
+}
+
+// savePopulation stores the live population with the snapshots of the
+// traders
+func (hades *Hades) savePopulation() {
+	hades.mutex.Lock()
+	snap := &populationSnapshot{
+		Generation: hades.evolution.generation,
+		NextID:     hades.evolution.nextID,
+	}
+	for _, trader := range hades.traders {
+		if member, ok := hades.evolution.members[trader.GetID()]; ok {
+			snap.Members = append(snap.Members, member)
+		}
+	}
+	hades.mutex.Unlock()
+
+	b, err := json.Marshal(snap)
+	if err == nil {
+		err = ioutil.WriteFile(filepath.Join(hades.snapshotsDir, populationFile), b, 0644)
+	}
+	if err != nil {
+		log.Error("The population can't be stored, Error:", err)
+	}
+}
+
+func (hades *Hades) evolvePopulation() {
+	c := time.Tick(time.Duration(hades.evolution.conf.GenerationSecs) * time.Second)
+	for _ = range c {
+		hades.evolve()
+	}
+}
+
+// candidate is a trader of a population with its fitness
+type candidate struct {
+	trader  hermes.Int
+	member  *Member
+	ops     int
+	fitness float64
+}
+
+// evolve retires the persistently bad traders of each population, a group
+// and currency, and spawns new ones from the best
+func (hades *Hades) evolve() {
+	hades.mutex.Lock()
+	defer hades.mutex.Unlock()
+
+	if hades.stopping {
+		return
+	}
+
+	ev := hades.evolution
+	ev.generation++
+	populations := make(map[string][]*candidate)
+	for _, trader := range hades.traders {
+		member, ok := ev.members[trader.GetID()]
+		if !ok {
+			continue
+		}
+		key := member.Type + "/" + member.Curr
+		populations[key] = append(populations[key], &candidate{
+			trader:  trader,
+			member:  member,
+			ops:     trader.GetNumOps(),
+			fitness: trader.GetScore(ev.conf.Window),
+		})
+	}
+
+	retired, born := 0, 0
+	for _, group := range hades.groups {
+		genes, err := ev.genesOf(group, hades.trainer)
+		if err != nil {
+			log.Error("The traders of the group can't evolve, Type:", group.Type, "Error:", err)
+			continue
+		}
+		size := ev.conf.PopulationSize
+		if size == 0 {
+			size = group.Traders
+		}
+
+		currencies := group.Currencies
+		if len(currencies) == 0 {
+			currencies = hades.collector.GetCurrencies()
+		}
+		for _, curr := range currencies {
+			population := populations[group.Type+"/"+curr]
+			population, r := hades.retireBad(population, size)
+			b := hades.spawn(group, curr, genes, population, size-len(population))
+			retired += r
+			born += b
+		}
+	}
+	if retired > 0 || born > 0 {
+		hades.requestSelection()
+	}
+	evolutionGeneration.Set(float64(ev.generation), hades.book.Name)
+	log.Info("Generation:", ev.generation, "Retired traders:", retired, "Born traders:", born, "Traders:", len(hades.traders))
+}
+
+// retireBad retires the traders that have been losing during the last
+// generations and returns the remaining ones sorted by fitness, the mutex
+// has to be locked
+func (hades *Hades) retireBad(population []*candidate, size int) (remaining []*candidate, retired int) {
+	ev := hades.evolution
+	sort.Slice(population, func(i, j int) bool { return population[i].fitness < population[j].fitness })
+
+	maxRetire := int(math.Ceil(ev.conf.RetireRatio * float64(size)))
+	for _, cand := range population {
+		id := cand.trader.GetID()
+		if cand.ops >= ev.conf.MinOps && cand.fitness < 1 {
+			ev.bad[id]++
+		} else {
+			delete(ev.bad, id)
+		}
+
+		_, forced := hades.forced[id]
+		if retired >= maxRetire || ev.bad[id] < ev.conf.BadGenerations || forced ||
+			cand.trader.IsPlaying() || len(cand.trader.GetOpenOrders()) > 0 {
+			remaining = append(remaining, cand)
+			continue
+		}
+
+		cand.trader.Retire()
+		hades.removeTrader(id)
+		delete(ev.members, id)
+		delete(ev.bad, id)
+		ev.record(LineageRetired, cand.member, cand.ops, cand.fitness)
+		retired++
+	}
+
+	return
+}
+
+// spawn launches new traders breeding the best of the population, the mutex
+// has to be locked
+func (hades *Hades) spawn(group *TradersGroup, curr string, genes []GeneRange, population []*candidate, toSpawn int) (born int) {
+	ev := hades.evolution
+
+	parents := []*Member{}
+	for i := len(population) - 1; i >= 0 && len(parents) < ev.conf.Elite; i-- {
+		if population[i].ops >= ev.conf.MinOps {
+			parents = append(parents, population[i].member)
+		}
+	}
+
+	for ; born < toSpawn; born++ {
+		// each child takes its genes from two of the best parents
+		couple := parents
+		if len(parents) > 2 {
+			perm := ev.rnd.Perm(len(parents))
+			couple = []*Member{parents[perm[0]], parents[perm[1]]}
+		}
+		member := &Member{
+			ID:         ev.nextID,
+			Type:       group.Type,
+			Curr:       curr,
+			Generation: ev.generation,
+			Parents:    []int{},
+			Genome:     ev.breed(genes, couple),
+		}
+		for _, parent := range couple {
+			member.Parents = append(member.Parents, parent.ID)
+		}
+
+		trader, err := hades.launchTrader(group, curr, member.ID, member.Genome)
+		if err != nil {
+			log.Error("The new trader can't be launched, Type:", group.Type, "Curr:", curr, "Error:", err)
+			return
+		}
+		ev.nextID++
+		hades.traders = append(hades.traders, trader)
+		ev.members[member.ID] = member
+		ev.record(LineageBorn, member, 0, 0)
+	}
+
+	return
+}
+
+// removeTrader removes the trader from the managed ones and its listeners,
+// the mutex has to be locked
+func (hades *Hades) removeTrader(id int) {
+	hades.listeners.remove(id)
+	for i, trader := range hades.traders {
+		if trader.GetID() == id {
+			hades.traders = append(hades.traders[:i], hades.traders[i+1:]...)
+			break
+		}
+	}
+	delete(hades.tradersPlaying, id)
+	delete(hades.forced, id)
+	unexportTrader(id)
+}
+
+// GetLineage returns the last births and retirements of traders, nil if the
+// population doesn't evolve
+func (hades *Hades) GetLineage() []*LineageEntry {
+	if hades.evolution == nil {
+		return nil
+	}
+
+	hades.mutex.Lock()
+	defer hades.mutex.Unlock()
+
+	return append([]*LineageEntry{}, hades.evolution.entries...)
+}
@@ -0,0 +1,137 @@
+package hades
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/alonsovidales/v/hermes"
+	"github.com/alonsovidales/v/philoctetes"
+)
+
+type trainerTest struct {
+	philoctetes.TrainerInt
+
+	boundaries map[int]philoctetes.Boundaries
+}
+
+func (tr *trainerTest) SetBoundaries(traderID int, boundaries philoctetes.Boundaries) {
+	tr.boundaries[traderID] = boundaries
+}
+
+func (tr *trainerTest) GetBoundaries(traderID int) philoctetes.Boundaries {
+	return tr.boundaries[traderID]
+}
+
+func (ct *collectorTest) AddListerner(currency string, fn func(currency string, ts int64)) {
+}
+
+func (tt *traderTest) Retire() {
+	tt.retired = true
+}
+
+func getEvolutionTest(t *testing.T, dir string) *Hades {
+	ev, err := getEvolution(&EvolutionConf{
+		GenerationSecs: 60,
+		Genes: []GeneRange{
+			{Name: GeneEntry, Min: 0, Max: 0.9},
+			{Name: GeneExit, Min: 0, Max: 0.9},
+			{Name: "max-secs-to-wait", Min: 600, Max: 4800, Int: true},
+		},
+		MinOps:         4,
+		RetireRatio:    0.5,
+		BadGenerations: 2,
+		Seed:           1,
+	}, 4)
+	if err != nil {
+		t.Fatal("The evolution can't be created:", err)
+	}
+
+	return &Hades{
+		groups:         []*TradersGroup{{Type: hermes.WindowTraderType, Traders: 2, Currencies: []string{"EUR"}, Params: map[string]string{}}},
+		trainer:        &trainerTest{boundaries: make(map[int]philoctetes.Boundaries)},
+		collector:      &collectorTest{},
+		units:          10,
+		tradersPlaying: make(map[int]hermes.Int),
+		forced:         make(map[int]bool),
+		snapshotsDir:   dir,
+		evolution:      ev,
+	}
+}
+
+func TestEvolution(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hades-evolution")
+	if err != nil {
+		t.Fatal("Problem creating the temp dir:", err)
+	}
+	defer os.RemoveAll(dir)
+
+	hades := getEvolutionTest(t, dir)
+	if err = hades.launchPopulation(); err != nil {
+		t.Fatal("The initial population can't be launched:", err)
+	}
+	if len(hades.traders) != 2 || hades.evolution.nextID != 2 || len(hades.GetLineage()) != 2 {
+		t.Fatal("The initial population should contain the traders of the group, traders:", len(hades.traders))
+	}
+	if genome := hades.evolution.members[1].Genome; genome[GeneEntry] != 0.1 || genome[GeneExit] != 0 || genome["max-secs-to-wait"] != 0 {
+		t.Error("The initial genome should be obtained from the ID and the params of the group:", genome)
+	}
+
+	// the population is replaced by traders with known results, the third
+	// one has not enough ops and the fourth is losing
+	hades.groups[0].Traders = 4
+	hades.traders = getTradersTest()
+	losing := hades.traders[3].(*traderTest)
+	for _, trader := range hades.traders {
+		hades.evolution.members[trader.GetID()] = &Member{
+			ID:     trader.GetID(),
+			Type:   hermes.WindowTraderType,
+			Curr:   "EUR",
+			Genome: Genome{GeneEntry: 0.1 * float64(trader.GetID()), GeneExit: 0.5, "max-secs-to-wait": 1200},
+		}
+	}
+	hades.evolution.nextID = 4
+	hades.evolution.entries = nil
+
+	hades.evolve()
+	if len(hades.traders) != 4 || hades.evolution.bad[3] != 1 {
+		t.Fatal("The losing trader should be retired only after two bad generations, bad:", hades.evolution.bad)
+	}
+
+	hades.evolve()
+	lineage := hades.GetLineage()
+	if !losing.retired || len(lineage) != 2 || lineage[0].Event != LineageRetired || lineage[0].ID != 3 {
+		t.Fatal("The losing trader should be retired, lineage:", lineage)
+	}
+	child := lineage[1]
+	if child.Event != LineageBorn || child.ID != 4 || child.Generation != 2 || len(child.Parents) != 2 || child.Parents[0]+child.Parents[1] != 1 {
+		t.Error("A new trader should be born from the best ones, entry:", child)
+	}
+	for _, gene := range hades.evolution.conf.Genes {
+		if value := child.Genome[gene.Name]; value < gene.Min || value > gene.Max {
+			t.Error("The gene is out of its range:", gene.Name, value)
+		}
+	}
+	if b := hades.trainer.(*trainerTest).boundaries[4]; b.Entry != child.Genome[GeneEntry] || b.Exit != child.Genome[GeneExit] {
+		t.Error("The boundaries of the new trader should be set on the trainer:", b, child.Genome)
+	}
+	ids := []int{}
+	for _, trader := range hades.traders {
+		ids = append(ids, trader.GetID())
+	}
+	if len(ids) != 4 || ids[3] != 4 {
+		t.Error("The retired trader should be replaced by the new one, traders:", ids)
+	}
+
+	hades.savePopulation()
+	restarted := getEvolutionTest(t, dir)
+	if err = restarted.launchPopulation(); err != nil {
+		t.Fatal("The population can't be restored:", err)
+	}
+	if len(restarted.traders) != 4 || restarted.traders[3].GetID() != 4 || restarted.evolution.nextID != 5 || restarted.evolution.generation != 2 {
+		t.Error("The population should be restored from the snapshot, traders:", len(restarted.traders), "next ID:", restarted.evolution.nextID)
+	}
+	if b := restarted.trainer.(*trainerTest).boundaries[4]; b.Entry != child.Genome[GeneEntry] {
+		t.Error("The boundaries of the restored traders should be set on the trainer:", b)
+	}
+}
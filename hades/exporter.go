@@ -0,0 +1,69 @@
+package hades
+
+import (
+	"strconv"
+
+	"github.com/alonsovidales/v/argos"
+)
+
+var (
+	traderScore         = argos.GetGauge("v_hades_trader_score", "Score of the last ops of each trader", "trader", "type")
+	traderPlaying       = argos.GetGauge("v_hades_trader_playing", "1 if the trader is playing with real orders, 0 otherwise", "trader", "type")
+	selectionChanges    = argos.GetCounter("v_hades_selection_changes_total", "Traders started or stopped by the selection", "book", "change")
+	traderAllocation    = argos.GetGauge("v_hades_trader_allocation", "Capital allocated to each playing trader", "trader")
+	evolutionGeneration = argos.GetGauge("v_hades_evolution_generation", "Last generation of the evolved traders", "book")
+	breakerTripped      = argos.GetGauge("v_hades_breaker_tripped", "1 if the circuit breaker is tripped, 0 otherwise", "book")
+	bookTraders         = argos.GetGauge("v_hades_book_traders", "Traders of each book", "book", "state")
+	bookOpenPositions   = argos.GetGauge("v_hades_book_open_positions", "Open positions of the traders of each book", "book")
+	bookPl              = argos.GetGauge("v_hades_book_pl", "Realized P&L on the account currency of each book", "book", "real")
+	bookEquity          = argos.GetGauge("v_hades_book_equity", "Equity of the account of each book", "book")
+)
+
+// exportSelection exports the state of the traders and of the breaker, and
+// the changes on the playing traders since the given set, the mutex has to be
+// locked
+func (hades *Hades) exportSelection(before map[int]bool) {
+	for _, trader := range hades.traders {
+		id := strconv.Itoa(trader.GetID())
+		_, playing := hades.tradersPlaying[trader.GetID()]
+		traderScore.Set(trader.GetScore(LastOpsToHaveInConsideration), id, trader.GetType())
+		if playing {
+			traderPlaying.Set(1, id, trader.GetType())
+			if !before[trader.GetID()] {
+				selectionChanges.Inc(hades.book.Name, "start")
+			}
+		} else {
+			traderPlaying.Set(0, id, trader.GetType())
+			if before[trader.GetID()] {
+				selectionChanges.Inc(hades.book.Name, "stop")
+			}
+		}
+	}
+
+	if hades.breaker != nil {
+		tripped := 0.0
+		if hades.breaker.IsTripped() {
+			tripped = 1
+		}
+		breakerTripped.Set(tripped, hades.book.Name)
+	}
+}
+
+// exportStatus exports the state and the results of the book
+func (hades *Hades) exportStatus(status *BookStatus) {
+	bookTraders.Set(float64(status.Traders), status.Name, "all")
+	bookTraders.Set(float64(status.Playing), status.Name, "playing")
+	bookOpenPositions.Set(float64(status.OpenPositions), status.Name)
+	bookPl.Set(status.SimulatedPl, status.Name, "false")
+	bookPl.Set(status.LivePl, status.Name, "true")
+	if hades.account != nil {
+		bookEquity.Set(status.Equity, status.Name)
+	}
+}
+
+// unexportTrader removes the series of a retired trader
+func unexportTrader(id int) {
+	traderScore.Delete(strconv.Itoa(id))
+	traderPlaying.Delete(strconv.Itoa(id))
+	traderAllocation.Delete(strconv.Itoa(id))
+}
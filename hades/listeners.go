@@ -0,0 +1,101 @@
+package hades
+
+import (
+	"sync"
+
+	"github.com/alonsovidales/v/charont"
+)
+
+// traderListeners contains the listeners of the prices of each trader, the
+// collector calls a single listener of hades on each currency that sends the
+// prices to the traders on the order they were added, so the listeners of a
+// retired trader are removed with it
+type traderListeners struct {
+	mutex     sync.Mutex
+	listeners map[string][]*traderListener
+}
+
+type traderListener struct {
+	id int
+	fn func(currency string, ts int64)
+}
+
+func (tl *traderListeners) add(id int, currency string, fn func(currency string, ts int64)) {
+	tl.mutex.Lock()
+	defer tl.mutex.Unlock()
+
+	if tl.listeners == nil {
+		tl.listeners = make(map[string][]*traderListener)
+	}
+	tl.listeners[currency] = append(tl.listeners[currency], &traderListener{id: id, fn: fn})
+}
+
+// remove removes all the listeners of the trader
+func (tl *traderListeners) remove(id int) {
+	tl.mutex.Lock()
+	defer tl.mutex.Unlock()
+
+	for currency, listeners := range tl.listeners {
+		kept := []*traderListener{}
+		for _, listener := range listeners {
+			if listener.id != id {
+				kept = append(kept, listener)
+			}
+		}
+		tl.listeners[currency] = kept
+	}
+}
+
+// get returns the listeners of all the traders on the currency
+func (tl *traderListeners) get(currency string) []*traderListener {
+	tl.mutex.Lock()
+	defer tl.mutex.Unlock()
+
+	return append([]*traderListener{}, tl.listeners[currency]...)
+}
+
+// traderCollector is the collector used by a trader, its listeners are
+// registered on hades instead of on the collector
+type traderCollector struct {
+	charont.Int
+
+	id        int
+	listeners *traderListeners
+}
+
+func (tc *traderCollector) AddListerner(currency string, fn func(currency string, ts int64)) {
+	tc.listeners.add(tc.id, currency, fn)
+}
+
+// traderAccount is the collector of a trader when the collector of the book
+// provides the state of the account
+type traderAccount struct {
+	*traderCollector
+	charont.AccountInt
+}
+
+// traderCollector returns the collector to be used by the trader
+func (hades *Hades) traderCollector(id int) charont.Int {
+	collector := &traderCollector{
+		Int:       hades.collector,
+		id:        id,
+		listeners: &hades.listeners,
+	}
+	if hades.account != nil {
+		return &traderAccount{
+			traderCollector: collector,
+			AccountInt:      hades.account,
+		}
+	}
+
+	return collector
+}
+
+// dispatchPrices sends the new prices to the traders listening the currency
+// and selects the traders after all of them evaluated the prices
+func (hades *Hades) dispatchPrices(curr string, ts int64) {
+	for _, listener := range hades.listeners.get(curr) {
+		listener.fn(curr, ts)
+	}
+	hades.newPrices(curr, ts)
+}
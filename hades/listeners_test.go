@@ -0,0 +1,32 @@
+package hades
+
+import (
+	"testing"
+)
+
+func TestTraderListeners(t *testing.T) {
+	hades := &Hades{collector: &collectorTest{}}
+	calls := []int{}
+	for id := 1; id <= 3; id++ {
+		traderID := id
+		hades.traderCollector(id).AddListerner("EUR", func(currency string, ts int64) {
+			calls = append(calls, traderID)
+		})
+	}
+	if _, ok := hades.traderCollector(1).(*traderCollector); !ok {
+		t.Error("The collector of the traders shouldn't provide the account if the collector of the book doesn't")
+	}
+
+	hades.dispatchPrices("EUR", 1)
+	if len(calls) != 3 || calls[0] != 1 || calls[2] != 3 {
+		t.Fatal("The prices should be sent to the traders on the order they were added:", calls)
+	}
+
+	calls = []int{}
+	hades.removeTrader(2)
+	hades.dispatchPrices("EUR", 2)
+	hades.dispatchPrices("GBP", 2)
+	if len(calls) != 2 || calls[0] != 1 || calls[1] != 3 {
+		t.Error("The prices shouldn't be sent to the removed traders:", calls)
+	}
+}
@@ -1,8 +1,11 @@
 package hades
 
 import (
+	"encoding/json"
 	"fmt"
-	"sort"
+	"io/ioutil"
+	"os"
+	"sync"
 	"time"
 
 	"github.com/alonsovidales/pit/log"
@@ -16,11 +19,53 @@ const (
 )
 
 type Hades struct {
-	traders           []hermes.Int
-	collector         charont.Int
+	mutex     sync.Mutex
+	book      BookConf
+	traders   []hermes.Int
+	groups    []*TradersGroup
+	trainer   philoctetes.TrainerInt
+	tracer    *hermes.Tracer
+	collector charont.Int
+	// account provides the state of the account of the book if the
+	// collector supports it
+	account charont.AccountInt
+	// broker reports the real orders open on the broker if the collector
+	// supports it
+	broker            charont.BrokerOrdersInt
 	lastOpsToConsider int
 	tradesThatCanPlay int
+	units             int
 	tradersPlaying    map[int]hermes.Int
+	snapshotsDir      string
+	portfolio         *Portfolio
+	breaker           *Breaker
+	evolution         *evolution
+	allocation        *AllocationConf
+	// allocations contains the capital allocated to each playing trader
+	allocations map[int]float64
+	selection   SelectionPolicyInt
+	events      selectionEvents
+	listeners   traderListeners
+	// forced contains the traders started, true, or stopped, false, by the
+	// admin API, they are not managed by the selection policy
+	forced map[int]bool
+	// paused are the currencies paused by the admin API and disabled the
+	// ones removed from the config, no new entries are opened on both
+	paused   map[string]bool
+	disabled map[string]bool
+	auditor  *auditor
+	stopping bool
+}
+
+// TradersGroup defines a set of traders of the same type that are launched
+// for each one of the currencies, all the collector currencies are used if no
+// currencies are specified
+type TradersGroup struct {
+	Type       string
+	Traders    int
+	Currencies []string
+	Risk       *hermes.RiskLimits
+	Params     map[string]string
 }
 
 type SortTraders struct {
@@ -34,89 +79,316 @@ func (a TradersSortener) Len() int           { return len(a) }
 func (a TradersSortener) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
 func (a TradersSortener) Less(i, j int) bool { return a[i].Score > a[j].Score }
 
-func GetHades(trainer philoctetes.TrainerInt, traders int, from int, collector charont.Int, unitsToUse, samplesToConsiderer, lastOpsToConsider, tradesThatCanPlay, maxSecsToWait int) (hades *Hades) {
+// Conf contains the optional components of hades, each one of them is
+// disabled if its config is nil, and the traders are not persisted without
+// SnapshotsDir. The greedy selection is used by default
+type Conf struct {
+	SnapshotsDir string
+	SnapshotSecs int
+	Tracer       *hermes.Tracer
+	Portfolio    *PortfolioLimits
+	Selection    *SelectionConf
+	Breaker      *BreakerConf
+	Evolution    *EvolutionConf
+	Allocation   *AllocationConf
+	Book         *BookConf
+}
+
+func GetHades(trainer philoctetes.TrainerInt, groups []*TradersGroup, collector charont.Int, unitsToUse, lastOpsToConsider, tradesThatCanPlay int, conf *Conf) (hades *Hades, err error) {
+	if conf == nil {
+		conf = &Conf{}
+	}
 	hades = &Hades{
-		traders:           make([]hermes.Int, philoctetes.TrainersToRun*len(collector.GetCurrencies())),
+		traders:           []hermes.Int{},
+		groups:            groups,
+		trainer:           trainer,
+		tracer:            conf.Tracer,
 		collector:         collector,
 		tradesThatCanPlay: tradesThatCanPlay,
+		units:             unitsToUse,
 		lastOpsToConsider: lastOpsToConsider,
 		tradersPlaying:    make(map[int]hermes.Int),
+		snapshotsDir:      conf.SnapshotsDir,
+		forced:            make(map[int]bool),
+		paused:            make(map[string]bool),
+		disabled:          make(map[string]bool),
+	}
+	if conf.Book != nil {
+		hades.book = *conf.Book
+		log.Info("Launching the book:", conf.Book.Name, "First trader ID:", conf.Book.FirstTraderID)
+	}
+	if account, ok := collector.(charont.AccountInt); ok {
+		hades.account = account
+	}
+	if broker, ok := collector.(charont.BrokerOrdersInt); ok {
+		hades.broker = broker
+	}
+	selection := conf.Selection
+	if selection == nil {
+		selection = &SelectionConf{Policy: SelectionGreedy}
+	}
+	if selection.Window == 0 {
+		selection.Window = LastOpsToHaveInConsideration
+	}
+	if selection.MinOps == 0 {
+		selection.MinOps = lastOpsToConsider
+	}
+	if hades.selection, err = GetSelectionPolicy(selection); err != nil {
+		return nil, err
+	}
+	log.Info("Traders selection policy:", selection.Policy, "Window:", selection.Window, "Min ops:", selection.MinOps)
+
+	if conf.Allocation != nil {
+		if err = conf.Allocation.Validate(); err != nil {
+			return nil, err
+		}
+		hades.allocation = conf.Allocation
+		hades.allocations = make(map[int]float64)
+		log.Info("Capital allocation scheme:", conf.Allocation.Scheme, "Budget:", conf.Allocation.Budget)
+	}
+	if conf.Breaker != nil {
+		if err = conf.Breaker.Validate(); err != nil {
+			return nil, err
+		}
+		// the breaker is the closest to the broker in order to monitor only
+		// the requests that reach it
+		hades.breaker = GetBreaker(collector, conf.Breaker)
+		hades.breaker.onTrip = hades.breakerTripped
+		hades.breaker.onReset = hades.requestSelection
+		collector = hades.breaker
+		hades.collector = collector
+	}
+	if conf.Portfolio != nil {
+		if err = conf.Portfolio.Validate(); err != nil {
+			return nil, err
+		}
+		// all the orders of the traders are placed through the portfolio
+		// in order to apply the limits over the real ones
+		hades.portfolio = GetPortfolio(collector, conf.Portfolio)
+		collector = hades.portfolio
+		hades.collector = collector
+	}
+
+	if conf.Evolution != nil {
+		if hades.evolution, err = getEvolution(conf.Evolution, lastOpsToConsider); err != nil {
+			return nil, err
+		}
+	}
+	if err = hades.launchPopulation(); err != nil {
+		return nil, err
 	}
 
-	for i, curr := range collector.GetCurrencies() {
-		for t := 0; t < philoctetes.TrainersToRun; t++ {
-			log.Debug("Launching trader:", curr, "Id:", t, "TotalToLaunch:", len(hades.traders), i*t)
-			hades.traders[i*philoctetes.TrainersToRun+t] = hermes.GetWindowTrader(t, trainer, curr, collector, unitsToUse, samplesToConsiderer, maxSecsToWait)
+	if conf.SnapshotsDir != "" {
+		if err = os.MkdirAll(conf.SnapshotsDir, 0755); err != nil {
+			return nil, err
+		}
+		if err = hades.restoreTraders(); err != nil {
+			return nil, err
 		}
+		go hades.snapshotTraders(time.Duration(conf.SnapshotSecs) * time.Second)
+	}
+
+	hades.requestSelection()
+	for _, curr := range collector.GetCurrencies() {
+		collector.AddListerner(curr, hades.dispatchPrices)
 	}
 
 	go collector.Run()
-	go hades.manageTraders()
+	if hades.breaker != nil {
+		go hades.monitorBreaker()
+	}
+	if hades.evolution != nil {
+		go hades.evolvePopulation()
+	}
 
 	return
 }
 
-func (hades *Hades) manageTraders() {
-	c := time.Tick(100 * time.Millisecond)
-	for _ = range c {
-		canPlay := TradersSortener{}
-		for _, trader := range hades.traders {
-			//log.Debug("Checking trader to play:", trader.GetID(), "Ops:", trader.GetNumOps(), "Score:", trader.GetScore(LastOpsToHaveInConsideration), "Profit:", trader.GetTotalProfit())
-			if trader.GetNumOps() >= hades.lastOpsToConsider &&
-				trader.GetScore(LastOpsToHaveInConsideration) > 1 &&
-				trader.GetTotalProfit() > 1 {
-
-				canPlay = append(canPlay, &SortTraders{
-					Trader: trader,
-					Score:  trader.GetScore(LastOpsToHaveInConsideration),
-				})
-			}
+// restoreTraders loads the last snapshot of each trader, the traders that
+// were playing continue playing
+func (hades *Hades) restoreTraders() (err error) {
+	restored := 0
+	for _, trader := range hades.traders {
+		snap, err := hermes.LoadSnapshot(hades.snapshotsDir, trader.GetID())
+		if err != nil {
+			return err
 		}
-		sort.Sort(canPlay)
-
-		toStop := []int{}
-		for id, trader := range hades.tradersPlaying {
-			if trader.StopPlaying() {
-				toStop = append(toStop, id)
-			}
+		if snap == nil {
+			continue
 		}
 
-		for _, id := range toStop {
-			delete(hades.tradersPlaying, id)
-			fmt.Println("Trader can't play anylonger:", id)
+		if err = trader.Restore(snap); err != nil {
+			log.Error("The trader can't be restored, ignoring its snapshot, Error:", err)
+			continue
+		}
+		if snap.Playing {
+			hades.tradersPlaying[trader.GetID()] = trader
 		}
+		if hades.portfolio != nil {
+			hades.portfolio.trackOrders(trader.GetOpenOrders())
+		}
+		restored++
+	}
+	log.Info("Traders restored:", restored, "of:", len(hades.traders), "Playing:", len(hades.tradersPlaying))
 
-	addTradersLoop:
-		for _, newTrader := range canPlay {
-			if len(hades.tradersPlaying) > hades.tradesThatCanPlay {
-				break addTradersLoop
-			}
+	return
+}
 
-			if _, ok := hades.tradersPlaying[newTrader.Trader.GetID()]; !ok {
-				fmt.Println("New trader to play:", newTrader.Trader.GetID(), "Score:", newTrader.Score)
+func (hades *Hades) snapshotTraders(every time.Duration) {
+	if every <= 0 {
+		return
+	}
 
-				hades.tradersPlaying[newTrader.Trader.GetID()] = newTrader.Trader
-				newTrader.Trader.StartPlaying()
-			}
+	c := time.Tick(every)
+	for _ = range c {
+		hades.saveSnapshots()
+	}
+}
+
+// getTraders returns the managed traders, the population changes while the
+// traders evolve
+func (hades *Hades) getTraders() []hermes.Int {
+	hades.mutex.Lock()
+	defer hades.mutex.Unlock()
+
+	return append([]hermes.Int{}, hades.traders...)
+}
+
+func (hades *Hades) saveSnapshots() {
+	hades.saveSnapshotsPlaying(nil)
+}
+
+// saveSnapshotsPlaying stores the snapshots of the traders, if playing is
+// not nil it replaces the playing state of the traders
+func (hades *Hades) saveSnapshotsPlaying(playing map[int]bool) {
+	if hades.snapshotsDir == "" {
+		return
+	}
+
+	traders := hades.getTraders()
+	for _, trader := range traders {
+		snap := trader.Snapshot()
+		if playing != nil {
+			snap.Playing = playing[trader.GetID()]
+		}
+		if err := hermes.SaveSnapshot(hades.snapshotsDir, snap); err != nil {
+			log.Error("The snapshot of the trader:", trader.GetID(), "can't be stored, Error:", err)
 		}
 	}
+	if hades.evolution != nil {
+		hades.savePopulation()
+	}
+	log.Debug("Snapshots of:", len(traders), "traders stored on:", hades.snapshotsDir)
+}
+
+// GetPortfolioState returns the exposure of the real orders of all the
+// traders, nil if no portfolio limits are applied
+func (hades *Hades) GetPortfolioState() *PortfolioState {
+	if hades.portfolio == nil {
+		return nil
+	}
+
+	return hades.portfolio.GetState()
 }
 
-func (hades *Hades) CloseAllOpenOrdersAndFinish() {
-	hades.tradesThatCanPlay = 0
+// GetReconciliation returns the reconciliation report of the paper and live
+// results of all the traders
+func (hades *Hades) GetReconciliation() (report []*hermes.Reconciliation) {
+	for _, trader := range hades.getTraders() {
+		report = append(report, trader.Reconcile())
+	}
 
-	allFinished := false
-	for !allFinished {
-		time.Sleep(time.Second)
+	return
+}
 
-		allFinished = true
-		for _, trader := range hades.tradersPlaying {
-			if !trader.StopPlaying() {
-				log.Debug("Trader:", trader.GetID(), "still playing...")
-				allFinished = false
+// SaveReconciliation stores the reconciliation report of all the traders as
+// JSON on the given file
+func (hades *Hades) SaveReconciliation(path string) (err error) {
+	b, err := json.MarshalIndent(hades.GetReconciliation(), "", "  ")
+	if err != nil {
+		return
+	}
+
+	return ioutil.WriteFile(path, b, 0644)
+}
+
+// selectTraders starts the traders chosen by the selection policy and the
+// ones forced to play, and stops the others as soon as they have no open
+// positions. No trader plays while the circuit breaker is tripped. The
+// capital is allocated again across the playing traders on each call. It is
+// called with the prices that follow an event of a trader or a change of the
+// config, see newPrices
+func (hades *Hades) selectTraders() {
+	hades.mutex.Lock()
+	defer hades.mutex.Unlock()
+
+	if hades.stopping {
+		return
+	}
+
+	before := make(map[int]bool)
+	for id := range hades.tradersPlaying {
+		before[id] = true
+	}
+	defer hades.exportSelection(before)
+
+	if hades.breaker != nil && hades.breaker.IsTripped() {
+		hades.stopAllPlaying()
+		return
+	}
+
+	active := []hermes.Int{}
+	for _, trader := range hades.traders {
+		if trader.GetRiskState().State == hermes.TraderSuspended {
+			if trader.IsPlaying() {
+				log.Info("Playing trader suspended:", trader.GetID(), "State:", trader.GetRiskState())
 			}
+			continue
+		}
+		forced, ok := hades.forced[trader.GetID()]
+		if !ok {
+			active = append(active, trader)
+			continue
+		}
+		if _, playing := hades.tradersPlaying[trader.GetID()]; forced && !playing {
+			fmt.Println("Trader forced to play:", trader.GetID())
+
+			hades.tradersPlaying[trader.GetID()] = trader
+			trader.StartPlaying()
 		}
 	}
+	canPlay := hades.selection.Rank(active)
 
-	log.Debug("All the traders are done, close the system")
+	toStop := []int{}
+	for id, trader := range hades.tradersPlaying {
+		if hades.forced[id] {
+			continue
+		}
+		if trader.StopPlaying() {
+			toStop = append(toStop, id)
+		}
+	}
+
+	for _, id := range toStop {
+		delete(hades.tradersPlaying, id)
+		fmt.Println("Trader can't play anylonger:", id)
+	}
+
+addTradersLoop:
+	for _, newTrader := range canPlay {
+		if len(hades.tradersPlaying) > hades.tradesThatCanPlay {
+			break addTradersLoop
+		}
+
+		if _, ok := hades.tradersPlaying[newTrader.Trader.GetID()]; !ok {
+			fmt.Println("New trader to play:", newTrader.Trader.GetID(), "Score:", newTrader.Score)
+
+			hades.tradersPlaying[newTrader.Trader.GetID()] = newTrader.Trader
+			newTrader.Trader.StartPlaying()
+		}
+	}
+
+	if hades.allocation != nil {
+		hades.rebalance()
+	}
 }
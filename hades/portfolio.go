@@ -0,0 +1,306 @@
+package hades
+
+import (
+	"fmt"
+	"math"
+	"sync"
+
+	"github.com/alonsovidales/pit/log"
+	"github.com/alonsovidales/v/charont"
+	"github.com/alonsovidales/v/philoctetes"
+)
+
+const (
+	tsMultToSecs = 1000000000
+
+	RejectMaxOpenTrades         = "max-open-trades"
+	RejectMaxNetExposure        = "max-net-exposure"
+	RejectMaxGrossExposure      = "max-gross-exposure"
+	RejectMaxTotalNotional      = "max-total-notional"
+	RejectMaxCorrelatedExposure = "max-correlated-exposure"
+
+	// rejectionsToKeep is the number of the last rejections kept on the
+	// state of the portfolio
+	rejectionsToKeep = 100
+)
+
+// PortfolioLimits are the limits applied to all the real orders of all the
+// traders together, the exposures are expressed in units of the account
+// currency and all of them are disabled with the zero value
+type PortfolioLimits struct {
+	MaxOpenTrades         int
+	MaxNetExposure        float64
+	MaxGrossExposure      float64
+	MaxTotalNotional      float64
+	MaxCorrelatedExposure float64
+	// MinCorrelation is the min absolute correlation of the returns of two
+	// currencies to add their exposures, the correlation is measured on the
+	// last CorrelationWindowSecs resampled on CorrelationSamples points
+	MinCorrelation        float64
+	CorrelationWindowSecs int
+	CorrelationSamples    int
+}
+
+// Exposure is the exposure on a currency, Net is positive when the buys are
+// bigger than the sells
+type Exposure struct {
+	Net   float64 `json:"net"`
+	Gross float64 `json:"gross"`
+}
+
+// Rejection is a real order that was not sent to the broker
+type Rejection struct {
+	Ts     int64   `json:"ts"`
+	Curr   string  `json:"curr"`
+	Side   string  `json:"side"`
+	Units  int     `json:"units"`
+	Reason string  `json:"reason"`
+	Value  float64 `json:"value"`
+	Limit  float64 `json:"limit"`
+}
+
+// PortfolioState is the current exposure of the real orders and the last
+// rejected orders
+type PortfolioState struct {
+	OpenTrades    int                  `json:"open_trades"`
+	TotalNotional float64              `json:"total_notional"`
+	Exposures     map[string]*Exposure `json:"exposures"`
+	Rejected      int                  `json:"rejected"`
+	Rejections    []*Rejection         `json:"rejections"`
+}
+
+// RejectedError is returned when a real order is rejected by the portfolio
+// limits
+type RejectedError struct {
+	Rejection *Rejection
+}
+
+func (err *RejectedError) Error() string {
+	return fmt.Sprintf("hades: order rejected by %s, %f over %f", err.Rejection.Reason, err.Rejection.Value, err.Rejection.Limit)
+}
+
+// Portfolio wraps the collector used by the traders and approves or rejects
+// each real order before sending it to the broker, the simulated orders are
+// not considered
+type Portfolio struct {
+	charont.Int
+
+	mutex      sync.Mutex
+	limits     PortfolioLimits
+	openTrades map[*charont.Order]string
+	rejected   int
+	rejections []*Rejection
+}
+
+// Validate checks that the limits are consistent
+func (limits *PortfolioLimits) Validate() error {
+	if limits.MaxCorrelatedExposure > 0 && (limits.CorrelationWindowSecs <= 0 || limits.CorrelationSamples < 3) {
+		return fmt.Errorf("hades: the correlated exposure requires a positive window and at least three samples")
+	}
+
+	return nil
+}
+
+func GetPortfolio(collector charont.Int, limits *PortfolioLimits) (pf *Portfolio) {
+	pf = &Portfolio{
+		Int:        collector,
+		openTrades: make(map[*charont.Order]string),
+	}
+	if limits != nil {
+		pf.limits = *limits
+	}
+
+	return
+}
+
+func (pf *Portfolio) Buy(currency string, units int, bound float64, realOps bool, ts int64) (order *charont.Order, err error) {
+	return pf.placeOrder(currency, "buy", units, bound, realOps, ts)
+}
+
+func (pf *Portfolio) Sell(currency string, units int, bound float64, realOps bool, ts int64) (order *charont.Order, err error) {
+	return pf.placeOrder(currency, "sell", units, bound, realOps, ts)
+}
+
+func (pf *Portfolio) CloseOrder(ord *charont.Order, ts int64) (err error) {
+	if err = pf.Int.CloseOrder(ord, ts); err == nil {
+		pf.mutex.Lock()
+		delete(pf.openTrades, ord)
+		pf.mutex.Unlock()
+	}
+
+	return
+}
+
+func (pf *Portfolio) CloseAllOpenOrders() {
+	pf.Int.CloseAllOpenOrders()
+
+	pf.mutex.Lock()
+	pf.openTrades = make(map[*charont.Order]string)
+	pf.mutex.Unlock()
+}
+
+// trackOrders adds the real orders still open to the open trades, the orders
+// restored from the snapshots of the traders were not placed through the
+// portfolio
+func (pf *Portfolio) trackOrders(orders []*charont.Order) {
+	pf.mutex.Lock()
+	defer pf.mutex.Unlock()
+
+	for _, ord := range orders {
+		if ord.Real && ord.Open {
+			pf.openTrades[ord] = ord.Curr
+		}
+	}
+}
+
+// placeOrder checks the limits and sends the order to the broker, the mutex
+// is kept locked until the order is placed in order to avoid that two traders
+// exceed the limits at the same time
+func (pf *Portfolio) placeOrder(curr, side string, units int, bound float64, realOps bool, ts int64) (order *charont.Order, err error) {
+	if !realOps {
+		if side == "buy" {
+			return pf.Int.Buy(curr, units, bound, realOps, ts)
+		}
+		return pf.Int.Sell(curr, units, bound, realOps, ts)
+	}
+
+	pf.mutex.Lock()
+	defer pf.mutex.Unlock()
+
+	if rejection := pf.check(curr, side, units, ts); rejection != nil {
+		pf.reject(rejection)
+		return nil, &RejectedError{Rejection: rejection}
+	}
+
+	if side == "buy" {
+		order, err = pf.Int.Buy(curr, units, bound, realOps, ts)
+	} else {
+		order, err = pf.Int.Sell(curr, units, bound, realOps, ts)
+	}
+	if err == nil && order != nil {
+		pf.openTrades[order] = curr
+	}
+
+	return
+}
+
+func (pf *Portfolio) reject(rejection *Rejection) {
+	pf.rejected++
+	pf.rejections = append(pf.rejections, rejection)
+	if len(pf.rejections) > rejectionsToKeep {
+		pf.rejections = pf.rejections[len(pf.rejections)-rejectionsToKeep:]
+	}
+
+	log.Info("Order rejected by the portfolio limits, Curr:", rejection.Curr, "Side:", rejection.Side, "Units:", rejection.Units, "Reason:", rejection.Reason, "Value:", rejection.Value, "Limit:", rejection.Limit)
+}
+
+// exposures returns the exposure by currency and the total notional of the
+// open trades. The mutex has to be locked
+func (pf *Portfolio) exposures() (exposures map[string]*Exposure, notional float64) {
+	exposures = make(map[string]*Exposure)
+	for ord, curr := range pf.openTrades {
+		exp, ok := exposures[curr]
+		if !ok {
+			exp = &Exposure{}
+			exposures[curr] = exp
+		}
+
+		units := float64(ord.Units)
+		if ord.Type == "buy" {
+			exp.Net += units
+		} else {
+			exp.Net -= units
+		}
+		exp.Gross += units
+		notional += units
+	}
+
+	return
+}
+
+// check returns the rejection of the order if it exceeds any of the limits,
+// or nil if the order can be placed. The mutex has to be locked
+func (pf *Portfolio) check(curr, side string, units int, ts int64) *Rejection {
+	limits := pf.limits
+	exposures, notional := pf.exposures()
+	exp, ok := exposures[curr]
+	if !ok {
+		exp = &Exposure{}
+	}
+
+	signed := float64(units)
+	if side == "sell" {
+		signed = -signed
+	}
+	rejection := func(reason string, value, limit float64) *Rejection {
+		return &Rejection{
+			Ts:     ts,
+			Curr:   curr,
+			Side:   side,
+			Units:  units,
+			Reason: reason,
+			Value:  value,
+			Limit:  limit,
+		}
+	}
+
+	if limits.MaxOpenTrades > 0 && len(pf.openTrades)+1 > limits.MaxOpenTrades {
+		return rejection(RejectMaxOpenTrades, float64(len(pf.openTrades)+1), float64(limits.MaxOpenTrades))
+	}
+	if net := math.Abs(exp.Net + signed); limits.MaxNetExposure > 0 && net > limits.MaxNetExposure {
+		return rejection(RejectMaxNetExposure, net, limits.MaxNetExposure)
+	}
+	if gross := exp.Gross + float64(units); limits.MaxGrossExposure > 0 && gross > limits.MaxGrossExposure {
+		return rejection(RejectMaxGrossExposure, gross, limits.MaxGrossExposure)
+	}
+	if total := notional + float64(units); limits.MaxTotalNotional > 0 && total > limits.MaxTotalNotional {
+		return rejection(RejectMaxTotalNotional, total, limits.MaxTotalNotional)
+	}
+	if limits.MaxCorrelatedExposure > 0 {
+		if correlated := math.Abs(pf.correlatedExposure(curr, exp.Net+signed, exposures, ts)); correlated > limits.MaxCorrelatedExposure {
+			return rejection(RejectMaxCorrelatedExposure, correlated, limits.MaxCorrelatedExposure)
+		}
+	}
+
+	return nil
+}
+
+// correlatedExposure returns the net exposure on the currency plus the net
+// exposure of all the currencies correlated with it weighted by their
+// correlation, a long position on a currency with negative correlation
+// is equivalent to a short one
+func (pf *Portfolio) correlatedExposure(curr string, net float64, exposures map[string]*Exposure, ts int64) (correlated float64) {
+	correlated = net
+
+	currVals := pf.GetAllCurrVals()
+	from := ts - int64(pf.limits.CorrelationWindowSecs)*tsMultToSecs
+	for other, exp := range exposures {
+		if other == curr || exp.Net == 0 {
+			continue
+		}
+
+		corr, ok := philoctetes.ReturnsCorrelation(currVals[curr], currVals[other], from, ts, pf.limits.CorrelationSamples)
+		if !ok || math.Abs(corr) < pf.limits.MinCorrelation {
+			continue
+		}
+		correlated += corr * exp.Net
+	}
+
+	return
+}
+
+// GetState returns the current exposure of the real orders and the last
+// rejections
+func (pf *Portfolio) GetState() (state *PortfolioState) {
+	pf.mutex.Lock()
+	defer pf.mutex.Unlock()
+
+	state = &PortfolioState{
+		OpenTrades: len(pf.openTrades),
+		Rejected:   pf.rejected,
+		Rejections: append([]*Rejection{}, pf.rejections...),
+	}
+	state.Exposures, state.TotalNotional = pf.exposures()
+
+	return
+}
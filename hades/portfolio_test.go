@@ -0,0 +1,151 @@
+package hades
+
+import (
+	"testing"
+
+	"github.com/alonsovidales/v/charont"
+)
+
+type collectorTest struct {
+	charont.Int
+
+	vals         map[string][]*charont.CurrVal
+	brokerOrders []*charont.Order
+}
+
+func (ct *collectorTest) GetCurrencies() []string {
+	return []string{"EUR", "GBP"}
+}
+
+func (ct *collectorTest) GetBrokerOpenOrders() ([]*charont.Order, error) {
+	return ct.brokerOrders, nil
+}
+
+func (ct *collectorTest) GetAllCurrVals() map[string][]*charont.CurrVal {
+	return ct.vals
+}
+
+func (ct *collectorTest) placeOrder(curr, side string, units int, realOps bool, ts int64) (*charont.Order, error) {
+	return &charont.Order{Curr: curr, Type: side, Units: units, Real: realOps, Open: true, BuyTs: ts}, nil
+}
+
+func (ct *collectorTest) Buy(curr string, units int, bound float64, realOps bool, ts int64) (*charont.Order, error) {
+	return ct.placeOrder(curr, "buy", units, realOps, ts)
+}
+
+func (ct *collectorTest) Sell(curr string, units int, bound float64, realOps bool, ts int64) (*charont.Order, error) {
+	return ct.placeOrder(curr, "sell", units, realOps, ts)
+}
+
+func (ct *collectorTest) CloseOrder(ord *charont.Order, ts int64) error {
+	ord.Open = false
+	return nil
+}
+
+func rejectedBy(err error) string {
+	if rejected, ok := err.(*RejectedError); ok {
+		return rejected.Rejection.Reason
+	}
+
+	return ""
+}
+
+func TestPortfolioExposureLimits(t *testing.T) {
+	pf := GetPortfolio(&collectorTest{}, &PortfolioLimits{
+		MaxOpenTrades:    3,
+		MaxNetExposure:   100,
+		MaxGrossExposure: 150,
+		MaxTotalNotional: 200,
+	})
+
+	first, err := pf.Buy("EUR", 100, 0, true, 1)
+	if err != nil {
+		t.Fatal("The first order should be accepted:", err)
+	}
+	if _, err = pf.Buy("EUR", 10, 0, true, 2); rejectedBy(err) != RejectMaxNetExposure {
+		t.Error("The order should be rejected by the net exposure, Error:", err)
+	}
+	if _, err = pf.Buy("EUR", 10, 0, false, 2); err != nil {
+		t.Error("The simulated orders should not be checked, Error:", err)
+	}
+	if _, err = pf.Sell("EUR", 60, 0, true, 3); rejectedBy(err) != RejectMaxGrossExposure {
+		t.Error("The order should be rejected by the gross exposure, Error:", err)
+	}
+	if _, err = pf.Sell("EUR", 50, 0, true, 3); err != nil {
+		t.Error("The order reduces the net exposure and should be accepted:", err)
+	}
+	if _, err = pf.Buy("GBP", 60, 0, true, 4); rejectedBy(err) != RejectMaxTotalNotional {
+		t.Error("The order should be rejected by the total notional, Error:", err)
+	}
+	if _, err = pf.Buy("GBP", 10, 0, true, 4); err != nil {
+		t.Error("The order should be accepted:", err)
+	}
+	if _, err = pf.Buy("JPY", 10, 0, true, 5); rejectedBy(err) != RejectMaxOpenTrades {
+		t.Error("The order should be rejected by the max open trades, Error:", err)
+	}
+
+	if err = pf.CloseOrder(first, 6); err != nil {
+		t.Fatal("Problem closing the order:", err)
+	}
+	if _, err = pf.Buy("JPY", 10, 0, true, 7); err != nil {
+		t.Error("The order should be accepted after the close:", err)
+	}
+
+	state := pf.GetState()
+	if state.OpenTrades != 3 || state.TotalNotional != 70 || state.Exposures["EUR"].Net != -50 || state.Rejected != 4 || len(state.Rejections) != 4 {
+		t.Error("Unexpected portfolio state:", state)
+	}
+}
+
+func TestPortfolioCorrelatedExposure(t *testing.T) {
+	ct := &collectorTest{
+		vals: make(map[string][]*charont.CurrVal),
+	}
+	for i, price := range []float64{1, 1.02, 0.99, 1.03, 1.01, 1.05} {
+		ts := int64(i) * tsMultToSecs
+		ct.vals["EUR"] = append(ct.vals["EUR"], &charont.CurrVal{Ts: ts, Bid: price, Ask: price})
+		ct.vals["CHF"] = append(ct.vals["CHF"], &charont.CurrVal{Ts: ts, Bid: price * 0.9, Ask: price * 0.9})
+		ct.vals["JPY"] = append(ct.vals["JPY"], &charont.CurrVal{Ts: ts, Bid: 100 / price, Ask: 100 / price})
+	}
+
+	pf := GetPortfolio(ct, &PortfolioLimits{
+		MaxCorrelatedExposure: 150,
+		MinCorrelation:        0.8,
+		CorrelationWindowSecs: 5,
+		CorrelationSamples:    6,
+	})
+	ts := int64(5) * tsMultToSecs
+	if _, err := pf.Buy("EUR", 100, 0, true, ts); err != nil {
+		t.Fatal("The first order should be accepted:", err)
+	}
+	if _, err := pf.Buy("CHF", 100, 0, true, ts); rejectedBy(err) != RejectMaxCorrelatedExposure {
+		t.Error("The order should be rejected by the correlated exposure, Error:", err)
+	}
+	if _, err := pf.Buy("JPY", 100, 0, true, ts); err != nil {
+		t.Error("The order on an inversely correlated currency hedges the exposure and should be accepted:", err)
+	}
+}
+
+func TestPortfolioRestoredOrders(t *testing.T) {
+	pf := GetPortfolio(&collectorTest{}, &PortfolioLimits{MaxOpenTrades: 2})
+	restored := &charont.Order{Curr: "EUR", Type: "buy", Units: 10, Real: true, Open: true}
+	pf.trackOrders([]*charont.Order{
+		restored,
+		{Curr: "EUR", Type: "buy", Units: 10, Open: true},
+		{Curr: "GBP", Type: "sell", Units: 10, Real: true},
+	})
+	if state := pf.GetState(); state.OpenTrades != 1 || state.Exposures["EUR"].Net != 10 {
+		t.Fatal("Only the real orders still open should be tracked, State:", state)
+	}
+
+	if _, err := pf.Buy("GBP", 10, 0, true, 1); err != nil {
+		t.Fatal("The order should be accepted:", err)
+	}
+	if _, err := pf.Buy("GBP", 10, 0, true, 2); rejectedBy(err) != RejectMaxOpenTrades {
+		t.Error("The restored orders should count for the limits, Error:", err)
+	}
+	pf.CloseOrder(restored, 3)
+	if _, err := pf.Buy("GBP", 10, 0, true, 4); err != nil {
+		t.Error("The closed restored order shouldn't count for the limits, Error:", err)
+	}
+}
@@ -0,0 +1,139 @@
+package hades
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/alonsovidales/pit/log"
+	"github.com/alonsovidales/v/hermes"
+)
+
+// RuntimeConf contains the config that can be changed without restarting,
+// Risk contains the risk limits by trader type and Currencies the currencies
+// on which new entries can be opened, all of them have to be collected. Only
+// the values defined are applied, the nil ones keep the current values
+// including the ones changed by the admin API
+type RuntimeConf struct {
+	TradesThatCanPlay *int
+	Units             *int
+	Risk              map[string]*hermes.RiskLimits
+	Currencies        []string
+}
+
+// updatePaused pauses or resumes the new entries on the currency for all the
+// traders depending on whether it is paused or disabled, the mutex has to be
+// locked
+func (hades *Hades) updatePaused(curr string) {
+	paused := hades.paused[curr] || hades.disabled[curr]
+	for _, trader := range hades.traders {
+		trader.SetPaused(curr, paused)
+	}
+}
+
+// ApplyConf applies the changes of the runtime config, returns a description
+// of each applied change and an error with the ones rejected
+func (hades *Hades) ApplyConf(conf *RuntimeConf) (changes []string, err error) {
+	hades.mutex.Lock()
+	defer hades.mutex.Unlock()
+
+	rejected := []string{}
+	if conf.TradesThatCanPlay != nil && *conf.TradesThatCanPlay != hades.tradesThatCanPlay {
+		if *conf.TradesThatCanPlay < 0 {
+			rejected = append(rejected, fmt.Sprintf("invalid traders that can play: %d", *conf.TradesThatCanPlay))
+		} else if !hades.stopping {
+			changes = append(changes, fmt.Sprintf("traders that can play: %d -> %d", hades.tradesThatCanPlay, *conf.TradesThatCanPlay))
+			hades.tradesThatCanPlay = *conf.TradesThatCanPlay
+		}
+	}
+
+	if conf.Units != nil && *conf.Units != hades.units {
+		if *conf.Units < 1 {
+			rejected = append(rejected, fmt.Sprintf("invalid units: %d", *conf.Units))
+		} else {
+			changes = append(changes, fmt.Sprintf("units: %d -> %d", hades.units, *conf.Units))
+			hades.units = *conf.Units
+			for _, trader := range hades.traders {
+				trader.SetUnits(*conf.Units)
+			}
+		}
+	}
+
+	for typeName, limits := range conf.Risk {
+		if limits == nil {
+			continue
+		}
+		// the new traders of the group are launched with the new limits
+		for _, group := range hades.groups {
+			if group.Type == typeName {
+				group.Risk = limits
+			}
+		}
+		updated := 0
+		for _, trader := range hades.traders {
+			if trader.GetType() == typeName && trader.GetRiskLimits() != *limits {
+				trader.SetRiskLimits(*limits)
+				updated++
+			}
+		}
+		if updated > 0 {
+			changes = append(changes, fmt.Sprintf("risk limits of %d %s traders: %+v", updated, typeName, *limits))
+		}
+	}
+
+	if conf.Currencies != nil {
+		collected := make(map[string]bool)
+		for _, curr := range hades.collector.GetCurrencies() {
+			collected[curr] = true
+		}
+		enabled := make(map[string]bool)
+		unknown := []string{}
+		for _, curr := range conf.Currencies {
+			if !collected[curr] {
+				unknown = append(unknown, curr)
+			}
+			enabled[curr] = true
+		}
+
+		if len(unknown) > 0 {
+			rejected = append(rejected, fmt.Sprintf("currencies not collected, a restart is required: %s", strings.Join(unknown, ",")))
+		} else {
+			for curr := range collected {
+				if disabled := !enabled[curr]; disabled != hades.disabled[curr] {
+					if disabled {
+						hades.disabled[curr] = true
+						changes = append(changes, fmt.Sprintf("currency %s disabled", curr))
+					} else {
+						delete(hades.disabled, curr)
+						changes = append(changes, fmt.Sprintf("currency %s enabled", curr))
+					}
+					hades.updatePaused(curr)
+				}
+			}
+		}
+	}
+
+	if len(rejected) > 0 {
+		err = fmt.Errorf("hades: config changes rejected: %s", strings.Join(rejected, "; "))
+	}
+	if len(changes) > 0 {
+		hades.requestSelection()
+	}
+	if len(changes) > 0 || err != nil {
+		log.Info("Runtime config changes:", changes, "Rejected:", rejected)
+		if hades.auditor != nil {
+			entry := &AuditEntry{
+				Ts:     time.Now().Unix(),
+				Remote: "config",
+				Action: "config-reload",
+				Result: strings.Join(changes, ", "),
+			}
+			if err != nil {
+				entry.Error = err.Error()
+			}
+			hades.auditor.record(entry)
+		}
+	}
+
+	return
+}
@@ -0,0 +1,82 @@
+package hades
+
+import (
+	"testing"
+
+	"github.com/alonsovidales/v/hermes"
+)
+
+func (tt *traderTest) GetType() string {
+	if tt.id%2 == 0 {
+		return hermes.GridTraderType
+	}
+
+	return hermes.WindowTraderType
+}
+
+func (tt *traderTest) SetUnits(units int) {
+	tt.units = units
+}
+
+func (tt *traderTest) GetRiskLimits() hermes.RiskLimits {
+	return tt.risk
+}
+
+func (tt *traderTest) SetRiskLimits(limits hermes.RiskLimits) {
+	tt.risk = limits
+}
+
+func TestApplyConf(t *testing.T) {
+	traders := getTradersTest()
+	hades := &Hades{
+		traders:           traders,
+		collector:         &collectorTest{},
+		tradesThatCanPlay: 2,
+		units:             100,
+		paused:            map[string]bool{"GBP": true},
+		disabled:          make(map[string]bool),
+	}
+	hades.updatePaused("GBP")
+
+	tradesThatCanPlay, units := 4, 200
+	changes, err := hades.ApplyConf(&RuntimeConf{
+		TradesThatCanPlay: &tradesThatCanPlay,
+		Units:             &units,
+		Risk: map[string]*hermes.RiskLimits{
+			hermes.GridTraderType: {StopLoss: 0.01},
+		},
+		Currencies: []string{"GBP"},
+	})
+	if err != nil || len(changes) != 4 {
+		t.Fatal("All the changes should be applied, changes:", changes, "Error:", err)
+	}
+	if hades.tradesThatCanPlay != 4 || traders[1].(*traderTest).units != 200 {
+		t.Error("The traders that can play and the units should be changed")
+	}
+	if traders[0].GetRiskLimits().StopLoss != 0.01 || traders[1].GetRiskLimits().StopLoss != 0 {
+		t.Error("The risk limits should be changed only for the grid traders")
+	}
+	if !traders[0].(*traderTest).paused["EUR"] {
+		t.Error("The entries on the disabled currency should be paused")
+	}
+
+	changes, err = hades.ApplyConf(&RuntimeConf{
+		Currencies: []string{"EUR", "GBP", "JPY"},
+	})
+	if err == nil || len(changes) != 0 || !hades.disabled["EUR"] {
+		t.Error("The currencies that are not collected require a restart, changes:", changes, "Error:", err)
+	}
+
+	// the value changed by the admin API is kept if the config doesn't
+	// change it
+	hades.tradesThatCanPlay = 1
+	changes, err = hades.ApplyConf(&RuntimeConf{
+		Currencies: []string{"EUR", "GBP"},
+	})
+	if err != nil || len(changes) != 1 || traders[0].(*traderTest).paused["EUR"] || !traders[0].(*traderTest).paused["GBP"] {
+		t.Error("The currency should be enabled, keeping the paused ones, changes:", changes, "Error:", err)
+	}
+	if hades.tradesThatCanPlay != 1 || traders[1].(*traderTest).units != 200 {
+		t.Error("The values not defined shouldn't be changed, traders that can play:", hades.tradesThatCanPlay)
+	}
+}
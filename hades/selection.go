@@ -0,0 +1,353 @@
+package hades
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+
+	"github.com/alonsovidales/v/hermes"
+)
+
+const (
+	SelectionGreedy        = "greedy"
+	SelectionUCB1          = "ucb1"
+	SelectionThompson      = "thompson"
+	SelectionEpsilonGreedy = "epsilon-greedy"
+)
+
+// SelectionConf configures the policy used to choose the traders that play
+// with real orders. Only the last Window ops of each trader are evaluated,
+// all of them if Window is not positive, and the traders with less than
+// MinOps closed ops are never chosen
+type SelectionConf struct {
+	Policy string
+	Window int
+	MinOps int
+	// UCBExploration is the weight of the exploration term of UCB1, two by
+	// default
+	UCBExploration float64
+	// Epsilon is the initial probability to explore, decays multiplying it by
+	// EpsilonDecay on each op closed by the playing traders until MinEpsilon,
+	// without decay by default
+	Epsilon      float64
+	EpsilonDecay float64
+	MinEpsilon   float64
+	Seed         int64
+}
+
+// SelectionPolicyInt ranks the traders that can play, the first ones are
+// preferred
+type SelectionPolicyInt interface {
+	Rank(traders []hermes.Int) TradersSortener
+}
+
+// traderStats are the results of a trader on the evaluation window
+type traderStats struct {
+	trader      hermes.Int
+	numOps      int
+	ops         int
+	wins        int
+	score       float64
+	totalProfit float64
+}
+
+func GetSelectionPolicy(conf *SelectionConf) (SelectionPolicyInt, error) {
+	rnd := rand.New(rand.NewSource(conf.Seed))
+
+	switch conf.Policy {
+	case SelectionGreedy, "":
+		return &greedySelection{conf: conf, statsCache: newStatsCache()}, nil
+	case SelectionUCB1:
+		if conf.UCBExploration == 0 {
+			conf.UCBExploration = 2
+		}
+		if conf.UCBExploration < 0 {
+			return nil, fmt.Errorf("hades: the UCB1 exploration has to be positive")
+		}
+		return &ucb1Selection{conf: conf, statsCache: newStatsCache()}, nil
+	case SelectionThompson:
+		return &thompsonSelection{
+			conf:       conf,
+			statsCache: newStatsCache(),
+			rnd:        rnd,
+			samples:    make(map[int]float64),
+			ops:        make(map[int]int),
+		}, nil
+	case SelectionEpsilonGreedy:
+		if conf.EpsilonDecay == 0 {
+			conf.EpsilonDecay = 1
+		}
+		if conf.Epsilon < 0 || conf.Epsilon > 1 || conf.EpsilonDecay <= 0 || conf.EpsilonDecay > 1 {
+			return nil, fmt.Errorf("hades: the epsilon has to be between zero and one and the decay on (0, 1]")
+		}
+		return &epsilonGreedySelection{
+			conf:       conf,
+			statsCache: newStatsCache(),
+			rnd:        rnd,
+			numOps:     make(map[int]int),
+		}, nil
+	}
+
+	return nil, fmt.Errorf("hades: unknown selection policy: %s", conf.Policy)
+}
+
+// statsCache keeps the results of each trader until it closes a new op, the
+// traders are evaluated again only when their results change. Once the
+// events of the traders are notified with update only the traders with
+// events are evaluated again, before that the number of ops of each trader
+// is checked on each ranking. A nil cache evaluates all the traders each
+// time
+type statsCache struct {
+	entries map[int]*cachedStats
+	changed map[int]bool
+	all     bool
+	tracked bool
+}
+
+type cachedStats struct {
+	window int
+	stats  *traderStats
+}
+
+func newStatsCache() *statsCache {
+	return &statsCache{
+		entries: make(map[int]*cachedStats),
+	}
+}
+
+// update records the traders with events since the last ranking, all the
+// traders are evaluated again on the next ranking if all is true
+func (cache *statsCache) update(traders map[int]bool, all bool) {
+	if cache == nil {
+		return
+	}
+
+	cache.tracked = true
+	cache.all = cache.all || all
+	if cache.changed == nil {
+		cache.changed = make(map[int]bool)
+	}
+	for id := range traders {
+		cache.changed[id] = true
+	}
+}
+
+// cached returns the entry of the trader if it is still valid
+func (cache *statsCache) cached(trader hermes.Int, conf *SelectionConf) *cachedStats {
+	cached, ok := cache.entries[trader.GetID()]
+	if !ok || cached.stats.trader != trader || cached.window != conf.Window {
+		return nil
+	}
+	if cache.tracked {
+		if cache.all || cache.changed[trader.GetID()] {
+			return nil
+		}
+	} else if cached.stats.numOps != trader.GetNumOps() {
+		return nil
+	}
+
+	return cached
+}
+
+// getStats returns the results on the evaluation window of the traders with
+// enough ops
+func (cache *statsCache) getStats(traders []hermes.Int, conf *SelectionConf) (stats []*traderStats) {
+	var entries map[int]*cachedStats
+	if cache != nil {
+		entries = make(map[int]*cachedStats)
+		defer func() {
+			// the traders not evaluated, retired or suspended, are removed
+			cache.entries = entries
+			cache.changed, cache.all = nil, false
+		}()
+	}
+
+	for _, trader := range traders {
+		var entry *cachedStats
+		if cache != nil {
+			entry = cache.cached(trader, conf)
+		}
+		if entry == nil {
+			entry = &cachedStats{
+				window: conf.Window,
+				stats:  &traderStats{trader: trader, numOps: trader.GetNumOps()},
+			}
+			if entry.stats.numOps >= conf.MinOps {
+				entry.stats = traderStatsOf(trader, conf.Window)
+			}
+		}
+		if entries != nil {
+			entries[trader.GetID()] = entry
+		}
+		if entry.stats.numOps >= conf.MinOps && entry.stats.ops > 0 {
+			stats = append(stats, entry.stats)
+		}
+	}
+
+	return
+}
+
+// traderStatsOf evaluates the last window ops of the trader
+func traderStatsOf(trader hermes.Int, window int) (st *traderStats) {
+	st = &traderStats{
+		trader:      trader,
+		numOps:      trader.GetNumOps(),
+		score:       1,
+		totalProfit: trader.GetTotalProfit(),
+	}
+	for _, profit := range trader.GetLastProfits(window) {
+		st.ops++
+		st.score *= profit + 1
+		if profit > 0 {
+			st.wins++
+		}
+	}
+
+	return
+}
+
+func sortStats(stats []*traderStats, score func(st *traderStats) float64) (ranking TradersSortener) {
+	for _, st := range stats {
+		ranking = append(ranking, &SortTraders{
+			Trader: st.trader,
+			Score:  score(st),
+		})
+	}
+	sort.Sort(ranking)
+
+	return
+}
+
+// greedySelection chooses the traders with the best compounded profit on
+// the window, only if it and the total profit are positive
+type greedySelection struct {
+	conf *SelectionConf
+	*statsCache
+}
+
+func (sel *greedySelection) Rank(traders []hermes.Int) (ranking TradersSortener) {
+	return rankProfitable(sel.getStats(traders, sel.conf))
+}
+
+// rankProfitable sorts by the score on the window the traders with positive
+// score and total profit, the rest are discarded
+func rankProfitable(stats []*traderStats) TradersSortener {
+	var candidates []*traderStats
+	for _, st := range stats {
+		if st.score > 1 && st.totalProfit > 1 {
+			candidates = append(candidates, st)
+		}
+	}
+
+	return sortStats(candidates, func(st *traderStats) float64 {
+		return st.score
+	})
+}
+
+// ucb1Selection uses the win rate on the window as reward and prefers the
+// traders with the highest upper confidence bound, the traders with less ops
+// get a bigger bonus
+type ucb1Selection struct {
+	conf *SelectionConf
+	*statsCache
+}
+
+func (sel *ucb1Selection) Rank(traders []hermes.Int) TradersSortener {
+	stats := sel.getStats(traders, sel.conf)
+
+	total := 0
+	for _, st := range stats {
+		total += st.ops
+	}
+
+	return sortStats(stats, func(st *traderStats) float64 {
+		return float64(st.wins)/float64(st.ops) +
+			math.Sqrt(sel.conf.UCBExploration*math.Log(float64(total))/float64(st.ops))
+	})
+}
+
+// thompsonSelection draws the win rate of each trader from the Beta
+// distribution of its wins and losses on the window, a new value is drawn
+// only when the trader closes a new op
+type thompsonSelection struct {
+	conf *SelectionConf
+	*statsCache
+	rnd     *rand.Rand
+	samples map[int]float64
+	ops     map[int]int
+}
+
+// gamma draws a value from the Gamma distribution with an integer shape
+func gamma(rnd *rand.Rand, shape int) (value float64) {
+	for i := 0; i < shape; i++ {
+		value -= math.Log(1 - rnd.Float64())
+	}
+
+	return
+}
+
+func (sel *thompsonSelection) Rank(traders []hermes.Int) TradersSortener {
+	return sortStats(sel.getStats(traders, sel.conf), func(st *traderStats) float64 {
+		id := st.trader.GetID()
+		if sel.ops[id] != st.numOps {
+			wins := gamma(sel.rnd, st.wins+1)
+			sel.samples[id] = wins / (wins + gamma(sel.rnd, st.ops-st.wins+1))
+			sel.ops[id] = st.numOps
+		}
+
+		return sel.samples[id]
+	})
+}
+
+// epsilonGreedySelection ranks the traders as the greedy policy, but with
+// probability epsilon ranks them randomly in order to explore. The decision
+// is taken again only when a playing trader closes a new op, the ops closed
+// while playing are the ones that decay the epsilon
+type epsilonGreedySelection struct {
+	conf *SelectionConf
+	*statsCache
+	rnd *rand.Rand
+	// numOps are the ops of each trader on the last ranking
+	numOps  map[int]int
+	realOps int
+	decided bool
+	explore bool
+	order   map[int]float64
+}
+
+func (sel *epsilonGreedySelection) epsilon(realOps int) float64 {
+	return math.Max(sel.conf.MinEpsilon, sel.conf.Epsilon*math.Pow(sel.conf.EpsilonDecay, float64(realOps)))
+}
+
+func (sel *epsilonGreedySelection) Rank(traders []hermes.Int) TradersSortener {
+	newOps := false
+	numOps := make(map[int]int, len(traders))
+	for _, trader := range traders {
+		id := trader.GetID()
+		numOps[id] = trader.GetNumOps()
+		if last, ok := sel.numOps[id]; ok && numOps[id] > last && trader.IsPlaying() {
+			sel.realOps += numOps[id] - last
+			newOps = true
+		}
+	}
+	sel.numOps = numOps
+
+	if newOps || !sel.decided {
+		sel.decided = true
+		sel.explore = sel.rnd.Float64() < sel.epsilon(sel.realOps)
+		sel.order = make(map[int]float64)
+		for _, trader := range traders {
+			sel.order[trader.GetID()] = sel.rnd.Float64()
+		}
+	}
+
+	stats := sel.getStats(traders, sel.conf)
+	if sel.explore {
+		return sortStats(stats, func(st *traderStats) float64 {
+			return sel.order[st.trader.GetID()]
+		})
+	}
+
+	return rankProfitable(stats)
+}
@@ -0,0 +1,173 @@
+package hades
+
+import (
+	"testing"
+
+	"github.com/alonsovidales/v/charont"
+	"github.com/alonsovidales/v/hermes"
+)
+
+type traderTest struct {
+	hermes.Int
+
+	id      int
+	profits []float64
+	playing bool
+	paused  map[string]bool
+	open    []*charont.Order
+	livePl  float64
+	units   int
+	risk    hermes.RiskLimits
+	// failCloses is the number of calls to close the positions that fail
+	failCloses int
+	retired    bool
+	allocation float64
+}
+
+func (tt *traderTest) GetID() int {
+	return tt.id
+}
+
+func (tt *traderTest) GetNumOps() int {
+	return len(tt.profits)
+}
+
+func (tt *traderTest) GetLastProfits(lastOps int) []float64 {
+	if lastOps > 0 && len(tt.profits) > lastOps {
+		return tt.profits[len(tt.profits)-lastOps:]
+	}
+
+	return tt.profits
+}
+
+func (tt *traderTest) GetTotalProfit() (profit float64) {
+	profit = 1
+	for _, p := range tt.profits {
+		profit *= p + 1
+	}
+
+	return
+}
+
+func (tt *traderTest) GetScore(lastOps int) (score float64) {
+	score = 1
+	for _, p := range tt.GetLastProfits(lastOps) {
+		score *= p + 1
+	}
+
+	return
+}
+
+func getTradersTest() []hermes.Int {
+	return []hermes.Int{
+		// lucky streak after a long losing history
+		&traderTest{id: 0, profits: []float64{-0.1, -0.1, -0.1, 0.05, 0.05, 0.05}},
+		// consistent winner
+		&traderTest{id: 1, profits: []float64{0.01, 0.01, 0.01, 0.01, -0.01, 0.01, 0.01, 0.01, 0.01, 0.01, 0.01, 0.01}},
+		// new trader with few ops
+		&traderTest{id: 2, profits: []float64{0.01, -0.01}},
+		// losing trader
+		&traderTest{id: 3, profits: []float64{-0.01, -0.01, 0.01, -0.01, -0.01, -0.01}},
+	}
+}
+
+func rankedIDs(ranking TradersSortener) (ids []int) {
+	for _, st := range ranking {
+		ids = append(ids, st.Trader.GetID())
+	}
+
+	return
+}
+
+func TestGreedySelection(t *testing.T) {
+	policy, err := GetSelectionPolicy(&SelectionConf{Policy: SelectionGreedy, Window: 3, MinOps: 3})
+	if err != nil {
+		t.Fatal("Problem creating the policy:", err)
+	}
+
+	ids := rankedIDs(policy.Rank(getTradersTest()))
+	if len(ids) != 1 || ids[0] != 1 {
+		t.Error("Only the consistent winner has a positive score and total profit, ranking:", ids)
+	}
+}
+
+func TestUCB1Selection(t *testing.T) {
+	policy, err := GetSelectionPolicy(&SelectionConf{Policy: SelectionUCB1, Window: 20, MinOps: 2})
+	if err != nil {
+		t.Fatal("Problem creating the policy:", err)
+	}
+
+	ids := rankedIDs(policy.Rank(getTradersTest()))
+	if len(ids) != 4 || ids[0] != 2 || ids[3] != 3 {
+		t.Error("The trader with less ops should be explored first and the losing one the last, ranking:", ids)
+	}
+}
+
+func TestThompsonSelection(t *testing.T) {
+	policy, err := GetSelectionPolicy(&SelectionConf{Policy: SelectionThompson, Window: 20, MinOps: 3, Seed: 1})
+	if err != nil {
+		t.Fatal("Problem creating the policy:", err)
+	}
+
+	traders := getTradersTest()
+	first := rankedIDs(policy.Rank(traders))
+	if len(first) != 3 {
+		t.Fatal("The traders with less ops than the min should be ignored, ranking:", first)
+	}
+	if second := rankedIDs(policy.Rank(traders)); first[0] != second[0] || first[1] != second[1] || first[2] != second[2] {
+		t.Error("The samples should be kept until a new op is closed:", first, second)
+	}
+
+	wins := 0
+	for i := 0; i < 100; i++ {
+		tt := traders[1].(*traderTest)
+		tt.profits = append(tt.profits, tt.profits[len(tt.profits)-1])
+		if ids := rankedIDs(policy.Rank(traders)); ids[0] == 1 {
+			wins++
+		}
+	}
+	if wins < 80 {
+		t.Error("The consistent winner should be chosen most of the times, times:", wins)
+	}
+}
+
+func TestEpsilonGreedySelection(t *testing.T) {
+	traders := getTradersTest()
+	policy, err := GetSelectionPolicy(&SelectionConf{Policy: SelectionEpsilonGreedy, Window: 3, MinOps: 3, Epsilon: 1, Seed: 1})
+	if err != nil {
+		t.Fatal("Problem creating the policy:", err)
+	}
+
+	sel := policy.(*epsilonGreedySelection)
+	policy.Rank(traders)
+	if !sel.explore {
+		t.Error("With an epsilon of one the first ranking should explore")
+	}
+	sel.conf.EpsilonDecay = 0.5
+	if eps := sel.epsilon(26); eps > 0.0001 {
+		t.Error("The epsilon should decay with the ops, epsilon:", eps)
+	}
+
+	traders[3].(*traderTest).profits = append(traders[3].(*traderTest).profits, -0.01)
+	policy.Rank(traders)
+	if sel.realOps != 0 {
+		t.Error("The ops of the traders that are not playing shouldn't decay the epsilon, ops:", sel.realOps)
+	}
+	traders[1].(*traderTest).playing = true
+	traders[1].(*traderTest).profits = append(traders[1].(*traderTest).profits, 0.01, 0.01)
+	policy.Rank(traders)
+	if sel.realOps != 2 {
+		t.Error("The ops of the playing traders should decay the epsilon, ops:", sel.realOps)
+	}
+
+	sel.conf.Epsilon = 0
+	sel.decided = false
+	ids := rankedIDs(policy.Rank(traders))
+	if len(ids) != 1 || ids[0] != 1 {
+		t.Error("Without exploration only the profitable traders should be ranked as the greedy policy does, ranking:", ids)
+	}
+
+	if _, err = GetSelectionPolicy(&SelectionConf{Policy: "unknown"}); err == nil {
+		t.Error("An unknown policy should return an error")
+	}
+}
@@ -0,0 +1,234 @@
+package hades
+
+import (
+	"time"
+
+	"github.com/alonsovidales/pit/log"
+	"github.com/alonsovidales/v/charont"
+	"github.com/alonsovidales/v/hermes"
+)
+
+const (
+	shutdownPollInterval = time.Second
+	// defaultForceCloseSecs is used if no deadline is defined to force-close
+	// the positions
+	defaultForceCloseSecs = 60
+)
+
+// ShutdownConf defines the deadlines of the shutdown. The trainers have
+// GraceSecs to close the open positions, after it the remaining real positions
+// are closed through the broker retrying up to CloseRetries times, waiting
+// RetryWaitSecs between retries, for at most ForceCloseSecs
+type ShutdownConf struct {
+	GraceSecs      int
+	ForceCloseSecs int
+	CloseRetries   int
+	RetryWaitSecs  int
+}
+
+// TraderSummary contains the live results of a trader
+type TraderSummary struct {
+	ID         int              `json:"id"`
+	Type       string           `json:"type"`
+	Currencies []string         `json:"currencies"`
+	Live       hermes.PlSummary `json:"live"`
+}
+
+// ShutdownSummary is the final state after the shutdown, OpenOrders are the
+// real orders that couldn't be closed
+type ShutdownSummary struct {
+	Started          int64            `json:"started"`
+	Finished         int64            `json:"finished"`
+	ClosedByTrainers int              `json:"closed_by_trainers"`
+	ForceClosed      int              `json:"force_closed"`
+	OpenOrders       []*charont.Order `json:"open_orders"`
+	Ops              int              `json:"ops"`
+	Pl               float64          `json:"pl"`
+	Traders          []*TraderSummary `json:"traders"`
+}
+
+// stopPlaying stops the given traders, the ones with open positions continue
+// playing and are returned
+func (hades *Hades) stopPlaying(traders []hermes.Int) (remaining []hermes.Int) {
+	hades.mutex.Lock()
+	defer hades.mutex.Unlock()
+
+	for _, trader := range traders {
+		if !trader.StopPlaying() {
+			log.Debug("Trader:", trader.GetID(), "still playing...")
+			remaining = append(remaining, trader)
+			continue
+		}
+		delete(hades.tradersPlaying, trader.GetID())
+	}
+
+	return
+}
+
+func openPositions(traders []hermes.Int) (open int) {
+	for _, trader := range traders {
+		open += len(trader.GetOpenOrders())
+	}
+
+	return
+}
+
+// sleepUntil waits the given time without exceeding the deadline, returns
+// false if the deadline is reached
+func sleepUntil(wait time.Duration, deadline time.Time) bool {
+	if remaining := time.Until(deadline); remaining < wait {
+		wait = remaining
+	}
+	if wait > 0 {
+		time.Sleep(wait)
+	}
+
+	return time.Now().Before(deadline)
+}
+
+// closeBrokerOrders closes the real orders that the broker reports as open,
+// no more orders are closed after the deadline. Returns the number of orders
+// closed
+func (hades *Hades) closeBrokerOrders(deadline time.Time) (closed int) {
+	if hades.broker == nil {
+		return
+	}
+
+	orders, err := hades.broker.GetBrokerOpenOrders()
+	if err != nil {
+		log.Error("Shutdown: the open orders can't be obtained from the broker, Error:", err)
+		return
+	}
+	for i, ord := range orders {
+		if !time.Now().Before(deadline) {
+			log.Error("Shutdown: deadline reached, orders not closed on the broker:", len(orders)-i)
+			return
+		}
+		if err = hades.collector.CloseOrder(ord, time.Now().UnixNano()); err != nil {
+			log.Error("Shutdown: the order:", ord.Id, "can't be closed on the broker, Error:", err)
+			continue
+		}
+		closed++
+	}
+
+	return
+}
+
+// CloseAllOpenOrdersAndFinish stops the system in phases: the new entries
+// are stopped, the trainers have a grace period to close the positions of
+// the playing traders, the remaining positions are force-closed through the
+// broker and finally a summary of the positions and results is returned
+func (hades *Hades) CloseAllOpenOrdersAndFinish(conf *ShutdownConf) (summary *ShutdownSummary) {
+	if conf == nil {
+		conf = &ShutdownConf{}
+	}
+	summary = &ShutdownSummary{
+		Started:    time.Now().Unix(),
+		OpenOrders: []*charont.Order{},
+		Traders:    []*TraderSummary{},
+	}
+
+	hades.mutex.Lock()
+	hades.stopping = true
+	hades.tradesThatCanPlay = 0
+	hades.forced = make(map[int]bool)
+	playing := []hermes.Int{}
+	wasPlaying := make(map[int]bool)
+	for id, trader := range hades.tradersPlaying {
+		playing = append(playing, trader)
+		wasPlaying[id] = true
+	}
+	for _, trader := range hades.traders {
+		for _, curr := range hades.collector.GetCurrencies() {
+			trader.SetPaused(curr, true)
+		}
+	}
+	hades.mutex.Unlock()
+
+	// the traders that were playing continue playing after the restart
+	hades.saveSnapshotsPlaying(wasPlaying)
+	open := openPositions(playing)
+	log.Info("Shutdown: new entries stopped, playing traders:", len(playing), "Open positions:", open, "Grace secs:", conf.GraceSecs)
+
+	graceEnd := time.Now().Add(time.Duration(conf.GraceSecs) * time.Second)
+	remaining := hades.stopPlaying(playing)
+	for len(remaining) > 0 && sleepUntil(shutdownPollInterval, graceEnd) {
+		remaining = hades.stopPlaying(remaining)
+	}
+	remaining = hades.stopPlaying(remaining)
+	summary.ClosedByTrainers = open - openPositions(remaining)
+
+	forceCloseSecs := conf.ForceCloseSecs
+	if forceCloseSecs <= 0 {
+		forceCloseSecs = defaultForceCloseSecs
+	}
+	forceEnd := time.Now().Add(time.Duration(forceCloseSecs) * time.Second)
+	if len(remaining) > 0 {
+		log.Info("Shutdown: grace period finished, force-closing the positions of:", len(remaining), "traders")
+	}
+	for attempt := 0; len(remaining) > 0 && attempt <= conf.CloseRetries; attempt++ {
+		if attempt > 0 && !sleepUntil(time.Duration(conf.RetryWaitSecs)*time.Second, forceEnd) {
+			break
+		}
+		for _, trader := range remaining {
+			closed, err := trader.CloseAllPositions(hermes.CloseShutdown)
+			summary.ForceClosed += closed
+			if err != nil {
+				log.Error("Shutdown: the positions of the trader:", trader.GetID(), "can't be closed, Attempt:", attempt+1, "Error:", err)
+			}
+		}
+		remaining = hades.stopPlaying(remaining)
+	}
+
+	// the traders are retired so they don't use their orders while the real
+	// orders still open on the broker, including the ones not tracked by any
+	// trader, are closed. The closing stops once the deadline is reached
+	for _, trader := range hades.getTraders() {
+		trader.Retire()
+	}
+	done := make(chan int, 1)
+	go func() {
+		done <- hades.closeBrokerOrders(forceEnd)
+	}()
+	select {
+	case closed := <-done:
+		summary.ForceClosed += closed
+	case <-time.After(time.Until(forceEnd)):
+		log.Error("Shutdown: the open orders on the broker couldn't be closed before the deadline")
+	}
+
+	for _, trader := range remaining {
+		for _, ord := range trader.GetOpenOrders() {
+			if ord.Open {
+				summary.OpenOrders = append(summary.OpenOrders, ord)
+			}
+		}
+	}
+	for _, trader := range hades.getTraders() {
+		rec := trader.Reconcile()
+		if rec.Live.Ops == 0 {
+			continue
+		}
+		summary.Ops += rec.Live.Ops
+		summary.Pl += rec.Live.Pl
+		summary.Traders = append(summary.Traders, &TraderSummary{
+			ID:         rec.TraderID,
+			Type:       rec.Type,
+			Currencies: rec.Currencies,
+			Live:       rec.Live,
+		})
+		log.Info("Shutdown: trader:", rec.TraderID, "Type:", rec.Type, "Live ops:", rec.Live.Ops, "P&L:", rec.Live.Pl, "Profit:", rec.Live.Profit)
+	}
+	summary.Finished = time.Now().Unix()
+
+	hades.saveSnapshotsPlaying(wasPlaying)
+	if hades.auditor != nil {
+		hades.auditor.close()
+	}
+	if hades.evolution != nil && hades.evolution.lineage != nil {
+		hades.evolution.lineage.Close()
+	}
+	log.Info("Shutdown finished, Closed by the trainers:", summary.ClosedByTrainers, "Force-closed:", summary.ForceClosed, "Still open:", len(summary.OpenOrders), "Live ops:", summary.Ops, "P&L:", summary.Pl)
+
+	return
+}
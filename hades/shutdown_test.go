@@ -0,0 +1,97 @@
+package hades
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/alonsovidales/v/charont"
+	"github.com/alonsovidales/v/hermes"
+)
+
+func (tt *traderTest) GetOpenOrders() []*charont.Order {
+	return tt.open
+}
+
+func (tt *traderTest) CloseAllPositions(reason string) (closed int, err error) {
+	if tt.failCloses > 0 {
+		tt.failCloses--
+		return 0, fmt.Errorf("broker not available")
+	}
+	closed = len(tt.open)
+	tt.open = nil
+
+	return
+}
+
+func (tt *traderTest) Reconcile() *hermes.Reconciliation {
+	rec := &hermes.Reconciliation{TraderID: tt.id}
+	if tt.livePl != 0 {
+		rec.Live.Ops = len(tt.profits)
+		rec.Live.Pl = tt.livePl
+	}
+
+	return rec
+}
+
+func (tt *traderTest) Snapshot() *hermes.TraderSnapshot {
+	return &hermes.TraderSnapshot{ID: tt.id, Playing: tt.playing}
+}
+
+func TestShutdown(t *testing.T) {
+	traders := getTradersTest()
+	untracked := &charont.Order{Id: 9, Real: true, Open: true}
+	collector := &collectorTest{brokerOrders: []*charont.Order{untracked}}
+	hades := &Hades{
+		traders:        traders,
+		collector:      collector,
+		broker:         collector,
+		tradersPlaying: make(map[int]hermes.Int),
+		forced:         make(map[int]bool),
+		paused:         make(map[string]bool),
+		snapshotsDir:   t.TempDir(),
+	}
+	for _, trader := range traders[:3] {
+		trader.StartPlaying()
+		hades.tradersPlaying[trader.GetID()] = trader
+	}
+	traders[0].(*traderTest).open = []*charont.Order{{Id: 1}, {Id: 2}}
+	traders[1].(*traderTest).open = []*charont.Order{{Id: 3}}
+	traders[1].(*traderTest).failCloses = 1
+	traders[2].(*traderTest).open = []*charont.Order{{Id: 4, Open: true}}
+	traders[2].(*traderTest).failCloses = 5
+	traders[0].(*traderTest).livePl = 10
+	traders[1].(*traderTest).livePl = -4
+
+	summary := hades.CloseAllOpenOrdersAndFinish(&ShutdownConf{CloseRetries: 2})
+	if summary.ForceClosed != 4 || len(summary.OpenOrders) != 1 || summary.OpenOrders[0].Id != 4 {
+		t.Error("The positions should be force-closed with retries, summary:", summary)
+	}
+	if untracked.Open {
+		t.Error("The open orders reported by the broker should be closed")
+	}
+	for _, trader := range traders {
+		if !trader.(*traderTest).retired {
+			t.Error("The traders should be retired before closing the orders on the broker, trader:", trader.GetID())
+		}
+	}
+	if len(hades.tradersPlaying) != 1 || hades.tradersPlaying[2] == nil {
+		t.Error("Only the trader with open positions should be playing:", hades.tradersPlaying)
+	}
+	if !traders[3].(*traderTest).paused["EUR"] || !traders[3].(*traderTest).paused["GBP"] {
+		t.Error("The new entries should be paused on all the currencies")
+	}
+	if len(summary.Traders) != 2 || summary.Ops != 18 || summary.Pl != 6 {
+		t.Error("Unexpected results on the summary:", summary.Traders, summary.Ops, summary.Pl)
+	}
+
+	for id, playing := range []bool{true, true, true, false} {
+		if snap, err := hermes.LoadSnapshot(hades.snapshotsDir, id); err != nil || snap == nil || snap.Playing != playing {
+			t.Error("The snapshots should keep the traders playing before the shutdown, ID:", id, "Snapshot:", snap, "Error:", err)
+		}
+	}
+
+	hades.selectTraders()
+	if len(hades.tradersPlaying) != 1 {
+		t.Error("No traders should be started after the shutdown")
+	}
+}
@@ -0,0 +1,582 @@
+package hermes
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/alonsovidales/pit/log"
+	"github.com/alonsovidales/v/charont"
+	"github.com/alonsovidales/v/philoctetes"
+)
+
+// baseTrader contains the state shared by all the trader types, the open
+// positions and the history of the closed ones
+type baseTrader struct {
+	Int
+	*positionManager
+
+	id        int
+	typeName  string
+	curr      string
+	collector charont.Int
+	realOps   bool
+	ops       []*charont.Order
+	// closedLots are the closed lots of the entries that still have open
+	// lots, the entry is recorded as a single op once all of them are closed
+	closedLots map[int][]*charont.Order
+	exits      *ExitPolicies
+	sizing     *Sizing
+	// accountEquity is the last equity of the account obtained from the
+	// broker at equityTs, it is refreshed on background
+	accountEquity    float64
+	equityTs         time.Time
+	refreshingEquity bool
+	scorer           philoctetes.ScorerInt
+	explainer        philoctetes.ExplainerInt
+	tracer           *Tracer
+	throttle         *throttle
+	risk             *riskManager
+	metrics          *metricsCalc
+	// exportedPositions and exportedTs are the number of positions and the
+	// time of the last export of the positions
+	exportedPositions int
+	exportedTs        int64
+	retired           bool
+	onEvent           func(ev *Event)
+	// riskState is the risk state notified by the last event
+	riskState string
+	mutex     *sync.Mutex
+}
+
+// position is an open order, a lot of an entry, with the price that was used
+// to open it
+type position struct {
+	entry   int
+	curr    string
+	ord     *charont.Order
+	openVal *charont.CurrVal
+	exit    exitState
+}
+
+func newBaseTrader(typeName string, conf *TraderConf, limits *PositionLimits) (bt *baseTrader) {
+	bt = &baseTrader{
+		positionManager: newPositionManager(limits),
+
+		id:         conf.ID,
+		typeName:   typeName,
+		curr:       conf.Curr,
+		collector:  conf.Collector,
+		realOps:    false,
+		closedLots: make(map[int][]*charont.Order),
+		exits:      &ExitPolicies{},
+		sizing: &Sizing{
+			Mode:           SizingFixed,
+			Units:          conf.Units,
+			UnitsIncrement: 1,
+		},
+		risk:      newRiskManager(conf.Risk),
+		metrics:   newMetricsCalc(),
+		tracer:    conf.Tracer,
+		throttle:  newThrottle(nil),
+		onEvent:   conf.OnEvent,
+		riskState: TraderActive,
+		mutex:     new(sync.Mutex),
+	}
+	if scorer, ok := conf.Trainer.(philoctetes.ScorerInt); ok {
+		bt.scorer = scorer
+	}
+	if explainer, ok := conf.Trainer.(philoctetes.ExplainerInt); ok {
+		bt.explainer = explainer
+	}
+
+	return
+}
+
+func (bt *baseTrader) GetID() int {
+	return bt.id
+}
+
+func (bt *baseTrader) GetType() string {
+	return bt.typeName
+}
+
+func (bt *baseTrader) GetCurrencies() []string {
+	return []string{bt.curr}
+}
+
+func (bt *baseTrader) realOpsStr() string {
+	if bt.realOps {
+		return "Real"
+	}
+
+	return "Simulation"
+}
+
+// openPosition opens a new entry placing an order for each one of its lots,
+// the size of the entry is decided by the sizing strategy. The mutex has to be
+// locked
+func (bt *baseTrader) openPosition(curr, typeOper string, lastVal *charont.CurrVal) (entry []*position, err error) {
+	if reason := bt.throttle.blocked(curr, lastVal.Ts); reason != "" {
+		log.Debug("Entry blocked by the overtrading controls, Trader:", bt.id, "Curr:", curr, "Reason:", reason)
+		return nil, &ThrottledError{Reason: reason}
+	}
+
+	units := bt.entryUnits(curr, typeOper, lastVal)
+	if units < 1 {
+		log.Debug("Entry discarded by the sizing, Trader:", bt.id, "Curr:", curr, "Type:", typeOper, "Sizing:", bt.sizing.Mode)
+		return
+	}
+
+	bt.entries++
+	for _, units := range bt.lotsUnits(units, bt.sizing.UnitsIncrement) {
+		var pos *position
+		if pos, err = bt.placeLot(bt.entries, curr, typeOper, units, lastVal); err != nil {
+			break
+		}
+		entry = append(entry, pos)
+	}
+	if err != nil && len(entry) > 0 {
+		entry = bt.closePartialEntry(entry, lastVal)
+	}
+	if len(entry) > 0 {
+		bt.throttle.entryOpened(lastVal.Ts)
+	}
+
+	return
+}
+
+// closePartialEntry closes the lots placed for an entry that couldn't be
+// completely opened, returns the lots that couldn't be closed and remain open
+// as a partially filled entry. The mutex has to be locked
+func (bt *baseTrader) closePartialEntry(entry []*position, lastVal *charont.CurrVal) (open []*position) {
+	for _, pos := range entry {
+		if err := bt.closePosition(pos, lastVal, ClosePartialFill); err != nil {
+			log.Error("The lot of the partially filled entry can't be closed, Trader:", bt.id, "Curr:", pos.curr, "Order:", pos.ord.Id, "Error:", err)
+			open = append(open, pos)
+		}
+	}
+	if len(open) > 0 {
+		log.Error("Entry partially filled, Trader:", bt.id, "Curr:", entry[0].curr, "Open lots:", len(open), "Real:", bt.realOpsStr())
+	}
+
+	return
+}
+
+// placeLot places an order as a new lot of the given entry, the mutex has to
+// be locked
+func (bt *baseTrader) placeLot(entry int, curr, typeOper string, units int, lastVal *charont.CurrVal) (pos *position, err error) {
+	var ord *charont.Order
+
+	if typeOper == "buy" {
+		ord, err = bt.collector.Buy(curr, units, lastVal.Ask, bt.realOps, lastVal.Ts)
+	} else {
+		ord, err = bt.collector.Sell(curr, units, lastVal.Bid, bt.realOps, lastVal.Ts)
+	}
+	if err == nil && ord == nil {
+		err = fmt.Errorf("hermes: no order returned by the collector")
+	}
+	if err != nil {
+		log.Debug("The order can't be placed, Trader:", bt.id, "Curr:", curr, "Type:", typeOper, "Error:", err)
+		return
+	}
+
+	pos = &position{
+		entry:   entry,
+		curr:    curr,
+		ord:     ord,
+		openVal: lastVal,
+	}
+	bt.positions = append(bt.positions, pos)
+
+	return
+}
+
+// closePosition closes the order of the position recording the reason of the
+// close, once all the lots of the entry are closed the entry is moved to the
+// history of ops as a single op. The mutex has to be locked
+func (bt *baseTrader) closePosition(pos *position, lastVal *charont.CurrVal, reason string) (err error) {
+	if err = bt.collector.CloseOrder(pos.ord, lastVal.Ts); err != nil {
+		return
+	}
+	pos.ord.CloseReason = reason
+	bt.removePosition(pos)
+	bt.exportOpClosed(pos.ord)
+
+	lots := append(bt.closedLots[pos.entry], pos.ord)
+	for _, open := range bt.positions {
+		if open.entry == pos.entry {
+			bt.closedLots[pos.entry] = lots
+			return
+		}
+	}
+	delete(bt.closedLots, pos.entry)
+
+	op := entryOp(lots)
+	bt.ops = append(bt.ops, op)
+	bt.metrics.opClosed(op)
+	bt.throttle.opClosed(op.Curr, op.Profit, lastVal.Ts)
+	if bt.risk.opClosed(op.Profit, lastVal.Ts) {
+		log.Info("Trader suspended, ID:", bt.id, "Curr:", op.Curr, "State:", bt.risk.getState(), "Real:", bt.realOpsStr())
+	}
+	bt.emit(EventOpClosed)
+	bt.checkRiskChange()
+
+	return
+}
+
+// entryOp returns the op that records the closed lots of an entry. An entry
+// with several lots is recorded as a copy of its first lot with the lots as
+// legs, the profit ratio of the lots weighted by their units and the sum of
+// their results on the account currency
+func entryOp(lots []*charont.Order) *charont.Order {
+	if len(lots) == 1 {
+		return lots[0]
+	}
+
+	first := lots[0]
+	for _, lot := range lots[1:] {
+		if lot.BuyTs < first.BuyTs {
+			first = lot
+		}
+	}
+	op := *first
+	op.Legs = lots
+	op.Units = 0
+	op.Profit, op.Pl, op.SpreadCost, op.SlippageCost = 0, 0, 0, 0
+
+	var units float64
+	for _, lot := range lots {
+		if lot.Curr == op.Curr {
+			op.Units += lot.Units
+		}
+		if lot.SellTs > op.SellTs {
+			op.SellTs = lot.SellTs
+		}
+		op.Profit += lot.Profit * float64(lot.Units)
+		units += float64(lot.Units)
+		op.Pl += lot.Pl
+		op.SpreadCost += lot.SpreadCost
+		op.SlippageCost += lot.SlippageCost
+	}
+	op.Profit /= units
+	op.CloseReason = lots[len(lots)-1].CloseReason
+
+	return &op
+}
+
+// positionWin returns the current profit ratio of an open position
+func (bt *baseTrader) positionWin(pos *position, lastVal *charont.CurrVal) float64 {
+	if pos.ord.Type == "buy" {
+		return (lastVal.Bid / pos.ord.Price) - 1
+	}
+
+	return (pos.ord.CloseRate / lastVal.Ask) - 1
+}
+
+// checkRisk enforces the risk limits of the trader closing all the positions
+// if any limit is breached, returns true if the trader is suspended and can't
+// open new positions. The closed positions are recorded on the decision and
+// the changes of the risk state are notified. The mutex has to be locked
+func (bt *baseTrader) checkRisk(currVals map[string][]*charont.CurrVal, ts int64, decision *Decision) bool {
+	defer bt.checkRiskChange()
+
+	for _, pos := range bt.positions {
+		vals := currVals[pos.curr]
+		if len(vals) == 0 {
+			continue
+		}
+		if bt.risk.positionBreach(bt.positionWin(pos, vals[len(vals)-1]), ts) {
+			log.Info("Trader suspended, ID:", bt.id, "Curr:", pos.curr, "State:", bt.risk.getState(), "Real:", bt.realOpsStr())
+			break
+		}
+	}
+
+	if !bt.risk.suspended(ts) {
+		return false
+	}
+	decision.Reason = ReasonSuspended
+
+	for _, pos := range append([]*position{}, bt.positions...) {
+		vals := currVals[pos.curr]
+		if len(vals) == 0 {
+			continue
+		}
+		if err := bt.closePosition(pos, vals[len(vals)-1], CloseRisk); err != nil {
+			log.Error("The position of the suspended trader can't be closed, ID:", bt.id, "Order:", pos.ord.Id, "Error:", err)
+		} else {
+			decision.closed(pos, CloseRisk)
+		}
+	}
+
+	return true
+}
+
+// checkExits evaluates the exit policies for the lots of an entry, returns
+// the policy that decided to close and the lots to be closed. The mutex has to
+// be locked
+func (bt *baseTrader) checkExits(entry []*position, vals []*charont.CurrVal) (reason string, lots []*position) {
+	lastVal := vals[len(vals)-1]
+
+	return bt.exits.check(entry, bt.positionWin(entry[0], lastVal), lastVal, vals)
+}
+
+// GetThrottleState returns the state of the overtrading controls
+func (bt *baseTrader) GetThrottleState() ThrottleState {
+	bt.mutex.Lock()
+	defer bt.mutex.Unlock()
+
+	return bt.throttle.getState()
+}
+
+func (bt *baseTrader) GetRiskState() RiskState {
+	return bt.risk.getState()
+}
+
+func (bt *baseTrader) ResetRisk() {
+	bt.mutex.Lock()
+	defer bt.mutex.Unlock()
+
+	bt.risk.reset()
+	bt.checkRiskChange()
+}
+
+// GetRiskLimits returns the limits that suspend the trader
+func (bt *baseTrader) GetRiskLimits() RiskLimits {
+	return bt.risk.getLimits()
+}
+
+// SetRiskLimits replaces the limits that suspend the trader, the new limits
+// are checked with the next price or closed op
+func (bt *baseTrader) SetRiskLimits(limits RiskLimits) {
+	bt.risk.setLimits(limits)
+}
+
+// SetUnits changes the base units of the new entries
+func (bt *baseTrader) SetUnits(units int) {
+	bt.mutex.Lock()
+	defer bt.mutex.Unlock()
+
+	bt.sizing.Units = units
+}
+
+// SetAllocation sets the capital allocated to the trader on the account
+// currency, NoAllocation to use the configured sizing again
+func (bt *baseTrader) SetAllocation(capital float64) {
+	bt.mutex.Lock()
+	defer bt.mutex.Unlock()
+
+	bt.sizing.Allocated = capital >= 0
+	bt.sizing.Allocation = math.Max(capital, 0)
+}
+
+// SetPaused pauses or resumes the new entries on the currency, the open
+// positions are still managed
+func (bt *baseTrader) SetPaused(curr string, paused bool) {
+	bt.mutex.Lock()
+	defer bt.mutex.Unlock()
+
+	if paused {
+		bt.throttle.paused[curr] = true
+	} else {
+		delete(bt.throttle.paused, curr)
+	}
+}
+
+// GetOpenOrders returns the orders of the open positions
+func (bt *baseTrader) GetOpenOrders() (orders []*charont.Order) {
+	bt.mutex.Lock()
+	defer bt.mutex.Unlock()
+
+	for _, pos := range bt.positions {
+		orders = append(orders, pos.ord)
+	}
+
+	return
+}
+
+// closeAtLastPrice closes the position at the last known price of its
+// currency, the mutex has to be locked
+func (bt *baseTrader) closeAtLastPrice(pos *position, reason string) error {
+	vals := bt.collector.GetAllCurrVals()[pos.curr]
+	if len(vals) == 0 {
+		return fmt.Errorf("hermes: no prices for the currency %s", pos.curr)
+	}
+
+	return bt.closePosition(pos, vals[len(vals)-1], reason)
+}
+
+// CloseOrder closes the position of the given order, returns false if the
+// order is not open on this trader
+func (bt *baseTrader) CloseOrder(orderID int64) (found bool, err error) {
+	bt.mutex.Lock()
+	defer bt.mutex.Unlock()
+
+	for _, pos := range bt.positions {
+		if pos.ord.Id == orderID {
+			log.Info("Closing order manually, Trader:", bt.id, "Order:", orderID, "Real:", bt.realOpsStr())
+			return true, bt.closeAtLastPrice(pos, CloseManual)
+		}
+	}
+
+	return false, nil
+}
+
+// CloseAllPositions closes all the open positions recording the given reason,
+// returns the number of closed positions and the last error found
+func (bt *baseTrader) CloseAllPositions(reason string) (closed int, err error) {
+	bt.mutex.Lock()
+	defer bt.mutex.Unlock()
+
+	for _, pos := range append([]*position{}, bt.positions...) {
+		if closeErr := bt.closeAtLastPrice(pos, reason); closeErr != nil {
+			log.Error("The position can't be closed, Trader:", bt.id, "Order:", pos.ord.Id, "Error:", closeErr)
+			err = closeErr
+			continue
+		}
+		closed++
+	}
+
+	return
+}
+
+// Retire stops the evaluation of the new prices, the trader can't be used
+// again
+func (bt *baseTrader) Retire() {
+	bt.mutex.Lock()
+	defer bt.mutex.Unlock()
+
+	bt.retired = true
+	bt.realOps = false
+	bt.unexport()
+}
+
+func (bt *baseTrader) GetNumOps() int {
+	bt.mutex.Lock()
+	defer bt.mutex.Unlock()
+
+	return len(bt.ops)
+}
+
+func (bt *baseTrader) IsPlaying() bool {
+	bt.mutex.Lock()
+	defer bt.mutex.Unlock()
+
+	return bt.realOps
+}
+
+func (bt *baseTrader) StartPlaying() {
+	bt.mutex.Lock()
+	defer bt.mutex.Unlock()
+
+	bt.realOps = true
+}
+
+// StopPlaying stops the real orders if the trader has no open positions,
+// returns false if it has to continue playing until they are closed
+func (bt *baseTrader) StopPlaying() bool {
+	bt.mutex.Lock()
+	defer bt.mutex.Unlock()
+
+	if len(bt.positions) > 0 {
+		return false
+	}
+
+	bt.realOps = false
+	return true
+}
+
+func (bt *baseTrader) GetMetrics() Metrics {
+	return bt.metrics.getMetrics()
+}
+
+// GetMicsecsBetweenOps returns the avg time between the last closed ops, zero
+// if there are less than two ops
+func (bt *baseTrader) GetMicsecsBetweenOps(lastOps int) float64 {
+	var toStudy []*charont.Order
+
+	bt.mutex.Lock()
+	defer bt.mutex.Unlock()
+
+	if len(bt.ops) < 2 || lastOps < 2 {
+		return 0
+	}
+	if len(bt.ops) < lastOps {
+		toStudy = bt.ops
+	} else {
+		toStudy = bt.ops[len(bt.ops)-lastOps:]
+	}
+
+	fromTs := toStudy[0].SellTs
+	distance := int64(0)
+	for _, op := range toStudy[1:] {
+		distance += op.SellTs - fromTs
+		fromTs = op.SellTs
+	}
+
+	return (float64(distance) / float64(len(toStudy)-1))
+}
+
+func (bt *baseTrader) GetTotalProfit() float64 {
+	bt.mutex.Lock()
+	defer bt.mutex.Unlock()
+
+	return bt.totalProfit()
+}
+
+// totalProfit The mutex has to be locked
+func (bt *baseTrader) totalProfit() (profit float64) {
+	profit = 1
+	for _, op := range bt.ops {
+		if op != nil {
+			profit *= op.Profit + 1
+		}
+	}
+
+	return
+}
+
+// GetLastProfits returns the profit ratio of the last closed ops, all of them
+// if lastOps is not positive
+func (bt *baseTrader) GetLastProfits(lastOps int) (profits []float64) {
+	bt.mutex.Lock()
+	defer bt.mutex.Unlock()
+
+	toStudy := bt.ops
+	if lastOps > 0 && len(bt.ops) > lastOps {
+		toStudy = bt.ops[len(bt.ops)-lastOps:]
+	}
+
+	profits = make([]float64, len(toStudy))
+	for i, op := range toStudy {
+		profits[i] = op.Profit
+	}
+
+	return
+}
+
+func (bt *baseTrader) GetScore(lastOps int) float64 {
+	bt.mutex.Lock()
+	defer bt.mutex.Unlock()
+
+	return bt.score(lastOps)
+}
+
+// score The mutex has to be locked
+func (bt *baseTrader) score(lastOps int) (score float64) {
+	var toStudy []*charont.Order
+
+	if len(bt.ops) < lastOps {
+		toStudy = bt.ops
+	} else {
+		toStudy = bt.ops[len(bt.ops)-lastOps:]
+	}
+
+	score = 1
+	for _, op := range toStudy {
+		score *= op.Profit + 1
+	}
+
+	return
+}
@@ -0,0 +1,37 @@
+package hermes
+
+const (
+	EventOpClosed    = "op-closed"
+	EventRiskChanged = "risk-changed"
+)
+
+// Event notifies a change of a trader that can modify its selection, the
+// listener is called from the goroutine that processes the prices while the
+// trader is locked, so it can't block or call the trader
+type Event struct {
+	TraderID int
+	Type     string
+	// Risk is the risk state of the trader after the change
+	Risk string
+}
+
+// emit sends the event to the listener of the trader if any, the mutex has
+// to be locked
+func (bt *baseTrader) emit(eventType string) {
+	if bt.onEvent != nil {
+		bt.onEvent(&Event{
+			TraderID: bt.id,
+			Type:     eventType,
+			Risk:     bt.riskState,
+		})
+	}
+}
+
+// checkRiskChange emits an event if the risk state changed since the last
+// check, the mutex has to be locked
+func (bt *baseTrader) checkRiskChange() {
+	if state := bt.risk.getState().State; state != bt.riskState {
+		bt.riskState = state
+		bt.emit(EventRiskChanged)
+	}
+}
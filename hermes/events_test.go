@@ -0,0 +1,50 @@
+package hermes
+
+import (
+	"testing"
+
+	"github.com/alonsovidales/v/charont"
+)
+
+func TestEvents(t *testing.T) {
+	var events []*Event
+	collector := getCollectorTest()
+	bt := newBaseTrader("test", &TraderConf{
+		ID:        3,
+		Curr:      "USD",
+		Collector: collector,
+		Units:     10,
+		Risk:      &RiskLimits{MaxConsecutiveLosses: 2},
+		OnEvent: func(ev *Event) {
+			events = append(events, ev)
+		},
+	}, nil)
+
+	closeAt := func(price float64, ts int64) {
+		pos, err := bt.placeLot(1, "USD", "buy", 10, &charont.CurrVal{Ts: ts, Ask: 1, Bid: 1})
+		if err != nil {
+			t.Fatal("The order can't be placed:", err)
+		}
+		lastVal := &charont.CurrVal{Ts: ts + 1, Ask: price, Bid: price}
+		collector.vals["USD"] = []*charont.CurrVal{lastVal}
+		bt.closePosition(pos, lastVal, CloseTakeProfit)
+	}
+
+	closeAt(0.9, 1)
+	if len(events) != 1 || events[0].Type != EventOpClosed || events[0].TraderID != 3 || events[0].Risk != TraderActive {
+		t.Fatal("Only the closed op should be notified, events:", events)
+	}
+	closeAt(0.9, 3)
+	if len(events) != 3 || events[2].Type != EventRiskChanged || events[2].Risk != TraderSuspended {
+		t.Fatal("The suspension should be notified after the closed op, events:", events)
+	}
+
+	bt.checkRisk(collector.vals, 5, &Decision{})
+	if len(events) != 3 {
+		t.Error("The risk state didn't change, events:", events[3:])
+	}
+	bt.ResetRisk()
+	if len(events) != 4 || events[3].Type != EventRiskChanged || events[3].Risk != TraderActive {
+		t.Error("The reset should be notified, events:", events)
+	}
+}
@@ -0,0 +1,245 @@
+package hermes
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/alonsovidales/v/charont"
+)
+
+const (
+	CloseTrainer      = "trainer"
+	CloseRisk         = "risk"
+	CloseTrailingStop = "trailing-stop"
+	CloseBreakEven    = "break-even"
+	CloseTakeProfit   = "take-profit"
+	CloseStopLoss     = "stop-loss"
+	CloseTimeout      = "timeout"
+	CloseGridBroken   = "grid-broken"
+	CloseManual       = "manual"
+	CloseShutdown     = "shutdown"
+	CloseBreaker      = "breaker"
+	ClosePartialFill  = "partial-fill"
+
+	TrailingPips    = "pips"
+	TrailingATR     = "atr"
+	TrailingPercent = "percent"
+)
+
+// exitParams are the parameters to configure the exit policies, shared by all
+// the trader types that use them
+var exitParams = []Param{
+	{Name: "trailing-stop", Default: "0", Desc: "Distance of the trailing stop, in pips, ATRs or ratio of the price depending on the mode, zero to disable it"},
+	{Name: "trailing-mode", Default: TrailingPercent, Desc: "Units of the trailing stop distance: pips, atr or percent"},
+	{Name: "atr-samples", Default: "14", Desc: "Number of samples used to calculate the ATR"},
+	{Name: "break-even-after", Default: "0", Desc: "Profit ratio after which the stop is moved to the open price, zero to disable it"},
+	{Name: "break-even-offset", Default: "0", Desc: "Profit ratio over the open price where the break even stop is placed"},
+	{Name: "take-profits", Default: "", Desc: "Comma separated list of profit ratios, the lots of the entry are closed in equal parts on each one, the entries need a lot for each level"},
+}
+
+// ExitPolicies are the rules that close a position apart from the close signal
+// of the trainer, all of them are disabled with the zero value
+type ExitPolicies struct {
+	TrailingStop    float64
+	TrailingMode    string
+	ATRSamples      int
+	BreakEvenAfter  float64
+	BreakEvenOffset float64
+	TakeProfits     []float64
+}
+
+// exitState is the state of the exit policies for an open position
+type exitState struct {
+	peak       float64
+	stop       float64
+	stopReason string
+	tpLevel    int
+}
+
+func getExitPolicies(conf *TraderConf) (exits *ExitPolicies, err error) {
+	exits = &ExitPolicies{
+		TrailingMode: conf.Params["trailing-mode"],
+	}
+	if exits.TrailingStop, err = conf.GetFloat("trailing-stop"); err != nil {
+		return
+	}
+	if exits.ATRSamples, err = conf.GetInt("atr-samples"); err != nil {
+		return
+	}
+	if exits.BreakEvenAfter, err = conf.GetFloat("break-even-after"); err != nil {
+		return
+	}
+	if exits.BreakEvenOffset, err = conf.GetFloat("break-even-offset"); err != nil {
+		return
+	}
+	if tps := strings.TrimSpace(conf.Params["take-profits"]); tps != "" {
+		for _, tp := range strings.Split(tps, ",") {
+			level, err := strconv.ParseFloat(strings.TrimSpace(tp), 64)
+			if err != nil {
+				return nil, fmt.Errorf("hermes: invalid take profit level: %s", tp)
+			}
+			exits.TakeProfits = append(exits.TakeProfits, level)
+		}
+	}
+
+	return exits, exits.Validate()
+}
+
+// Validate checks that the policies are consistent
+func (exits *ExitPolicies) Validate() error {
+	switch exits.TrailingMode {
+	case "", TrailingPips, TrailingPercent:
+	case TrailingATR:
+		if exits.ATRSamples < 1 {
+			return fmt.Errorf("hermes: at least one sample is required to calculate the ATR")
+		}
+	default:
+		return fmt.Errorf("hermes: unknown trailing stop mode: %s", exits.TrailingMode)
+	}
+	for i, tp := range exits.TakeProfits {
+		if tp <= 0 || (i > 0 && tp <= exits.TakeProfits[i-1]) {
+			return fmt.Errorf("hermes: the take profit levels have to be positive and ascending")
+		}
+	}
+
+	return nil
+}
+
+// validateLots checks that the entries have at least a lot for each take
+// profit level, an entry of a single lot is completely closed on the first one
+func (exits *ExitPolicies) validateLots(lots int) error {
+	if len(exits.TakeProfits) > 1 && len(exits.TakeProfits) > lots {
+		return fmt.Errorf("hermes: %d take profit levels require at least as many lots, lots: %d", len(exits.TakeProfits), lots)
+	}
+
+	return nil
+}
+
+// pipSize returns the size of a pip for the currency pair
+func pipSize(curr string) float64 {
+	if strings.HasSuffix(curr, "JPY") {
+		return 0.01
+	}
+
+	return 0.0001
+}
+
+// atr returns the avg true range between the last samples as the avg of the
+// absolute variation of the mid price between ticks
+func atr(vals []*charont.CurrVal, samples int) float64 {
+	if len(vals) < 2 {
+		return 0
+	}
+	if len(vals) > samples+1 {
+		vals = vals[len(vals)-samples-1:]
+	}
+
+	total := 0.0
+	for i := 1; i < len(vals); i++ {
+		total += math.Abs((vals[i].Ask+vals[i].Bid)/2 - (vals[i-1].Ask+vals[i-1].Bid)/2)
+	}
+
+	return total / float64(len(vals)-1)
+}
+
+// trailingDist returns the distance in price of the trailing stop
+func (exits *ExitPolicies) trailingDist(curr string, price float64, vals []*charont.CurrVal) float64 {
+	switch exits.TrailingMode {
+	case TrailingPips:
+		return exits.TrailingStop * pipSize(curr)
+	case TrailingATR:
+		return exits.TrailingStop * atr(vals, exits.ATRSamples)
+	}
+
+	return exits.TrailingStop * price
+}
+
+// openPrice returns the price used to open the order
+func openPrice(ord *charont.Order) float64 {
+	if ord.Type == "buy" {
+		return ord.Price
+	}
+
+	return ord.CloseRate
+}
+
+// updateStop moves the stop of the position according to the trailing stop
+// and break even policies, the stop never moves against the position
+func (exits *ExitPolicies) updateStop(pos *position, lastVal *charont.CurrVal, vals []*charont.CurrVal) {
+	buy := pos.ord.Type == "buy"
+	price := lastVal.Ask
+	if buy {
+		price = lastVal.Bid
+	}
+	better := func(a, b float64) bool {
+		if buy {
+			return a > b
+		}
+		return a < b
+	}
+
+	if pos.exit.peak == 0 || better(price, pos.exit.peak) {
+		pos.exit.peak = price
+	}
+
+	if exits.TrailingStop > 0 {
+		dist := exits.trailingDist(pos.curr, pos.exit.peak, vals)
+		stop := pos.exit.peak - dist
+		if !buy {
+			stop = pos.exit.peak + dist
+		}
+		if dist > 0 && (pos.exit.stop == 0 || better(stop, pos.exit.stop)) {
+			pos.exit.stop = stop
+			pos.exit.stopReason = CloseTrailingStop
+		}
+	}
+
+	if exits.BreakEvenAfter > 0 {
+		open := openPrice(pos.ord)
+		stop := open * (1 + exits.BreakEvenOffset)
+		win := pos.exit.peak/open - 1
+		if !buy {
+			stop = open / (1 + exits.BreakEvenOffset)
+			win = open/pos.exit.peak - 1
+		}
+		if win >= exits.BreakEvenAfter && (pos.exit.stop == 0 || better(stop, pos.exit.stop)) {
+			pos.exit.stop = stop
+			pos.exit.stopReason = CloseBreakEven
+		}
+	}
+}
+
+// check evaluates the policies for all the lots of an entry, returns the
+// policy that decided to close and the lots to be closed
+func (exits *ExitPolicies) check(entry []*position, win float64, lastVal *charont.CurrVal, vals []*charont.CurrVal) (reason string, lots []*position) {
+	for _, pos := range entry {
+		exits.updateStop(pos, lastVal, vals)
+	}
+
+	pos := entry[0]
+	if pos.exit.stop != 0 {
+		if (pos.ord.Type == "buy" && lastVal.Bid <= pos.exit.stop) ||
+			(pos.ord.Type == "sell" && lastVal.Ask >= pos.exit.stop) {
+			return pos.exit.stopReason, entry
+		}
+	}
+
+	levels := len(exits.TakeProfits)
+	if pos.exit.tpLevel < levels && win >= exits.TakeProfits[pos.exit.tpLevel] {
+		toClose := int(math.Ceil(float64(len(entry)) / float64(levels-pos.exit.tpLevel)))
+
+		return CloseTakeProfit, entry[:toClose]
+	}
+
+	return "", nil
+}
+
+// nextTakeProfit moves the lots of the entry to the next take profit level,
+// it has to be called once the lots of the current level are closed
+func (exits *ExitPolicies) nextTakeProfit(entry []*position) {
+	for _, lot := range entry {
+		lot.exit.tpLevel++
+	}
+}
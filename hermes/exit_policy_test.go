@@ -0,0 +1,62 @@
+package hermes
+
+import (
+	"testing"
+
+	"github.com/alonsovidales/v/charont"
+)
+
+func TestExitPolicies(t *testing.T) {
+	collector := getCollectorTest()
+	bt := newBaseTrader("test", &TraderConf{
+		ID:        1,
+		Curr:      "EURUSD",
+		Collector: collector,
+		Units:     4,
+	}, &PositionLimits{Lots: 4})
+	bt.exits = &ExitPolicies{
+		TrailingStop:   0.01,
+		TrailingMode:   TrailingPercent,
+		BreakEvenAfter: 0.005,
+		TakeProfits:    []float64{0.02, 0.04},
+	}
+
+	addVal := func(price float64) (reason string, lots []*position) {
+		collector.vals["EURUSD"] = append(collector.vals["EURUSD"], &charont.CurrVal{Ask: price, Bid: price})
+		return bt.checkExits(bt.positions, collector.vals["EURUSD"])
+	}
+
+	collector.vals["EURUSD"] = []*charont.CurrVal{{Ask: 1, Bid: 1}}
+	bt.openPosition("EURUSD", "buy", collector.vals["EURUSD"][0])
+
+	if reason, _ := addVal(1.006); reason != "" {
+		t.Fatal("No exit expected, Reason:", reason)
+	}
+	if bt.positions[0].exit.stopReason != CloseBreakEven || bt.positions[0].exit.stop != 1 {
+		t.Error("The stop should be moved to break even, Stop:", bt.positions[0].exit.stop, "Reason:", bt.positions[0].exit.stopReason)
+	}
+
+	reason, lots := addVal(1.021)
+	if reason != CloseTakeProfit || len(lots) != 2 {
+		t.Fatal("Half of the lots should be closed by the first take profit, Reason:", reason, "Lots:", len(lots))
+	}
+	if reason, lots := bt.checkExits(bt.positions, collector.vals["EURUSD"]); reason != CloseTakeProfit || len(lots) != 2 {
+		t.Fatal("The take profit level shouldn't change until its lots are closed, Reason:", reason, "Lots:", len(lots))
+	}
+	closed := append([]*position{}, lots...)
+	for _, pos := range closed {
+		bt.closePosition(pos, collector.vals["EURUSD"][2], reason)
+	}
+	bt.exits.nextTakeProfit(bt.positions)
+	if closed[0].ord.CloseReason != CloseTakeProfit || len(bt.ops) != 0 {
+		t.Error("The close reason was not recorded or the entry was recorded before closing all its lots, Reason:", closed[0].ord.CloseReason, "Ops:", len(bt.ops))
+	}
+
+	if reason, _ := addVal(1.03); reason != "" {
+		t.Fatal("No exit expected, Reason:", reason)
+	}
+	reason, lots = addVal(1.019)
+	if reason != CloseTrailingStop || len(lots) != 2 {
+		t.Error("The trailing stop should close the remaining lots, Reason:", reason, "Lots:", len(lots))
+	}
+}
@@ -0,0 +1,59 @@
+package hermes
+
+import (
+	"strconv"
+
+	"github.com/alonsovidales/v/argos"
+	"github.com/alonsovidales/v/charont"
+)
+
+// positionsExportSecs is the max number of seconds between the exports of
+// the unrealized P&L of the positions
+const positionsExportSecs = 5
+
+var (
+	openPositionsGauge = argos.GetGauge("v_hermes_open_positions", "Open positions by trader", "trader")
+	realizedPl         = argos.GetGauge("v_hermes_realized_pl", "Realized P&L on the account currency by trader", "trader", "real")
+	unrealizedPl       = argos.GetGauge("v_hermes_unrealized_pl", "Unrealized P&L of the open positions on the account currency by trader", "trader")
+)
+
+// exportOpClosed adds the P&L of the closed op to the realized one, the
+// mutex has to be locked
+func (bt *baseTrader) exportOpClosed(op *charont.Order) {
+	if bt.retired {
+		return
+	}
+
+	realizedPl.Add(op.FillPl(), strconv.Itoa(bt.id), strconv.FormatBool(op.Real))
+}
+
+// exportPositions updates the open positions and its unrealized P&L using
+// the last price of each currency, they are exported when the positions
+// change or each positionsExportSecs. The mutex has to be locked
+func (bt *baseTrader) exportPositions(currVals map[string][]*charont.CurrVal, ts int64) {
+	if bt.retired || (len(bt.positions) == bt.exportedPositions && ts-bt.exportedTs < positionsExportSecs*tsMultToSecs) {
+		return
+	}
+	bt.exportedPositions = len(bt.positions)
+	bt.exportedTs = ts
+
+	pl := 0.0
+	for _, pos := range bt.positions {
+		vals := currVals[pos.curr]
+		if len(vals) == 0 {
+			continue
+		}
+		pl += pos.ord.OpenPl(vals[len(vals)-1])
+	}
+
+	openPositionsGauge.Set(float64(len(bt.positions)), strconv.Itoa(bt.id))
+	unrealizedPl.Set(pl, strconv.Itoa(bt.id))
+}
+
+// unexport removes the series of the trader, the mutex has to be locked
+func (bt *baseTrader) unexport() {
+	id := strconv.Itoa(bt.id)
+	openPositionsGauge.Delete(id)
+	realizedPl.Delete(id)
+	unrealizedPl.Delete(id)
+}
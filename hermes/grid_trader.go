@@ -0,0 +1,147 @@
+package hermes
+
+import (
+	"fmt"
+
+	"github.com/alonsovidales/pit/log"
+	"github.com/alonsovidales/v/charont"
+)
+
+const (
+	GridTraderType = "grid"
+)
+
+func init() {
+	Register(&TraderType{
+		Name: GridTraderType,
+		Desc: "Opens a position each time that the price moves a step against the last one, each position takes profit after a step in favour",
+		Params: withParams([]Param{
+			{Name: "side", Default: "buy", Desc: "Side of the positions to open: buy or sell"},
+			{Name: "step", Default: "0.0005", Desc: "Distance between the levels of the grid as a ratio of the price"},
+			{Name: "levels", Default: "5", Desc: "Max number of levels, and positions, of the grid"},
+		}, sizingParams, throttleParams),
+		Build: func(conf *TraderConf) (Int, error) {
+			side := conf.Params["side"]
+			if side != "buy" && side != "sell" {
+				return nil, fmt.Errorf("hermes: invalid side for the grid trader: %s", side)
+			}
+			step, err := conf.GetFloat("step")
+			if err != nil {
+				return nil, err
+			}
+			levels, err := conf.GetInt("levels")
+			if err != nil {
+				return nil, err
+			}
+			sizing, err := getSizing(conf)
+			if err != nil {
+				return nil, err
+			}
+			throttleLimits, err := getThrottleLimits(conf)
+			if err != nil {
+				return nil, err
+			}
+
+			gt := GetGridTrader(conf, side, step, levels)
+			gt.sizing = sizing
+			gt.throttle = newThrottle(throttleLimits)
+
+			return gt, nil
+		},
+	})
+}
+
+// gridTrader doesn't use the trainer, it opens positions on fixed levels
+// around a reference price. When the price goes beyond the last level all the
+// positions are closed in order to limit the loss
+type gridTrader struct {
+	*baseTrader
+
+	side     string
+	step     float64
+	levels   int
+	refPrice float64
+}
+
+func GetGridTrader(conf *TraderConf, side string, step float64, levels int) (gt *gridTrader) {
+	gt = &gridTrader{
+		baseTrader: newBaseTrader(GridTraderType, conf, &PositionLimits{
+			MaxEntries: levels,
+			ScaleIn:    true,
+		}),
+		side:   side,
+		step:   step,
+		levels: levels,
+	}
+
+	conf.Collector.AddListerner(conf.Curr, gt.NewPrices)
+
+	return
+}
+
+// favourMove returns the relative move of the price in favour of the side of
+// the grid from the given price
+func (gt *gridTrader) favourMove(from float64, lastVal *charont.CurrVal) float64 {
+	if gt.side == "buy" {
+		return lastVal.Bid/from - 1
+	}
+
+	return from/lastVal.Ask - 1
+}
+
+func (gt *gridTrader) NewPrices(curr string, ts int64) {
+	gt.mutex.Lock()
+	defer gt.mutex.Unlock()
+
+	if gt.retired {
+		return
+	}
+	currVals := gt.collector.GetAllCurrVals()
+	lastVal := currVals[curr][len(currVals[curr])-1]
+	decision := gt.newDecision(curr, lastVal)
+	defer gt.trace(decision, currVals)
+	defer gt.exportPositions(currVals, lastVal.Ts)
+	if gt.checkRisk(currVals, lastVal.Ts, decision) {
+		return
+	}
+
+	if len(gt.positions) == 0 {
+		gt.refPrice = lastVal.Ask
+		if gt.side == "sell" {
+			gt.refPrice = lastVal.Bid
+		}
+	}
+
+	// The price went out of the grid, close everything
+	if gt.favourMove(gt.refPrice, lastVal) < -gt.step*float64(gt.levels+1) {
+		log.Debug("Grid broken, Trader:", gt.id, "Curr:", curr, "Ref price:", gt.refPrice, "Positions:", len(gt.positions))
+		for _, pos := range append([]*position{}, gt.positions...) {
+			if err := gt.closePosition(pos, lastVal, CloseGridBroken); err == nil {
+				decision.closed(pos, CloseGridBroken)
+			}
+		}
+		return
+	}
+
+	for _, pos := range append([]*position{}, gt.positions...) {
+		openPrice := pos.ord.Price
+		if gt.side == "sell" {
+			openPrice = pos.ord.CloseRate
+		}
+		if gt.favourMove(openPrice, lastVal) >= gt.step {
+			if err := gt.closePosition(pos, lastVal, CloseTakeProfit); err == nil {
+				log.Debug("Grid take profit, Trader:", gt.id, "Curr:", curr, "Profit:", pos.ord.Profit, "Real:", gt.realOpsStr())
+				decision.closed(pos, CloseTakeProfit)
+			}
+		}
+	}
+
+	// Open a new position each time that the price reaches the next level
+	level := len(gt.positions)
+	if level < gt.levels && gt.favourMove(gt.refPrice, lastVal) <= -gt.step*float64(level) {
+		log.Debug("Grid level reached, Trader:", gt.id, "Curr:", curr, "Level:", level, "Real:", gt.realOpsStr())
+		decision.Reason = ReasonGridLevel
+		entry, err := gt.openPosition(curr, gt.side, lastVal)
+		decision.opened(gt.side, entry, err)
+	}
+}
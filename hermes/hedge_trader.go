@@ -0,0 +1,321 @@
+package hermes
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/alonsovidales/pit/log"
+	"github.com/alonsovidales/v/philoctetes"
+)
+
+const (
+	HedgeTraderType = "hedge"
+
+	HedgeCorrelation   = "correlation"
+	HedgeCointegration = "cointegration"
+)
+
+func init() {
+	Register(&TraderType{
+		Name: HedgeTraderType,
+		Desc: "Opens a position when the trainer says so and hedges it on the most correlated or cointegrated currency when the price moves against it, both legs are closed together",
+		Params: withParams([]Param{
+			{Name: "hedge-method", Default: HedgeCorrelation, Desc: "Method to choose the hedge currency: correlation or cointegration"},
+			{Name: "hedge-trigger", Default: "0.001", Desc: "Loss ratio of the primary position that opens the hedge"},
+			{Name: "hedge-ratio", Default: "1", Desc: "Units of the hedge per unit of the primary position, multiplied by the beta between both currencies"},
+			{Name: "min-correlation", Default: "0.7", Desc: "Min absolute correlation of the returns to use a currency as hedge"},
+			{Name: "max-adf-stat", Default: "-2.86", Desc: "Max Dickey Fuller statistic of the spread to considerer two currencies cointegrated"},
+			{Name: "window-secs", Default: "3600", Desc: "Seconds of history used to measure the relation between currencies"},
+			{Name: "window-samples", Default: "60", Desc: "Number of points on which the history is resampled"},
+			{Name: "take-profit", Default: "0.001", Desc: "Combined profit ratio to close the trade"},
+			{Name: "stop-loss", Default: "0.003", Desc: "Combined loss ratio to close the trade"},
+			{Name: "max-secs", Default: "3600", Desc: "Max seconds to keep the trade open"},
+		}, sizingParams, throttleParams),
+		Build: func(conf *TraderConf) (Int, error) {
+			ht := &hedgeTrader{
+				method: conf.Params["hedge-method"],
+			}
+			if ht.method != HedgeCorrelation && ht.method != HedgeCointegration {
+				return nil, fmt.Errorf("hermes: unknown hedge method: %s", ht.method)
+			}
+
+			var err error
+			for name, val := range map[string]*float64{
+				"hedge-trigger":   &ht.trigger,
+				"hedge-ratio":     &ht.ratio,
+				"min-correlation": &ht.minCorrelation,
+				"max-adf-stat":    &ht.maxAdfStat,
+				"take-profit":     &ht.takeProfit,
+				"stop-loss":       &ht.stopLoss,
+			} {
+				if *val, err = conf.GetFloat(name); err != nil {
+					return nil, err
+				}
+			}
+			for name, val := range map[string]*int{
+				"window-secs":    &ht.windowSecs,
+				"window-samples": &ht.windowSamples,
+				"max-secs":       &ht.maxSecs,
+			} {
+				if *val, err = conf.GetInt(name); err != nil {
+					return nil, err
+				}
+			}
+			if _, ok := conf.Trainer.(philoctetes.RelationsInt); !ok {
+				return nil, fmt.Errorf("hermes: the trainer of the hedge trader has to measure the relations between currencies")
+			}
+			sizing, err := getSizing(conf)
+			if err != nil {
+				return nil, err
+			}
+			throttleLimits, err := getThrottleLimits(conf)
+			if err != nil {
+				return nil, err
+			}
+
+			ht = GetHedgeTrader(conf, ht, sizing)
+			ht.throttle = newThrottle(throttleLimits)
+
+			return ht, nil
+		},
+	})
+}
+
+// hedgeTrader holds a single logical trade composed by the primary position
+// and, once the price moves against it, the hedge position. The hedge is a lot
+// of the entry of the primary position so the trade is recorded as a single
+// op
+type hedgeTrader struct {
+	*baseTrader
+
+	trainer        philoctetes.TrainerInt
+	relations      philoctetes.RelationsInt
+	method         string
+	trigger        float64
+	ratio          float64
+	minCorrelation float64
+	maxAdfStat     float64
+	windowSecs     int
+	windowSamples  int
+	takeProfit     float64
+	stopLoss       float64
+	maxSecs        int
+}
+
+// hedge is the currency chosen to hedge a position, beta is the move of the
+// primary currency for each move of the hedge one, and the units of the hedge
+// for each unit of the primary position
+type hedge struct {
+	curr  string
+	beta  float64
+	score float64
+}
+
+// GetHedgeTrader completes the given trader with the common state and
+// starts listening the prices of its currency
+func GetHedgeTrader(conf *TraderConf, ht *hedgeTrader, sizing *Sizing) *hedgeTrader {
+	ht.baseTrader = newBaseTrader(HedgeTraderType, conf, nil)
+	ht.sizing = sizing
+	ht.trainer = conf.Trainer
+	ht.relations, _ = conf.Trainer.(philoctetes.RelationsInt)
+
+	conf.Collector.AddListerner(conf.Curr, ht.NewPrices)
+
+	return ht
+}
+
+// bestHedge returns the currency with the strongest relation with the
+// primary one measured by the trainer, or nil if none of them satisfies the
+// limits. The paused currencies are not used as hedge
+func (ht *hedgeTrader) bestHedge(ts int64) (best *hedge) {
+	currVals := ht.collector.GetAllCurrVals()
+	from := ts - int64(ht.windowSecs)*tsMultToSecs
+
+	for curr := range currVals {
+		if curr == ht.curr || ht.throttle.paused[curr] {
+			continue
+		}
+		rel, ok := ht.relations.GetRelation(ht.curr, curr, currVals, from, ts, ht.windowSamples)
+		if !ok {
+			continue
+		}
+
+		var candidate *hedge
+		if ht.method == HedgeCointegration {
+			if rel.AdfStat > ht.maxAdfStat || rel.HedgeRatio == 0 {
+				continue
+			}
+			candidate = &hedge{curr: curr, beta: rel.HedgeRatio, score: -rel.AdfStat}
+		} else {
+			if math.Abs(rel.Correlation) < ht.minCorrelation || rel.Beta == 0 {
+				continue
+			}
+			candidate = &hedge{curr: curr, beta: rel.Beta, score: math.Abs(rel.Correlation)}
+		}
+		if best == nil || candidate.score > best.score {
+			best = candidate
+		}
+	}
+
+	return
+}
+
+// GetCurrencies returns the currency of the trader followed by the ones of
+// the open hedges
+func (ht *hedgeTrader) GetCurrencies() []string {
+	ht.mutex.Lock()
+	defer ht.mutex.Unlock()
+
+	currencies := []string{ht.curr}
+	for _, pos := range ht.positions {
+		if !inCurrencies(currencies, pos.curr) {
+			currencies = append(currencies, pos.curr)
+		}
+	}
+
+	return currencies
+}
+
+func inCurrencies(currencies []string, curr string) bool {
+	for _, c := range currencies {
+		if c == curr {
+			return true
+		}
+	}
+
+	return false
+}
+
+// primary returns the primary position of the trade, the one on the currency
+// of the trader, or nil if it was already closed
+func (ht *hedgeTrader) primary() *position {
+	for _, pos := range ht.positions {
+		if pos.curr == ht.curr {
+			return pos
+		}
+	}
+
+	return nil
+}
+
+// legsReason returns the reason used to close the legs left open when the
+// primary position was closed, the legs are closed with the primary position
+// so it is always known unless the closed lots were lost
+func (ht *hedgeTrader) legsReason() string {
+	for _, pos := range ht.positions {
+		if lots := ht.closedLots[pos.entry]; len(lots) > 0 {
+			return lots[len(lots)-1].CloseReason
+		}
+	}
+
+	return CloseTrainer
+}
+
+// combinedWin returns the profit ratio of all the legs of the trade weighted
+// by their units
+func (ht *hedgeTrader) combinedWin() (win float64, ok bool) {
+	currVals := ht.collector.GetAllCurrVals()
+
+	var units float64
+	for _, pos := range ht.positions {
+		vals := currVals[pos.curr]
+		if len(vals) == 0 {
+			return 0, false
+		}
+		win += ht.positionWin(pos, vals[len(vals)-1]) * float64(pos.ord.Units)
+		units += float64(pos.ord.Units)
+	}
+
+	return win / units, true
+}
+
+func (ht *hedgeTrader) NewPrices(curr string, ts int64) {
+	ht.mutex.Lock()
+	defer ht.mutex.Unlock()
+
+	if ht.retired {
+		return
+	}
+	currVals := ht.collector.GetAllCurrVals()
+	lastVal := currVals[curr][len(currVals[curr])-1]
+	decision := ht.newDecision(curr, lastVal)
+	defer ht.trace(decision, currVals)
+	defer ht.exportPositions(currVals, lastVal.Ts)
+	if ht.checkRisk(currVals, lastVal.Ts, decision) {
+		return
+	}
+
+	if len(ht.positions) == 0 {
+		should, typeOper := ht.trainer.ShouldIOperate(curr, currVals, ht.id)
+		if !should {
+			decision.Reason = ReasonNoSignal
+			return
+		}
+		entry, err := ht.openPosition(curr, typeOper, lastVal)
+		decision.opened(typeOper, entry, err)
+		return
+	}
+
+	win, ok := ht.combinedWin()
+	if !ok {
+		return
+	}
+
+	// The legs that couldn't be closed with the primary position are closed
+	// with the reason of the close of the trade
+	primary := ht.primary()
+	reason := ""
+	if primary == nil {
+		reason = ht.legsReason()
+	}
+	switch {
+	case reason != "":
+	case ht.trainer.ShouldIClose(curr, primary.openVal, currVals, ht.id, primary.ord):
+		reason = CloseTrainer
+	case win >= ht.takeProfit:
+		reason = CloseTakeProfit
+	case win <= -ht.stopLoss:
+		reason = CloseStopLoss
+	case lastVal.Ts-primary.openVal.Ts > int64(ht.maxSecs)*tsMultToSecs:
+		reason = CloseTimeout
+	}
+	if reason != "" {
+		for _, pos := range append([]*position{}, ht.positions...) {
+			posVals := currVals[pos.curr]
+			if err := ht.closePosition(pos, posVals[len(posVals)-1], reason); err != nil {
+				log.Error("The leg of the hedged trade can't be closed, Trader:", ht.id, "Curr:", pos.curr, "Error:", err)
+				continue
+			}
+			decision.closed(pos, reason)
+		}
+		log.Debug("Hedge trade closed, Trader:", ht.id, "Curr:", curr, "Reason:", reason, "Profit:", win, "Real:", ht.realOpsStr())
+		return
+	}
+
+	if len(ht.positions) > 1 || ht.positionWin(primary, lastVal) > -ht.trigger {
+		return
+	}
+
+	best := ht.bestHedge(lastVal.Ts)
+	if best == nil {
+		return
+	}
+	hedgeVals := currVals[best.curr]
+	hedgeSide := "buy"
+	if (best.beta > 0) == (primary.ord.Type == "buy") {
+		hedgeSide = "sell"
+	}
+	units := ht.sizing.round(float64(primary.ord.Units) * ht.ratio * math.Abs(best.beta))
+	if units < 1 {
+		return
+	}
+
+	pos, err := ht.placeLot(primary.entry, best.curr, hedgeSide, units, hedgeVals[len(hedgeVals)-1])
+	decision.Reason = ReasonHedge
+	if err != nil {
+		decision.opened(hedgeSide, nil, err)
+		return
+	}
+	decision.opened(hedgeSide, []*position{pos}, nil)
+	log.Debug("Hedge opened, Trader:", ht.id, "Curr:", curr, "Hedge:", best.curr, "Beta:", best.beta, "Side:", hedgeSide, "Units:", units, "Real:", ht.realOpsStr())
+}
@@ -0,0 +1,111 @@
+package hermes
+
+import (
+	"math"
+	"testing"
+
+	"github.com/alonsovidales/v/charont"
+	"github.com/alonsovidales/v/philoctetes"
+)
+
+type trainerTest struct {
+	operate   string
+	closeNext bool
+}
+
+func (tr *trainerTest) ShouldIOperate(curr string, vals map[string][]*charont.CurrVal, traderID int) (bool, string) {
+	return tr.operate != "", tr.operate
+}
+
+func (tr *trainerTest) ShouldIClose(curr string, askVal *charont.CurrVal, vals map[string][]*charont.CurrVal, traderID int, ord *charont.Order) bool {
+	return tr.closeNext
+}
+
+// relationsTrainerTest measures the relations between the currencies as the
+// cross currency trainer does
+type relationsTrainerTest struct {
+	trainerTest
+}
+
+func (tr *relationsTrainerTest) GetRelation(curr, other string, vals map[string][]*charont.CurrVal, from, to int64, samples int) (philoctetes.Relation, bool) {
+	return philoctetes.MeasureRelation(vals[curr], vals[other], from, to, samples)
+}
+
+func TestHedgeTrader(t *testing.T) {
+	collector := getCollectorTest()
+	if _, err := GetTrader(HedgeTraderType, &TraderConf{Curr: "USD", Trainer: &trainerTest{}, Collector: collector}); err == nil {
+		t.Error("A hedge trader was built with a trainer that doesn't measure the relations between currencies")
+	}
+
+	trainer := &relationsTrainerTest{}
+	trader, err := GetTrader(HedgeTraderType, &TraderConf{
+		Curr:      "USD",
+		Trainer:   trainer,
+		Collector: collector,
+		Units:     100,
+		Params: map[string]string{
+			"window-secs":    "100",
+			"window-samples": "50",
+			"stop-loss":      "0.5",
+			"take-profit":    "0.5",
+		},
+	})
+	if err != nil {
+		t.Fatal("Problem building the hedge trader:", err)
+	}
+	ht := trader.(*hedgeTrader)
+
+	addVals := func(i int) {
+		ts := int64(i) * tsMultToSecs
+		usd := 1 + 0.01*math.Sin(float64(i)/5)
+		eur := 1 + 0.02*math.Sin(float64(i)/5)
+		gbp := 1 + 0.01*math.Cos(float64(i)/3)
+		collector.addVal("EUR", &charont.CurrVal{Ts: ts, Bid: eur, Ask: eur})
+		collector.addVal("GBP", &charont.CurrVal{Ts: ts, Bid: gbp, Ask: gbp})
+		collector.addVal("USD", &charont.CurrVal{Ts: ts, Bid: usd, Ask: usd})
+	}
+
+	for i := 0; i < 110; i++ {
+		addVals(i)
+	}
+	trainer.operate = "buy"
+	addVals(110)
+	trainer.operate = ""
+	if len(ht.positions) != 1 || ht.positions[0].ord.Type != "buy" {
+		t.Fatal("The primary position should be open")
+	}
+
+	for i := 111; i < 114; i++ {
+		addVals(i)
+	}
+	if len(ht.positions) != 2 {
+		t.Fatal("The hedge should be open after the price moved against the position, Positions:", len(ht.positions))
+	}
+	hedge := ht.positions[1]
+	if hedge.curr != "EUR" || hedge.ord.Type != "sell" || hedge.entry != ht.positions[0].entry {
+		t.Error("Unexpected hedge, Curr:", hedge.curr, "Type:", hedge.ord.Type)
+	}
+	if hedge.ord.Units < 40 || hedge.ord.Units > 60 {
+		t.Error("The units of the hedge should be adjusted by the beta, Units:", hedge.ord.Units)
+	}
+	if currs := trader.GetCurrencies(); len(currs) != 2 || currs[0] != "USD" || currs[1] != "EUR" {
+		t.Error("The currency of the hedge should be reported, Currencies:", currs)
+	}
+
+	collector.failClose = "EUR"
+	trainer.closeNext = true
+	addVals(114)
+	if len(ht.positions) != 1 || ht.positions[0] != hedge || trader.GetNumOps() != 0 {
+		t.Fatal("Only the hedge should remain open, Positions:", len(ht.positions), "Ops:", trader.GetNumOps())
+	}
+
+	collector.failClose = ""
+	trainer.closeNext = false
+	addVals(115)
+	if len(ht.positions) != 0 || trader.GetNumOps() != 1 {
+		t.Fatal("The hedge should be closed as the leg of the trade, Positions:", len(ht.positions), "Ops:", trader.GetNumOps())
+	}
+	if op := ht.ops[0]; len(op.Legs) != 2 || op.Curr != "USD" || op.Units != 100 || op.CloseReason != CloseTrainer {
+		t.Error("Both legs should be recorded as a single op:", op)
+	}
+}
@@ -1,12 +1,35 @@
 package hermes
 
+import (
+	"github.com/alonsovidales/v/charont"
+)
+
 type Int interface {
 	GetScore(lastOps int) (score float64)
+	GetLastProfits(lastOps int) (profits []float64)
 	GetMicsecsBetweenOps(lastOps int) float64
 	GetNumOps() int
 	StartPlaying()
 	StopPlaying() bool
 	GetID() int
+	GetType() string
+	GetCurrencies() []string
 	IsPlaying() bool
 	GetTotalProfit() float64
+	GetMetrics() Metrics
+	GetRiskState() RiskState
+	ResetRisk()
+	GetRiskLimits() RiskLimits
+	SetRiskLimits(limits RiskLimits)
+	SetUnits(units int)
+	SetAllocation(capital float64)
+	SetPaused(curr string, paused bool)
+	GetOpenOrders() []*charont.Order
+	CloseOrder(orderID int64) (found bool, err error)
+	CloseAllPositions(reason string) (closed int, err error)
+	GetThrottleState() ThrottleState
+	Snapshot() *TraderSnapshot
+	Restore(snap *TraderSnapshot) error
+	Reconcile() *Reconciliation
+	Retire()
 }
@@ -0,0 +1,154 @@
+package hermes
+
+import (
+	"math"
+	"sync"
+
+	"github.com/alonsovidales/v/charont"
+)
+
+const (
+	daySecs = 24 * 3600
+)
+
+// Metrics contains the risk adjusted performance of a trader computed over
+// the profit ratio of each closed op. Sharpe and Sortino are computed by op
+// without annualization, the ProfitFactor is math.MaxFloat64 when there are no
+// losses and the ExposureAdjustedReturn is the compounded return by day
+// holding positions, limited to math.MaxFloat64. All the values are finite so
+// they can be encoded as JSON
+type Metrics struct {
+	Ops                    int     `json:"ops"`
+	Sharpe                 float64 `json:"sharpe"`
+	Sortino                float64 `json:"sortino"`
+	MaxDrawdown            float64 `json:"max_drawdown"`
+	WinRate                float64 `json:"win_rate"`
+	ProfitFactor           float64 `json:"profit_factor"`
+	Expectancy             float64 `json:"expectancy"`
+	AvgHoldingSecs         float64 `json:"avg_holding_secs"`
+	ExposureAdjustedReturn float64 `json:"exposure_adjusted_return"`
+}
+
+// metricsCalc keeps the accumulators required to update the metrics on each
+// op without iterating over all the history
+type metricsCalc struct {
+	mutex sync.Mutex
+
+	ops         int
+	wins        int
+	mean        float64
+	m2          float64
+	downsideSq  float64
+	grossProfit float64
+	grossLoss   float64
+	holdingSecs float64
+	equity      float64
+	peak        float64
+	maxDrawdown float64
+}
+
+func newMetricsCalc() *metricsCalc {
+	return &metricsCalc{
+		equity: 1,
+		peak:   1,
+	}
+}
+
+func (mc *metricsCalc) opClosed(ord *charont.Order) {
+	mc.mutex.Lock()
+	defer mc.mutex.Unlock()
+
+	profit := ord.Profit
+	mc.ops++
+
+	// Welford's online algorithm for the variance
+	delta := profit - mc.mean
+	mc.mean += delta / float64(mc.ops)
+	mc.m2 += delta * (profit - mc.mean)
+
+	if profit > 0 {
+		mc.wins++
+		mc.grossProfit += profit
+	} else {
+		mc.grossLoss -= profit
+		mc.downsideSq += profit * profit
+	}
+	mc.holdingSecs += float64(ord.SellTs-ord.BuyTs) / tsMultToSecs
+
+	mc.equity *= profit + 1
+	if mc.equity > mc.peak {
+		mc.peak = mc.equity
+	}
+	if drawdown := 1 - mc.equity/mc.peak; drawdown > mc.maxDrawdown {
+		mc.maxDrawdown = drawdown
+	}
+}
+
+func (mc *metricsCalc) getMetrics() (m Metrics) {
+	mc.mutex.Lock()
+	defer mc.mutex.Unlock()
+
+	m.Ops = mc.ops
+	m.MaxDrawdown = mc.maxDrawdown
+	if mc.ops == 0 {
+		return
+	}
+
+	if mc.ops > 1 {
+		if stdDev := math.Sqrt(mc.m2 / float64(mc.ops-1)); stdDev > 0 {
+			m.Sharpe = mc.mean / stdDev
+		}
+	}
+	if downsideDev := math.Sqrt(mc.downsideSq / float64(mc.ops)); downsideDev > 0 {
+		m.Sortino = mc.mean / downsideDev
+	}
+
+	m.WinRate = float64(mc.wins) / float64(mc.ops)
+	if mc.grossLoss > 0 {
+		m.ProfitFactor = mc.grossProfit / mc.grossLoss
+	} else if mc.grossProfit > 0 {
+		m.ProfitFactor = math.MaxFloat64
+	}
+
+	avgWin := 0.0
+	if mc.wins > 0 {
+		avgWin = mc.grossProfit / float64(mc.wins)
+	}
+	avgLoss := 0.0
+	if mc.ops > mc.wins {
+		avgLoss = mc.grossLoss / float64(mc.ops-mc.wins)
+	}
+	m.Expectancy = m.WinRate*avgWin - (1-m.WinRate)*avgLoss
+
+	m.AvgHoldingSecs = mc.holdingSecs / float64(mc.ops)
+	if mc.holdingSecs > 0 {
+		// computed on log space since the return by day of short holding
+		// periods overflows
+		logReturn := math.Log(mc.equity) * daySecs / mc.holdingSecs
+		m.ExposureAdjustedReturn = math.Expm1(math.Min(logReturn, math.Log(math.MaxFloat64)))
+	}
+
+	m.Sharpe = finite(m.Sharpe)
+	m.Sortino = finite(m.Sortino)
+	m.MaxDrawdown = finite(m.MaxDrawdown)
+	m.Expectancy = finite(m.Expectancy)
+	m.AvgHoldingSecs = finite(m.AvgHoldingSecs)
+	m.ExposureAdjustedReturn = finite(m.ExposureAdjustedReturn)
+
+	return
+}
+
+// finite limits the infinite values to math.MaxFloat64 and replaces NaN by
+// zero
+func finite(value float64) float64 {
+	switch {
+	case math.IsNaN(value):
+		return 0
+	case math.IsInf(value, 1):
+		return math.MaxFloat64
+	case math.IsInf(value, -1):
+		return -math.MaxFloat64
+	}
+
+	return value
+}
@@ -0,0 +1,87 @@
+package hermes
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/alonsovidales/v/argos"
+	"github.com/alonsovidales/v/charont"
+)
+
+func TestMetrics(t *testing.T) {
+	mc := newMetricsCalc()
+	if m := mc.getMetrics(); m.Ops != 0 || m.Sharpe != 0 {
+		t.Error("Unexpected metrics without ops:", m)
+	}
+
+	for _, profit := range []float64{0.02, -0.01, 0.03, -0.02} {
+		mc.opClosed(&charont.Order{
+			Profit: profit,
+			BuyTs:  0,
+			SellTs: 3600 * tsMultToSecs,
+		})
+	}
+
+	m := mc.getMetrics()
+	if m.Ops != 4 || m.WinRate != 0.5 {
+		t.Error("Unexpected ops or win rate:", m)
+	}
+	if math.Abs(m.ProfitFactor-5.0/3.0) > 1e-9 {
+		t.Error("Unexpected profit factor:", m.ProfitFactor)
+	}
+	if math.Abs(m.Expectancy-0.005) > 1e-9 {
+		t.Error("Unexpected expectancy:", m.Expectancy)
+	}
+	if math.Abs(m.MaxDrawdown-0.02) > 1e-9 {
+		t.Error("Unexpected max drawdown:", m.MaxDrawdown)
+	}
+	if m.AvgHoldingSecs != 3600 {
+		t.Error("Unexpected avg holding time:", m.AvgHoldingSecs)
+	}
+	if m.Sharpe <= 0 || m.Sortino <= m.Sharpe {
+		t.Error("Unexpected Sharpe and Sortino:", m.Sharpe, m.Sortino)
+	}
+
+	// a big return held during one second overflows the return by day
+	mc = newMetricsCalc()
+	mc.opClosed(&charont.Order{Profit: 0.5, BuyTs: 0, SellTs: tsMultToSecs})
+	m = mc.getMetrics()
+	if m.ExposureAdjustedReturn != math.MaxFloat64 || m.ProfitFactor != math.MaxFloat64 {
+		t.Error("The exposure adjusted return should be limited:", m.ExposureAdjustedReturn)
+	}
+	if _, err := json.Marshal(m); err != nil {
+		t.Error("The metrics should be encoded as JSON, Error:", err)
+	}
+}
+
+func TestExportPositions(t *testing.T) {
+	collector := getCollectorTest()
+	bt := newBaseTrader("test", &TraderConf{ID: 9901, Curr: "EURUSD", Collector: collector, Units: 1}, nil)
+	exported := func() string {
+		buf := new(bytes.Buffer)
+		argos.Default.Write(buf)
+		return buf.String()
+	}
+
+	val := &charont.CurrVal{Ts: tsMultToSecs, Ask: 1, Bid: 1}
+	collector.vals["EURUSD"] = []*charont.CurrVal{val}
+	bt.exportPositions(collector.vals, val.Ts)
+	bt.openPosition("EURUSD", "buy", val)
+	bt.exportPositions(collector.vals, val.Ts+1)
+	if !strings.Contains(exported(), `v_hermes_open_positions{trader="9901"} 1`) {
+		t.Error("The positions should be exported when they change")
+	}
+	bt.positions = nil
+	bt.exportPositions(collector.vals, 2*tsMultToSecs)
+	if !strings.Contains(exported(), `v_hermes_open_positions{trader="9901"} 0`) {
+		t.Error("The closed positions should be exported")
+	}
+
+	bt.Retire()
+	if strings.Contains(exported(), `trader="9901"`) {
+		t.Error("The series of a retired trader should be removed")
+	}
+}
@@ -0,0 +1,195 @@
+package hermes
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/alonsovidales/v/charont"
+)
+
+// TraderSnapshot contains all the state of a trader required to restore it
+// after a restart, the closed ops, the open positions and the risk state
+type TraderSnapshot struct {
+	ID         int                 `json:"id"`
+	Type       string              `json:"type"`
+	Currencies []string            `json:"currencies"`
+	Playing    bool                `json:"playing"`
+	Ops        []*charont.Order    `json:"ops"`
+	Positions  []*PositionSnapshot `json:"positions"`
+	Risk       RiskState           `json:"risk"`
+	Throttle   *ThrottleState      `json:"throttle,omitempty"`
+	// ClosedLots are the closed lots of the entries that still have open
+	// lots
+	ClosedLots map[int][]*charont.Order `json:"closed_lots,omitempty"`
+}
+
+type PositionSnapshot struct {
+	Entry   int              `json:"entry"`
+	Curr    string           `json:"curr"`
+	Order   *charont.Order   `json:"order"`
+	OpenVal *charont.CurrVal `json:"open_val"`
+
+	Peak       float64 `json:"peak,omitempty"`
+	Stop       float64 `json:"stop,omitempty"`
+	StopReason string  `json:"stop_reason,omitempty"`
+	TPLevel    int     `json:"tp_level,omitempty"`
+}
+
+func (bt *baseTrader) Snapshot() (snap *TraderSnapshot) {
+	bt.mutex.Lock()
+	defer bt.mutex.Unlock()
+
+	snap = &TraderSnapshot{
+		ID:         bt.id,
+		Type:       bt.typeName,
+		Currencies: bt.GetCurrencies(),
+		Playing:    bt.realOps,
+		Ops:        make([]*charont.Order, len(bt.ops)),
+		Positions:  make([]*PositionSnapshot, len(bt.positions)),
+		Risk:       bt.risk.getState(),
+	}
+	throttle := bt.throttle.getState()
+	snap.Throttle = &throttle
+	for i, op := range bt.ops {
+		opCopy := *op
+		snap.Ops[i] = &opCopy
+	}
+	if len(bt.closedLots) > 0 {
+		snap.ClosedLots = make(map[int][]*charont.Order)
+		for entry, lots := range bt.closedLots {
+			for _, lot := range lots {
+				lotCopy := *lot
+				snap.ClosedLots[entry] = append(snap.ClosedLots[entry], &lotCopy)
+			}
+		}
+	}
+	for i, pos := range bt.positions {
+		ordCopy := *pos.ord
+		snap.Positions[i] = &PositionSnapshot{
+			Entry:   pos.entry,
+			Curr:    pos.curr,
+			Order:   &ordCopy,
+			OpenVal: pos.openVal,
+
+			Peak:       pos.exit.peak,
+			Stop:       pos.exit.stop,
+			StopReason: pos.exit.stopReason,
+			TPLevel:    pos.exit.tpLevel,
+		}
+	}
+
+	return
+}
+
+// Restore replaces the state of the trader by the one on the snapshot, the
+// snapshot has to belong to a trader with the same ID, type and currencies
+func (bt *baseTrader) Restore(snap *TraderSnapshot) (err error) {
+	if snap.ID != bt.id || snap.Type != bt.typeName {
+		return fmt.Errorf("hermes: the snapshot of the trader %d (%s) can't be restored into the trader %d (%s)", snap.ID, snap.Type, bt.id, bt.typeName)
+	}
+	if currencies := bt.GetCurrencies(); !sameCurrencies(snap.Currencies, currencies) {
+		return fmt.Errorf("hermes: the snapshot of the trader %d on %v can't be restored into the trader on %v", snap.ID, snap.Currencies, currencies)
+	}
+
+	bt.mutex.Lock()
+	defer bt.mutex.Unlock()
+
+	bt.realOps = snap.Playing
+	bt.ops = snap.Ops
+	bt.closedLots = make(map[int][]*charont.Order)
+	for entry, lots := range snap.ClosedLots {
+		bt.closedLots[entry] = lots
+	}
+	bt.metrics = newMetricsCalc()
+	for _, op := range bt.ops {
+		bt.metrics.opClosed(op)
+	}
+	bt.positions = make([]*position, len(snap.Positions))
+	for i, pos := range snap.Positions {
+		bt.positions[i] = &position{
+			entry:   pos.Entry,
+			curr:    pos.Curr,
+			ord:     pos.Order,
+			openVal: pos.OpenVal,
+			exit: exitState{
+				peak:       pos.Peak,
+				stop:       pos.Stop,
+				stopReason: pos.StopReason,
+				tpLevel:    pos.TPLevel,
+			},
+		}
+		if pos.Entry > bt.entries {
+			bt.entries = pos.Entry
+		}
+	}
+	if snap.Throttle != nil {
+		bt.throttle.state = *snap.Throttle
+		if bt.throttle.state.CooldownUntil == nil {
+			bt.throttle.state.CooldownUntil = make(map[string]int64)
+		}
+		if bt.throttle.state.CooldownReason == nil {
+			bt.throttle.state.CooldownReason = make(map[string]string)
+		}
+	}
+	if snap.Risk.State != "" {
+		bt.risk.mutex.Lock()
+		bt.risk.state = snap.Risk
+		bt.risk.mutex.Unlock()
+		bt.riskState = snap.Risk.State
+	}
+
+	return
+}
+
+func sameCurrencies(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+func snapshotPath(dir string, id int) string {
+	return filepath.Join(dir, fmt.Sprintf("trader-%d.json", id))
+}
+
+// SaveSnapshot stores the snapshot into the directory replacing the previous
+// one of the same trader
+func SaveSnapshot(dir string, snap *TraderSnapshot) (err error) {
+	b, err := json.Marshal(snap)
+	if err != nil {
+		return
+	}
+
+	path := snapshotPath(dir, snap.ID)
+	if err = ioutil.WriteFile(path+".tmp", b, 0644); err != nil {
+		return
+	}
+
+	return os.Rename(path+".tmp", path)
+}
+
+// LoadSnapshot returns the last snapshot stored for the trader, or nil if
+// there is no snapshot for it
+func LoadSnapshot(dir string, id int) (snap *TraderSnapshot, err error) {
+	b, err := ioutil.ReadFile(snapshotPath(dir, id))
+	if err != nil {
+		if os.IsNotExist(err) {
+			err = nil
+		}
+		return
+	}
+
+	snap = &TraderSnapshot{}
+	err = json.Unmarshal(b, snap)
+
+	return
+}
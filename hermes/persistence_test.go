@@ -0,0 +1,60 @@
+package hermes
+
+import (
+	"testing"
+
+	"github.com/alonsovidales/v/charont"
+)
+
+func TestSnapshotRestore(t *testing.T) {
+	dir := t.TempDir()
+	conf := &TraderConf{
+		ID:        3,
+		Curr:      "USD",
+		Collector: getCollectorTest(),
+		Units:     1,
+		Params:    map[string]string{"step": "0.01"},
+	}
+
+	trader, _ := GetTrader(GridTraderType, conf)
+	collector := conf.Collector.(*collectorTest)
+	collector.addVal("USD", &charont.CurrVal{Ts: 1, Bid: 1.00, Ask: 1.00})
+	collector.addVal("USD", &charont.CurrVal{Ts: 2, Bid: 0.99, Ask: 0.99})
+	collector.addVal("USD", &charont.CurrVal{Ts: 3, Bid: 1.00, Ask: 1.00})
+	trader.StartPlaying()
+
+	if err := SaveSnapshot(dir, trader.Snapshot()); err != nil {
+		t.Fatal("Problem storing the snapshot, Error:", err)
+	}
+
+	restored, _ := GetTrader(GridTraderType, conf)
+	snap, err := LoadSnapshot(dir, 3)
+	if err != nil || snap == nil {
+		t.Fatal("Problem loading the snapshot:", snap, "Error:", err)
+	}
+	if err = restored.Restore(snap); err != nil {
+		t.Fatal("Problem restoring the snapshot, Error:", err)
+	}
+
+	if restored.GetNumOps() != trader.GetNumOps() || len(restored.(*gridTrader).positions) != len(trader.(*gridTrader).positions) {
+		t.Error("The restored trader has:", restored.GetNumOps(), "ops and:", len(restored.(*gridTrader).positions), "positions")
+	}
+	if !restored.IsPlaying() || restored.GetTotalProfit() != trader.GetTotalProfit() {
+		t.Error("Unexpected state of the restored trader, Playing:", restored.IsPlaying(), "Profit:", restored.GetTotalProfit())
+	}
+
+	if snap, _ = LoadSnapshot(dir, 4); snap != nil {
+		t.Error("A snapshot was returned for a trader without it")
+	}
+	conf.ID = 4
+	other, _ := GetTrader(GridTraderType, conf)
+	if err = other.Restore(trader.Snapshot()); err == nil {
+		t.Error("The snapshot of a different trader was restored")
+	}
+	conf.ID = 3
+	conf.Curr = "GBP"
+	otherCurr, _ := GetTrader(GridTraderType, conf)
+	if err = otherCurr.Restore(trader.Snapshot()); err == nil {
+		t.Error("The snapshot of a trader on a different currency was restored")
+	}
+}
@@ -0,0 +1,174 @@
+package hermes
+
+import (
+	"fmt"
+)
+
+const (
+	// CloseByEntry closes the lots of the entry that received the close signal
+	CloseByEntry = "entry"
+	// CloseFIFO closes the oldest lots, whatever the entry they belong to
+	CloseFIFO = "fifo"
+)
+
+// PositionLimits configures how a trader manages its open positions. Each
+// entry is split in Lots orders so it can be partially closed, closing
+// ScaleOutLots lots on each close signal, all of them if zero, the entry is
+// recorded as a single op once all its lots are closed. New entries on the
+// side of the open ones require ScaleIn, and on the opposite side AllowHedge
+type PositionLimits struct {
+	MaxEntries            int
+	ScaleIn               bool
+	AllowHedge            bool
+	MinSecsBetweenEntries int
+	CloseMode             string
+	Lots                  int
+	ScaleOutLots          int
+}
+
+// positionManager keeps the open positions of a trader, each position is a
+// lot of an entry
+type positionManager struct {
+	limits    PositionLimits
+	positions []*position
+	entries   int
+}
+
+func newPositionManager(limits *PositionLimits) *positionManager {
+	pm := &positionManager{
+		limits: PositionLimits{
+			MaxEntries: 1,
+			CloseMode:  CloseByEntry,
+			Lots:       1,
+		},
+	}
+	if limits != nil {
+		pm.limits = *limits
+	}
+	if pm.limits.MaxEntries < 1 {
+		pm.limits.MaxEntries = 1
+	}
+	if pm.limits.Lots < 1 {
+		pm.limits.Lots = 1
+	}
+	if pm.limits.CloseMode == "" {
+		pm.limits.CloseMode = CloseByEntry
+	}
+
+	return pm
+}
+
+// Validate checks that the limits are consistent
+func (limits *PositionLimits) Validate() error {
+	if limits.CloseMode != "" && limits.CloseMode != CloseByEntry && limits.CloseMode != CloseFIFO {
+		return fmt.Errorf("hermes: unknown close mode: %s", limits.CloseMode)
+	}
+
+	return nil
+}
+
+// entryPositions returns the open positions grouped by entry, from the
+// oldest entry to the newest one
+func (pm *positionManager) entryPositions() (entries [][]*position) {
+	byEntry := make(map[int]int)
+	for _, pos := range pm.positions {
+		if i, ok := byEntry[pos.entry]; ok {
+			entries[i] = append(entries[i], pos)
+		} else {
+			byEntry[pos.entry] = len(entries)
+			entries = append(entries, []*position{pos})
+		}
+	}
+
+	return
+}
+
+// canOpen returns true if a new entry can be opened at the given time, the
+// side of the entry is not checked if typeOper is empty
+func (pm *positionManager) canOpen(typeOper string, ts int64) bool {
+	return pm.openBlocked(typeOper, ts) == ""
+}
+
+// openBlocked returns the reason why a new entry can't be opened at the given
+// time, or an empty string if it can be opened
+func (pm *positionManager) openBlocked(typeOper string, ts int64) string {
+	entries := pm.entryPositions()
+	if len(entries) == 0 {
+		return ""
+	}
+	if len(entries) >= pm.limits.MaxEntries {
+		return ReasonMaxEntries
+	}
+
+	last := entries[len(entries)-1][0]
+	if ts-last.openVal.Ts < int64(pm.limits.MinSecsBetweenEntries)*tsMultToSecs {
+		return ReasonEntrySpacing
+	}
+	if typeOper == "" {
+		return ""
+	}
+
+	for _, entry := range entries {
+		if entry[0].ord.Type == typeOper {
+			if !pm.limits.ScaleIn {
+				return ReasonSide
+			}
+		} else if !pm.limits.AllowHedge {
+			return ReasonSide
+		}
+	}
+
+	return ""
+}
+
+// lotsUnits splits the units of a new entry between its lots, the units of
+// each lot are a multiple of the trade increment
+func (pm *positionManager) lotsUnits(units, increment int) (lots []int) {
+	lotUnits := units / pm.limits.Lots / increment * increment
+	if lotUnits < 1 {
+		return []int{units}
+	}
+
+	for i := 0; i < pm.limits.Lots; i++ {
+		lots = append(lots, lotUnits)
+	}
+	lots[len(lots)-1] += units - lotUnits*pm.limits.Lots
+
+	return
+}
+
+// toClose returns the lots to be closed when the close signal is received by
+// the given entry, the number of lots is ScaleOutLots or all the lots of the
+// entry if zero
+func (pm *positionManager) toClose(entry int) (lots []*position) {
+	entryLots := 0
+	for _, pos := range pm.positions {
+		if pos.entry == entry {
+			entryLots++
+		}
+	}
+	toClose := entryLots
+	if pm.limits.ScaleOutLots > 0 && pm.limits.ScaleOutLots < entryLots {
+		toClose = pm.limits.ScaleOutLots
+	}
+
+	for _, pos := range pm.positions {
+		if len(lots) == toClose {
+			break
+		}
+		if pm.limits.CloseMode == CloseFIFO || pos.entry == entry {
+			lots = append(lots, pos)
+		}
+	}
+
+	return
+}
+
+func (pm *positionManager) removePosition(pos *position) {
+	for i, p := range pm.positions {
+		if p == pos {
+			pm.positions = append(pm.positions[:i], pm.positions[i+1:]...)
+			return
+		}
+	}
+}
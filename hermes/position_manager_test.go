@@ -0,0 +1,96 @@
+package hermes
+
+import (
+	"testing"
+
+	"github.com/alonsovidales/v/charont"
+)
+
+func TestPositionManagerScaling(t *testing.T) {
+	collector := getCollectorTest()
+	bt := newBaseTrader("test", &TraderConf{
+		ID:        1,
+		Curr:      "EURUSD",
+		Collector: collector,
+		Units:     10,
+	}, &PositionLimits{
+		MaxEntries:            2,
+		ScaleIn:               true,
+		MinSecsBetweenEntries: 10,
+		Lots:                  3,
+		ScaleOutLots:          2,
+		CloseMode:             CloseFIFO,
+	})
+
+	val := &charont.CurrVal{Ts: 0, Ask: 1.1, Bid: 1.1}
+	collector.vals["EURUSD"] = []*charont.CurrVal{val}
+	entry, err := bt.openPosition("EURUSD", "buy", val)
+	if err != nil || len(entry) != 3 {
+		t.Fatal("Three lots expected for the entry, Lots:", len(entry), "Error:", err)
+	}
+	units := 0
+	for _, pos := range entry {
+		units += pos.ord.Units
+	}
+	if units != 10 {
+		t.Error("The units of the lots don't sum the units of the trader, Units:", units)
+	}
+
+	if bt.canOpen("buy", 5*tsMultToSecs) {
+		t.Error("A new entry can't be opened before the min time between entries")
+	}
+	if bt.canOpen("sell", 20*tsMultToSecs) {
+		t.Error("A new entry on the opposite side can't be opened without hedge")
+	}
+	if !bt.canOpen("buy", 20*tsMultToSecs) {
+		t.Fatal("A new entry on the same side should be allowed to scale in")
+	}
+
+	val = &charont.CurrVal{Ts: 20 * tsMultToSecs, Ask: 1.2, Bid: 1.2}
+	collector.vals["EURUSD"] = append(collector.vals["EURUSD"], val)
+	bt.openPosition("EURUSD", "buy", val)
+	if bt.canOpen("buy", 40*tsMultToSecs) {
+		t.Error("The max number of entries was reached")
+	}
+
+	lots := bt.toClose(2)
+	if len(lots) != 2 || lots[0].entry != 1 || lots[1].entry != 1 {
+		t.Fatal("The two oldest lots should be closed on FIFO mode, Lots:", len(lots))
+	}
+	for _, pos := range lots {
+		if err := bt.closePosition(pos, val, CloseTrainer); err != nil {
+			t.Fatal("The position can't be closed:", err)
+		}
+	}
+	if len(bt.positions) != 4 || len(bt.entryPositions()) != 2 || len(bt.ops) != 0 || len(bt.closedLots[1]) != 2 {
+		t.Error("Partial close expected, Positions:", len(bt.positions), "Ops:", len(bt.ops))
+	}
+}
+
+func TestPositionManagerPartialFill(t *testing.T) {
+	collector := getCollectorTest()
+	bt := newBaseTrader("test", &TraderConf{
+		ID:        1,
+		Curr:      "EURUSD",
+		Collector: collector,
+		Units:     10,
+	}, &PositionLimits{Lots: 3})
+
+	val := &charont.CurrVal{Ts: 0, Ask: 1.1, Bid: 1.1}
+	collector.vals["EURUSD"] = []*charont.CurrVal{val}
+	collector.failOrder = 3
+	entry, err := bt.openPosition("EURUSD", "buy", val)
+	if err == nil || len(entry) != 0 || len(bt.positions) != 0 {
+		t.Fatal("The placed lots should be closed if the entry can't be completed, Lots:", len(entry), "Error:", err)
+	}
+	if len(bt.ops) != 1 || len(bt.ops[0].Legs) != 2 || bt.ops[0].CloseReason != ClosePartialFill {
+		t.Error("The closed lots should be recorded as a single op, Ops:", len(bt.ops))
+	}
+
+	collector.failOrder = 6
+	collector.failClose = "EURUSD"
+	entry, err = bt.openPosition("EURUSD", "buy", val)
+	if err == nil || len(entry) != 2 || len(bt.positions) != 2 {
+		t.Error("The lots that can't be closed should be reported as a partial entry, Lots:", len(entry), "Error:", err)
+	}
+}
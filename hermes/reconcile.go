@@ -0,0 +1,136 @@
+package hermes
+
+import (
+	"github.com/alonsovidales/v/charont"
+)
+
+// PlSummary aggregates the results of a set of ops, Pl is in the account
+// currency and Profit is the compounded profit ratio
+type PlSummary struct {
+	Ops     int     `json:"ops"`
+	Pl      float64 `json:"pl"`
+	Profit  float64 `json:"profit"`
+	WinRate float64 `json:"win_rate"`
+
+	wins int
+}
+
+// ReconciliationPeriod is a period in which the trader was playing with real
+// orders. The live results are compared with the paper ones, the results that
+// the same orders would have obtained filled at the reference prices. The
+// difference is attributed to the slippage and to the other costs applied by
+// the broker, financing and commissions
+type ReconciliationPeriod struct {
+	From         int64     `json:"from"`
+	To           int64     `json:"to"`
+	Live         PlSummary `json:"live"`
+	Paper        PlSummary `json:"paper"`
+	SpreadCost   float64   `json:"spread_cost"`
+	SlippageCost float64   `json:"slippage_cost"`
+	OtherCost    float64   `json:"other_cost"`
+}
+
+// Reconciliation compares the simulated track record of a trader with its
+// live results
+type Reconciliation struct {
+	TraderID     int                     `json:"trader"`
+	Type         string                  `json:"type"`
+	Currencies   []string                `json:"currencies"`
+	Simulated    PlSummary               `json:"simulated"`
+	Live         PlSummary               `json:"live"`
+	Paper        PlSummary               `json:"paper"`
+	SpreadCost   float64                 `json:"spread_cost"`
+	SlippageCost float64                 `json:"slippage_cost"`
+	OtherCost    float64                 `json:"other_cost"`
+	Periods      []*ReconciliationPeriod `json:"periods"`
+}
+
+func (summary *PlSummary) add(pl, profit float64) {
+	if summary.Ops == 0 {
+		summary.Profit = 1
+	}
+
+	summary.Ops++
+	summary.Pl += pl
+	summary.Profit *= profit + 1
+	if profit > 0 {
+		summary.wins++
+	}
+	summary.WinRate = float64(summary.wins) / float64(summary.Ops)
+}
+
+// paperResult returns the profit on the account currency and the profit ratio
+// that the order would have obtained filled at the reference prices, the
+// results of the legs of the order are aggregated
+func paperResult(op *charont.Order) (pl, profit float64) {
+	if len(op.Legs) > 0 {
+		var units float64
+		for _, leg := range op.Legs {
+			legPl, legProfit := paperResult(leg)
+			pl += legPl
+			profit += legProfit * float64(leg.Units)
+			units += float64(leg.Units)
+		}
+
+		return pl, profit / units
+	}
+	if op.OpenRef == 0 || op.CloseRef == 0 {
+		return op.FillPl(), op.Profit
+	}
+
+	profit = op.CloseRef/op.OpenRef - 1
+	if op.Type == "sell" {
+		profit = op.OpenRef/op.CloseRef - 1
+	}
+
+	return op.FillPl() + op.SlippageCost, profit
+}
+
+// Reconcile builds the reconciliation report of the closed ops of the trader
+func (bt *baseTrader) Reconcile() (rec *Reconciliation) {
+	bt.mutex.Lock()
+	defer bt.mutex.Unlock()
+
+	rec = &Reconciliation{
+		TraderID:   bt.id,
+		Type:       bt.typeName,
+		Currencies: bt.GetCurrencies(),
+		Periods:    []*ReconciliationPeriod{},
+	}
+
+	var period *ReconciliationPeriod
+	for _, op := range bt.ops {
+		if !op.Real {
+			rec.Simulated.add(op.Pl, op.Profit)
+			period = nil
+			continue
+		}
+
+		if period == nil {
+			period = &ReconciliationPeriod{
+				From: op.BuyTs,
+			}
+			rec.Periods = append(rec.Periods, period)
+		}
+		if op.SellTs > period.To {
+			period.To = op.SellTs
+		}
+
+		paperPl, paperProfit := paperResult(op)
+		otherCost := op.FillPl() - op.Pl
+
+		period.Live.add(op.Pl, op.Profit)
+		period.Paper.add(paperPl, paperProfit)
+		period.SpreadCost += op.SpreadCost
+		period.SlippageCost += op.SlippageCost
+		period.OtherCost += otherCost
+
+		rec.Live.add(op.Pl, op.Profit)
+		rec.Paper.add(paperPl, paperProfit)
+		rec.SpreadCost += op.SpreadCost
+		rec.SlippageCost += op.SlippageCost
+		rec.OtherCost += otherCost
+	}
+
+	return
+}
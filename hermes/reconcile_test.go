@@ -0,0 +1,39 @@
+package hermes
+
+import (
+	"math"
+	"testing"
+
+	"github.com/alonsovidales/v/charont"
+)
+
+func TestReconcile(t *testing.T) {
+	bt := newBaseTrader("test", &TraderConf{ID: 2, Curr: "USD", Collector: getCollectorTest()}, nil)
+	bt.ops = []*charont.Order{
+		{Type: "buy", Real: false, Units: 10, Price: 1, CloseRate: 1.1, Profit: 0.1, Pl: 10 / 1.1},
+		{Type: "buy", Real: true, Units: 10, Price: 1.01, CloseRate: 1.1, OpenRef: 1, CloseRef: 1.1, Profit: 1.1/1.01 - 1, Pl: 0.7, SlippageCost: 0.1 / 1.1, BuyTs: 5, SellTs: 8},
+		{Type: "buy", Real: true, Units: 10, Price: 1, CloseRate: 0.9, OpenRef: 1, CloseRef: 0.9, Profit: -0.1, Pl: -1 / 0.9, BuyTs: 9, SellTs: 10},
+		{Type: "buy", Real: false, Units: 10, Price: 1, CloseRate: 1, Profit: 0},
+		{Type: "buy", Real: true, Units: 10, Price: 1, CloseRate: 1, OpenRef: 1, CloseRef: 1, BuyTs: 20, SellTs: 30},
+	}
+
+	rec := bt.Reconcile()
+	if len(rec.Periods) != 2 || rec.Periods[0].From != 5 || rec.Periods[0].To != 10 || rec.Periods[0].Live.Ops != 2 {
+		t.Fatal("Two live periods expected, Periods:", len(rec.Periods))
+	}
+	if rec.Simulated.Ops != 2 || rec.Live.Ops != 3 || rec.Paper.Ops != 3 {
+		t.Error("Unexpected number of ops, Simulated:", rec.Simulated.Ops, "Live:", rec.Live.Ops, "Paper:", rec.Paper.Ops)
+	}
+
+	// The first live op lost 0.1 on slippage and the broker charged the
+	// difference between its fills profit and 0.7
+	if math.Abs(rec.Periods[0].Paper.Pl-rec.Periods[0].Live.Pl-rec.Periods[0].SlippageCost-rec.Periods[0].OtherCost) > 1e-9 {
+		t.Error("The difference between paper and live should be attributed to the costs, Paper:", rec.Periods[0].Paper.Pl, "Live:", rec.Periods[0].Live.Pl)
+	}
+	if math.Abs(rec.OtherCost-(0.9/1.1-0.7)) > 1e-9 {
+		t.Error("Unexpected other costs:", rec.OtherCost)
+	}
+	if math.Abs(rec.Paper.Profit-1.1*0.9) > 1e-9 {
+		t.Error("The paper profit should use the reference prices:", rec.Paper.Profit)
+	}
+}
@@ -0,0 +1,146 @@
+package hermes
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/alonsovidales/v/charont"
+	"github.com/alonsovidales/v/philoctetes"
+)
+
+// Param is a configuration parameter declared by a trader type, the Default
+// value is used when the parameter is not specified
+type Param struct {
+	Name    string
+	Default string
+	Desc    string
+}
+
+// TraderConf contains all the information required to build a trader, Params
+// contains the values for the parameters declared by the trader type and
+// Tracer, if not nil, receives the decisions of the trader
+type TraderConf struct {
+	ID        int
+	Curr      string
+	Trainer   philoctetes.TrainerInt
+	Collector charont.Int
+	Units     int
+	Risk      *RiskLimits
+	Tracer    *Tracer
+	Params    map[string]string
+	// OnEvent receives the events of the trader, see Event
+	OnEvent func(ev *Event)
+}
+
+// TraderType describes a trader implementation that can be built from config
+type TraderType struct {
+	Name   string
+	Desc   string
+	Params []Param
+	Build  func(conf *TraderConf) (Int, error)
+}
+
+var (
+	traderTypes      = make(map[string]*TraderType)
+	traderTypesMutex sync.Mutex
+)
+
+// Register adds a new trader type to the registry, it panics if a trader type
+// with the same name was already registered
+func Register(tt *TraderType) {
+	traderTypesMutex.Lock()
+	defer traderTypesMutex.Unlock()
+
+	if _, ok := traderTypes[tt.Name]; ok {
+		panic("hermes: trader type already registered: " + tt.Name)
+	}
+	traderTypes[tt.Name] = tt
+}
+
+// GetTraderType returns the registered trader type with the given name
+func GetTraderType(name string) (tt *TraderType, ok bool) {
+	traderTypesMutex.Lock()
+	defer traderTypesMutex.Unlock()
+
+	tt, ok = traderTypes[name]
+
+	return
+}
+
+// GetTraderTypes returns the names of all the registered trader types
+func GetTraderTypes() (names []string) {
+	traderTypesMutex.Lock()
+	defer traderTypesMutex.Unlock()
+
+	for name := range traderTypes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return
+}
+
+// withParams returns the params of a trader type followed by the shared ones
+func withParams(params []Param, shared ...[]Param) []Param {
+	for _, extra := range shared {
+		params = append(params, extra...)
+	}
+
+	return params
+}
+
+// GetTrader builds a new trader of the given type, the parameters that are not
+// specified on the configuration are set to the defaults declared by the type
+func GetTrader(typeName string, conf *TraderConf) (trader Int, err error) {
+	tt, ok := GetTraderType(typeName)
+	if !ok {
+		return nil, fmt.Errorf("hermes: unknown trader type: %s", typeName)
+	}
+
+	params := make(map[string]string)
+	for _, param := range tt.Params {
+		params[param.Name] = param.Default
+	}
+	for name, value := range conf.Params {
+		if _, declared := params[name]; !declared {
+			return nil, fmt.Errorf("hermes: the parameter %s is not declared by the trader type %s", name, typeName)
+		}
+		if value != "" {
+			params[name] = value
+		}
+	}
+
+	confCopy := *conf
+	confCopy.Params = params
+
+	return tt.Build(&confCopy)
+}
+
+// GetFloat returns the value of a float parameter
+func (conf *TraderConf) GetFloat(name string) (val float64, err error) {
+	if val, err = strconv.ParseFloat(conf.Params[name], 64); err != nil {
+		err = fmt.Errorf("hermes: the parameter %s is not a valid float: %s", name, conf.Params[name])
+	}
+
+	return
+}
+
+// GetInt returns the value of an integer parameter
+func (conf *TraderConf) GetInt(name string) (val int, err error) {
+	if val, err = strconv.Atoi(conf.Params[name]); err != nil {
+		err = fmt.Errorf("hermes: the parameter %s is not a valid integer: %s", name, conf.Params[name])
+	}
+
+	return
+}
+
+// GetBool returns the value of a boolean parameter
+func (conf *TraderConf) GetBool(name string) (val bool, err error) {
+	if val, err = strconv.ParseBool(conf.Params[name]); err != nil {
+		err = fmt.Errorf("hermes: the parameter %s is not a valid boolean: %s", name, conf.Params[name])
+	}
+
+	return
+}
@@ -0,0 +1,149 @@
+package hermes
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/alonsovidales/v/charont"
+)
+
+type collectorTest struct {
+	charont.Int
+
+	vals      map[string][]*charont.CurrVal
+	listeners map[string][]func(currency string, ts int64)
+	orders    int64
+	// failClose is the currency on which the orders can't be closed
+	failClose string
+	// failOrder is the number of the order that can't be placed
+	failOrder int64
+}
+
+func getCollectorTest() *collectorTest {
+	return &collectorTest{
+		vals:      make(map[string][]*charont.CurrVal),
+		listeners: make(map[string][]func(currency string, ts int64)),
+	}
+}
+
+func (ct *collectorTest) GetAllCurrVals() map[string][]*charont.CurrVal {
+	return ct.vals
+}
+
+func (ct *collectorTest) AddListerner(currency string, fn func(currency string, ts int64)) {
+	ct.listeners[currency] = append(ct.listeners[currency], fn)
+}
+
+func (ct *collectorTest) addVal(curr string, val *charont.CurrVal) {
+	ct.vals[curr] = append(ct.vals[curr], val)
+	for _, listener := range ct.listeners[curr] {
+		listener(curr, val.Ts)
+	}
+}
+
+func (ct *collectorTest) placeOrder(curr string, units int, side string, price float64, realOps bool, ts int64) (*charont.Order, error) {
+	ct.orders++
+	if ct.orders == ct.failOrder {
+		return nil, fmt.Errorf("the order can't be placed")
+	}
+	ord := &charont.Order{
+		Id:    ct.orders,
+		Curr:  curr,
+		Units: units,
+		Type:  side,
+		Real:  realOps,
+		Open:  true,
+		BuyTs: ts,
+	}
+	if side == "buy" {
+		ord.Price = price
+	} else {
+		ord.CloseRate = price
+	}
+
+	return ord, nil
+}
+
+func (ct *collectorTest) Buy(curr string, units int, bound float64, realOps bool, ts int64) (*charont.Order, error) {
+	return ct.placeOrder(curr, units, "buy", bound, realOps, ts)
+}
+
+func (ct *collectorTest) Sell(curr string, units int, bound float64, realOps bool, ts int64) (*charont.Order, error) {
+	return ct.placeOrder(curr, units, "sell", bound, realOps, ts)
+}
+
+func (ct *collectorTest) CloseOrder(ord *charont.Order, ts int64) error {
+	if ord.Curr == ct.failClose {
+		return fmt.Errorf("the order can't be closed")
+	}
+	last := ct.vals[ord.Curr][len(ct.vals[ord.Curr])-1]
+	if ord.Type == "buy" {
+		ord.CloseRate = last.Bid
+	} else {
+		ord.Price = last.Ask
+	}
+	ord.Profit = ord.CloseRate/ord.Price - 1
+	ord.SellTs = ts
+	ord.Open = false
+
+	return nil
+}
+
+func TestRegistryDefaults(t *testing.T) {
+	trader, err := GetTrader(GridTraderType, &TraderConf{
+		ID:        7,
+		Curr:      "USD",
+		Collector: getCollectorTest(),
+		Units:     10,
+		Params: map[string]string{
+			"levels": "3",
+			"step":   "",
+		},
+	})
+	if err != nil {
+		t.Fatal("Problem building the grid trader, Error:", err)
+	}
+
+	gt := trader.(*gridTrader)
+	if gt.levels != 3 || gt.step != 0.0005 || gt.side != "buy" {
+		t.Error("Unexpected grid trader params, Levels:", gt.levels, "Step:", gt.step, "Side:", gt.side)
+	}
+	if trader.GetID() != 7 || trader.GetType() != GridTraderType || trader.GetCurrencies()[0] != "USD" {
+		t.Error("Unexpected trader identification:", trader.GetID(), trader.GetType(), trader.GetCurrencies())
+	}
+
+	if _, err = GetTrader(GridTraderType, &TraderConf{Collector: getCollectorTest(), Params: map[string]string{"unknown": "1"}}); err == nil {
+		t.Error("A not declared param was accepted")
+	}
+	if _, err = GetTrader(ScalperTraderType, &TraderConf{Collector: getCollectorTest(), Params: map[string]string{"take-profits": "0.01,0.02"}}); err == nil {
+		t.Error("Scaled take profits were accepted by a trader without lots")
+	}
+	if _, err = GetTrader("unknown", &TraderConf{Collector: getCollectorTest()}); err == nil {
+		t.Error("An unknown trader type was built")
+	}
+}
+
+func TestGridTrader(t *testing.T) {
+	collector := getCollectorTest()
+	trader, _ := GetTrader(GridTraderType, &TraderConf{
+		Curr:      "USD",
+		Collector: collector,
+		Units:     1,
+		Params: map[string]string{
+			"step":   "0.01",
+			"levels": "2",
+		},
+	})
+
+	collector.addVal("USD", &charont.CurrVal{Ts: 1, Bid: 1.00, Ask: 1.00})
+	collector.addVal("USD", &charont.CurrVal{Ts: 2, Bid: 0.99, Ask: 0.99})
+	collector.addVal("USD", &charont.CurrVal{Ts: 3, Bid: 0.98, Ask: 0.98})
+	if len(trader.(*gridTrader).positions) != 2 {
+		t.Fatal("Two positions were expected, but:", len(trader.(*gridTrader).positions), "are open")
+	}
+
+	collector.addVal("USD", &charont.CurrVal{Ts: 4, Bid: 1.00, Ask: 1.00})
+	if trader.GetNumOps() != 1 || len(trader.(*gridTrader).positions) != 1 {
+		t.Error("Only the last level should take profit, ops:", trader.GetNumOps())
+	}
+}
@@ -0,0 +1,192 @@
+package hermes
+
+import (
+	"fmt"
+	"sync"
+)
+
+const (
+	TraderActive    = "active"
+	TraderSuspended = "suspended"
+
+	RiskStopLoss          = "stop-loss"
+	RiskMaxDrawdown       = "max-drawdown"
+	RiskDailyLoss         = "daily-loss"
+	RiskConsecutiveLosses = "consecutive-losses"
+
+	dayNanosecs = 24 * 3600 * tsMultToSecs
+)
+
+// RiskLimits defines the rules that suspend a trader, all the losses are
+// ratios over the price or over the compounded profit, a zero value disables
+// the rule
+type RiskLimits struct {
+	StopLoss             float64
+	MaxDrawdown          float64
+	DailyLossLimit       float64
+	MaxConsecutiveLosses int
+}
+
+// RiskState is the current state of a trader regarding its risk limits, a
+// trader suspended by the daily loss limit is resumed automatically the next
+// day, all the other suspensions require a manual reset
+type RiskState struct {
+	State             string
+	Reason            string
+	SuspendedTs       int64
+	Equity            float64
+	Peak              float64
+	Drawdown          float64
+	Day               int64
+	DailyProfit       float64
+	ConsecutiveLosses int
+}
+
+type riskManager struct {
+	limits *RiskLimits
+	state  RiskState
+	mutex  sync.Mutex
+}
+
+func newRiskManager(limits *RiskLimits) *riskManager {
+	if limits == nil {
+		limits = &RiskLimits{}
+	}
+
+	return &riskManager{
+		limits: limits,
+		state: RiskState{
+			State:       TraderActive,
+			Equity:      1,
+			Peak:        1,
+			DailyProfit: 1,
+		},
+	}
+}
+
+// suspended returns true if the trader can't open new positions at the given
+// time
+func (rm *riskManager) suspended(ts int64) bool {
+	rm.mutex.Lock()
+	defer rm.mutex.Unlock()
+
+	if rm.state.State == TraderSuspended && rm.state.Reason == RiskDailyLoss && ts/dayNanosecs != rm.state.Day {
+		rm.state.State = TraderActive
+		rm.state.Reason = ""
+		rm.state.Day = ts / dayNanosecs
+		rm.state.DailyProfit = 1
+	}
+
+	return rm.state.State == TraderSuspended
+}
+
+// positionBreach returns true if the current profit of an open position is
+// under the stop loss
+func (rm *riskManager) positionBreach(currentWin float64, ts int64) bool {
+	rm.mutex.Lock()
+	defer rm.mutex.Unlock()
+
+	if rm.limits.StopLoss == 0 || currentWin > -rm.limits.StopLoss {
+		return false
+	}
+
+	rm.suspend(RiskStopLoss, ts)
+
+	return true
+}
+
+// opClosed updates the state with the profit of a closed op and checks all
+// the limits, returns true if a limit was breached
+func (rm *riskManager) opClosed(profit float64, ts int64) bool {
+	rm.mutex.Lock()
+	defer rm.mutex.Unlock()
+
+	rm.state.Equity *= profit + 1
+	if rm.state.Equity > rm.state.Peak {
+		rm.state.Peak = rm.state.Equity
+	}
+	rm.state.Drawdown = 1 - rm.state.Equity/rm.state.Peak
+
+	if ts/dayNanosecs != rm.state.Day {
+		rm.state.Day = ts / dayNanosecs
+		rm.state.DailyProfit = 1
+	}
+	rm.state.DailyProfit *= profit + 1
+
+	if profit < 0 {
+		rm.state.ConsecutiveLosses++
+	} else {
+		rm.state.ConsecutiveLosses = 0
+	}
+
+	if rm.state.State == TraderSuspended {
+		return false
+	}
+
+	switch {
+	case rm.limits.MaxDrawdown != 0 && rm.state.Drawdown >= rm.limits.MaxDrawdown:
+		rm.suspend(RiskMaxDrawdown, ts)
+	case rm.limits.DailyLossLimit != 0 && 1-rm.state.DailyProfit >= rm.limits.DailyLossLimit:
+		rm.suspend(RiskDailyLoss, ts)
+	case rm.limits.MaxConsecutiveLosses != 0 && rm.state.ConsecutiveLosses >= rm.limits.MaxConsecutiveLosses:
+		rm.suspend(RiskConsecutiveLosses, ts)
+	default:
+		return false
+	}
+
+	return true
+}
+
+// suspend The mutex has to be locked
+func (rm *riskManager) suspend(reason string, ts int64) {
+	if rm.state.State == TraderSuspended {
+		return
+	}
+
+	rm.state.State = TraderSuspended
+	rm.state.Reason = reason
+	rm.state.SuspendedTs = ts
+}
+
+// reset resumes the trader and measures the daily loss, the consecutive
+// losses and the drawdown again from now
+func (rm *riskManager) reset() {
+	rm.mutex.Lock()
+	defer rm.mutex.Unlock()
+
+	rm.state.State = TraderActive
+	rm.state.Reason = ""
+	rm.state.DailyProfit = 1
+	rm.state.ConsecutiveLosses = 0
+	rm.state.Peak = rm.state.Equity
+	rm.state.Drawdown = 0
+}
+
+func (rm *riskManager) setLimits(limits RiskLimits) {
+	rm.mutex.Lock()
+	defer rm.mutex.Unlock()
+
+	rm.limits = &limits
+}
+
+func (rm *riskManager) getLimits() RiskLimits {
+	rm.mutex.Lock()
+	defer rm.mutex.Unlock()
+
+	return *rm.limits
+}
+
+func (rm *riskManager) getState() RiskState {
+	rm.mutex.Lock()
+	defer rm.mutex.Unlock()
+
+	return rm.state
+}
+
+func (rs RiskState) String() string {
+	if rs.State == TraderActive {
+		return TraderActive
+	}
+
+	return fmt.Sprintf("%s by %s", rs.State, rs.Reason)
+}
@@ -0,0 +1,53 @@
+package hermes
+
+import (
+	"testing"
+)
+
+func TestRiskLimits(t *testing.T) {
+	rm := newRiskManager(&RiskLimits{
+		MaxConsecutiveLosses: 2,
+	})
+	rm.opClosed(-0.01, 1)
+	if rm.suspended(1) {
+		t.Fatal("The trader was suspended after a single loss")
+	}
+	rm.opClosed(-0.01, 2)
+	if !rm.suspended(2) || rm.getState().Reason != RiskConsecutiveLosses {
+		t.Fatal("The trader was not suspended after two losses, state:", rm.getState())
+	}
+	if !rm.suspended(dayNanosecs * 2) {
+		t.Error("Only the daily loss suspensions are resumed the next day")
+	}
+	rm.reset()
+	if rm.suspended(3) {
+		t.Error("The trader is still suspended after the reset")
+	}
+
+	rm = newRiskManager(&RiskLimits{
+		DailyLossLimit: 0.05,
+		MaxDrawdown:    0.5,
+	})
+	rm.opClosed(0.01, 1)
+	rm.opClosed(-0.06, 2)
+	if !rm.suspended(3) || rm.getState().Reason != RiskDailyLoss {
+		t.Fatal("The trader was not suspended by the daily loss, state:", rm.getState())
+	}
+	if rm.suspended(dayNanosecs + 1) {
+		t.Error("The daily loss suspension was not resumed the next day")
+	}
+	rm.opClosed(-0.06, dayNanosecs+2)
+	rm.reset()
+	rm.opClosed(-0.01, dayNanosecs+3)
+	if rm.suspended(dayNanosecs + 3) {
+		t.Error("The daily loss should be measured again after a manual reset, state:", rm.getState())
+	}
+
+	rm = newRiskManager(&RiskLimits{StopLoss: 0.01})
+	if rm.positionBreach(-0.005, 1) {
+		t.Error("The stop loss was breached before the limit")
+	}
+	if !rm.positionBreach(-0.02, 2) || !rm.suspended(2) {
+		t.Error("The stop loss was not breached")
+	}
+}
@@ -0,0 +1,144 @@
+package hermes
+
+import (
+	"github.com/alonsovidales/pit/log"
+	"github.com/alonsovidales/v/philoctetes"
+)
+
+const (
+	ScalperTraderType = "scalper"
+)
+
+func init() {
+	Register(&TraderType{
+		Name: ScalperTraderType,
+		Desc: "Opens a position when the trainer says so and closes it with a fixed take profit, stop loss or timeout",
+		Params: withParams([]Param{
+			{Name: "take-profit", Default: "0.0005", Desc: "Profit ratio to close the position"},
+			{Name: "stop-loss", Default: "0.0010", Desc: "Loss ratio to close the position"},
+			{Name: "max-secs", Default: "600", Desc: "Max seconds to keep the position open"},
+		}, exitParams, sizingParams, throttleParams),
+		Build: func(conf *TraderConf) (Int, error) {
+			takeProfit, err := conf.GetFloat("take-profit")
+			if err != nil {
+				return nil, err
+			}
+			stopLoss, err := conf.GetFloat("stop-loss")
+			if err != nil {
+				return nil, err
+			}
+			maxSecs, err := conf.GetInt("max-secs")
+			if err != nil {
+				return nil, err
+			}
+			exits, err := getExitPolicies(conf)
+			if err != nil {
+				return nil, err
+			}
+			if err = exits.validateLots(1); err != nil {
+				return nil, err
+			}
+			sizing, err := getSizing(conf)
+			if err != nil {
+				return nil, err
+			}
+			throttleLimits, err := getThrottleLimits(conf)
+			if err != nil {
+				return nil, err
+			}
+
+			st := GetScalperTrader(conf, takeProfit, stopLoss, maxSecs)
+			st.exits = exits
+			st.sizing = sizing
+			st.throttle = newThrottle(throttleLimits)
+
+			return st, nil
+		},
+	})
+}
+
+type scalperTrader struct {
+	*baseTrader
+
+	trainer    philoctetes.TrainerInt
+	takeProfit float64
+	stopLoss   float64
+	maxSecs    int64
+}
+
+func GetScalperTrader(conf *TraderConf, takeProfit, stopLoss float64, maxSecs int) (st *scalperTrader) {
+	st = &scalperTrader{
+		baseTrader: newBaseTrader(ScalperTraderType, conf, nil),
+		trainer:    conf.Trainer,
+		takeProfit: takeProfit,
+		stopLoss:   stopLoss,
+		maxSecs:    int64(maxSecs),
+	}
+
+	conf.Collector.AddListerner(conf.Curr, st.NewPrices)
+
+	return
+}
+
+func (st *scalperTrader) NewPrices(curr string, ts int64) {
+	st.mutex.Lock()
+	defer st.mutex.Unlock()
+
+	if st.retired {
+		return
+	}
+	currVals := st.collector.GetAllCurrVals()
+	lastVal := currVals[curr][len(currVals[curr])-1]
+	decision := st.newDecision(curr, lastVal)
+	defer st.trace(decision, currVals)
+	defer st.exportPositions(currVals, lastVal.Ts)
+	if st.checkRisk(currVals, lastVal.Ts, decision) {
+		return
+	}
+
+	if len(st.positions) == 0 {
+		should, typeOper := st.trainer.ShouldIOperate(curr, currVals, st.id)
+		if !should {
+			decision.Reason = ReasonNoSignal
+			return
+		}
+		log.Debug("Scalper open:", curr, "ID:", st.id, "Type:", typeOper, "Real:", st.realOpsStr())
+		entry, err := st.openPosition(curr, typeOper, lastVal)
+		decision.opened(typeOper, entry, err)
+		return
+	}
+
+	// The exit policies can close a part of the lots, the scalper limits close
+	// the whole entry
+	entry := st.entryPositions()[0]
+	pos := entry[0]
+	reason, lots := st.checkExits(entry, currVals[curr])
+	scaled := reason == CloseTakeProfit
+	if reason == "" {
+		currentWin := st.positionWin(pos, lastVal)
+		switch {
+		case currentWin >= st.takeProfit:
+			reason = CloseTakeProfit
+		case currentWin <= -st.stopLoss:
+			reason = CloseStopLoss
+		case lastVal.Ts-pos.openVal.Ts > st.maxSecs*tsMultToSecs:
+			reason = CloseTimeout
+		default:
+			return
+		}
+		lots = entry
+	}
+
+	lotsClosed := 0
+	for _, lot := range lots {
+		if err := st.closePosition(lot, lastVal, reason); err == nil {
+			log.Debug("Scalper close:", curr, "ID:", st.id, "Reason:", reason, "Profit:", lot.ord.Profit, "Real:", st.realOpsStr())
+			decision.closed(lot, reason)
+			lotsClosed++
+		}
+	}
+	// The take profit level is kept until its lots can be closed
+	if scaled && lotsClosed > 0 {
+		st.exits.nextTakeProfit(entry)
+	}
+}
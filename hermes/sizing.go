@@ -0,0 +1,291 @@
+package hermes
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/alonsovidales/pit/log"
+	"github.com/alonsovidales/v/charont"
+)
+
+const (
+	SizingFixed      = "fixed"
+	SizingFractional = "fractional"
+	SizingVolatility = "volatility"
+	SizingKelly      = "kelly"
+	SizingScore      = "score"
+
+	// NoAllocation releases the capital allocated to a trader
+	NoAllocation = -1
+
+	VolATR      = "atr"
+	VolRealized = "realized"
+)
+
+// sizingParams are the parameters to configure the size of the entries,
+// shared by all the trader types
+var sizingParams = []Param{
+	{Name: "sizing", Default: SizingFixed, Desc: "Sizing strategy: fixed, fractional, volatility, kelly or score"},
+	{Name: "risk-fraction", Default: "0.01", Desc: "Fraction of the equity to use on each entry by the fractional, volatility and kelly sizing"},
+	{Name: "equity", Default: "0", Desc: "Equity used when the broker doesn't provide it"},
+	{Name: "equity-refresh-secs", Default: "60", Desc: "Seconds between the updates of the equity of the account obtained from the broker"},
+	{Name: "vol-mode", Default: VolATR, Desc: "Volatility measure for the volatility sizing: atr or realized"},
+	{Name: "vol-samples", Default: "100", Desc: "Number of samples used to measure the volatility"},
+	{Name: "vol-mult", Default: "10", Desc: "Distance in volatilities of the risk taken by the volatility sizing"},
+	{Name: "kelly-fraction", Default: "0.5", Desc: "Fraction of the Kelly criterion to use"},
+	{Name: "kelly-min-ops", Default: "20", Desc: "Closed ops required before use the Kelly criterion, the fixed units are used before"},
+	{Name: "kelly-window", Default: "100", Desc: "Number of the last closed ops used by the Kelly criterion"},
+	{Name: "max-score-mult", Default: "2", Desc: "Max multiplier over the fixed units for the score sizing"},
+	{Name: "units-increment", Default: "1", Desc: "Min trade increment of the instrument, the sizes are rounded down to it"},
+	{Name: "max-units", Default: "0", Desc: "Max units of an entry, zero for no limit"},
+}
+
+// Sizing configures how many units are used on each new entry, the units are
+// on the account currency. Units is the size used by the fixed strategy and
+// as base by the score one. Allocation is the capital assigned to the trader
+// while it plays, when Allocated it replaces the units on the fixed and score
+// strategies and the equity on the others
+type Sizing struct {
+	Mode              string
+	Units             int
+	RiskFraction      float64
+	Equity            float64
+	EquityRefreshSecs int
+	VolMode           string
+	VolSamples        int
+	VolMult           float64
+	KellyFraction     float64
+	KellyMinOps       int
+	KellyWindow       int
+	MaxScoreMult      float64
+	UnitsIncrement    int
+	MaxUnits          int
+	Allocation        float64
+	Allocated         bool
+}
+
+func getSizing(conf *TraderConf) (sizing *Sizing, err error) {
+	sizing = &Sizing{
+		Mode:    conf.Params["sizing"],
+		Units:   conf.Units,
+		VolMode: conf.Params["vol-mode"],
+	}
+	if sizing.RiskFraction, err = conf.GetFloat("risk-fraction"); err != nil {
+		return
+	}
+	if sizing.Equity, err = conf.GetFloat("equity"); err != nil {
+		return
+	}
+	if sizing.EquityRefreshSecs, err = conf.GetInt("equity-refresh-secs"); err != nil {
+		return
+	}
+	if sizing.VolSamples, err = conf.GetInt("vol-samples"); err != nil {
+		return
+	}
+	if sizing.VolMult, err = conf.GetFloat("vol-mult"); err != nil {
+		return
+	}
+	if sizing.KellyFraction, err = conf.GetFloat("kelly-fraction"); err != nil {
+		return
+	}
+	if sizing.KellyMinOps, err = conf.GetInt("kelly-min-ops"); err != nil {
+		return
+	}
+	if sizing.KellyWindow, err = conf.GetInt("kelly-window"); err != nil {
+		return
+	}
+	if sizing.MaxScoreMult, err = conf.GetFloat("max-score-mult"); err != nil {
+		return
+	}
+	if sizing.UnitsIncrement, err = conf.GetInt("units-increment"); err != nil {
+		return
+	}
+	if sizing.MaxUnits, err = conf.GetInt("max-units"); err != nil {
+		return
+	}
+
+	return sizing, sizing.Validate()
+}
+
+// Validate checks that the sizing is consistent
+func (sizing *Sizing) Validate() error {
+	switch sizing.Mode {
+	case SizingFixed, SizingFractional, SizingVolatility, SizingKelly, SizingScore:
+	default:
+		return fmt.Errorf("hermes: unknown sizing strategy: %s", sizing.Mode)
+	}
+	if sizing.VolMode != VolATR && sizing.VolMode != VolRealized {
+		return fmt.Errorf("hermes: unknown volatility mode: %s", sizing.VolMode)
+	}
+	if sizing.UnitsIncrement < 1 {
+		return fmt.Errorf("hermes: the units increment has to be at least one")
+	}
+	if sizing.Mode == SizingKelly && sizing.KellyWindow < sizing.KellyMinOps {
+		return fmt.Errorf("hermes: the Kelly window can't be smaller than the min ops")
+	}
+	if sizing.Mode == SizingScore && sizing.MaxScoreMult < 1 {
+		return fmt.Errorf("hermes: the max score multiplier has to be at least one")
+	}
+
+	return nil
+}
+
+// round rounds down the units to the trade increment and applies the max
+// units
+func (sizing *Sizing) round(units float64) int {
+	if sizing.MaxUnits > 0 && units > float64(sizing.MaxUnits) {
+		units = float64(sizing.MaxUnits)
+	}
+	if units < 0 || math.IsNaN(units) || math.IsInf(units, 0) {
+		return 0
+	}
+
+	return int(units) / sizing.UnitsIncrement * sizing.UnitsIncrement
+}
+
+// realizedVol returns the standard deviation of the variation of the mid
+// price between the last samples
+func realizedVol(vals []*charont.CurrVal, samples int) float64 {
+	if len(vals) < 3 {
+		return 0
+	}
+	if len(vals) > samples+1 {
+		vals = vals[len(vals)-samples-1:]
+	}
+
+	var sum, sumSq float64
+	for i := 1; i < len(vals); i++ {
+		diff := (vals[i].Ask+vals[i].Bid)/2 - (vals[i-1].Ask+vals[i-1].Bid)/2
+		sum += diff
+		sumSq += diff * diff
+	}
+	n := float64(len(vals) - 1)
+
+	return math.Sqrt(math.Max(sumSq/n-(sum/n)*(sum/n), 0))
+}
+
+// kelly returns the fraction of the equity to bet according to the Kelly
+// criterion using the last closed ops on the window, and false if there are
+// not enough ops or none of them lost, the payoff is unknown until the first
+// loss
+func kelly(ops []*charont.Order, minOps, window int) (fraction float64, ok bool) {
+	if window > 0 && len(ops) > window {
+		ops = ops[len(ops)-window:]
+	}
+	if len(ops) < minOps || len(ops) == 0 {
+		return 0, false
+	}
+
+	var wins, winSum, lossSum float64
+	for _, op := range ops {
+		if op.Profit > 0 {
+			wins++
+			winSum += op.Profit
+		} else {
+			lossSum -= op.Profit
+		}
+	}
+	if lossSum == 0 {
+		return 0, false
+	}
+	winRate := wins / float64(len(ops))
+	if wins == 0 {
+		return 0, true
+	}
+
+	payoff := (winSum / wins) / (lossSum / (float64(len(ops)) - wins))
+
+	return winRate - (1-winRate)/payoff, true
+}
+
+// equity returns the capital allocated to the trader, the last equity of the
+// account obtained from the broker if available, or the configured one. The
+// equity of the account is refreshed on background once it is older than the
+// refresh period. The mutex has to be locked
+func (bt *baseTrader) equity() float64 {
+	if bt.sizing.Allocated {
+		return bt.sizing.Allocation
+	}
+	if account, ok := bt.collector.(charont.AccountInt); ok {
+		if !bt.refreshingEquity && time.Since(bt.equityTs) >= time.Duration(bt.sizing.EquityRefreshSecs)*time.Second {
+			bt.refreshingEquity = true
+			go bt.refreshEquity(account)
+		}
+		if !bt.equityTs.IsZero() {
+			return bt.accountEquity
+		}
+	}
+
+	return bt.sizing.Equity
+}
+
+// refreshEquity obtains the equity of the account from the broker, the last
+// one is kept if it can't be obtained
+func (bt *baseTrader) refreshEquity(account charont.AccountInt) {
+	equity, err := account.GetEquity()
+
+	bt.mutex.Lock()
+	defer bt.mutex.Unlock()
+
+	bt.refreshingEquity = false
+	if err != nil {
+		log.Error("The equity can't be obtained from the broker, Trader:", bt.id, "Error:", err)
+		return
+	}
+	bt.accountEquity = equity
+	bt.equityTs = time.Now()
+}
+
+// entryUnits returns the units to be used by a new entry, zero if the entry
+// shouldn't be opened. The mutex has to be locked
+func (bt *baseTrader) entryUnits(curr, typeOper string, lastVal *charont.CurrVal) int {
+	sizing := bt.sizing
+	price := (lastVal.Ask + lastVal.Bid) / 2
+	units := float64(sizing.Units)
+	if sizing.Allocated {
+		units = sizing.Allocation
+	}
+
+	switch sizing.Mode {
+	case SizingFractional:
+		units = bt.equity() * sizing.RiskFraction
+	case SizingVolatility:
+		vals := bt.collector.GetAllCurrVals()[curr]
+		vol := atr(vals, sizing.VolSamples)
+		if sizing.VolMode == VolRealized {
+			vol = realizedVol(vals, sizing.VolSamples)
+		}
+		if vol == 0 {
+			return 0
+		}
+		units = bt.equity() * sizing.RiskFraction * price / (vol * sizing.VolMult)
+	case SizingKelly:
+		fraction, ok := kelly(bt.ops, sizing.KellyMinOps, sizing.KellyWindow)
+		if !ok {
+			break
+		}
+		// without edge the simulated ops keep the fixed units, so the
+		// window can recover once the trader has it again
+		if fraction <= 0 && !bt.realOps {
+			break
+		}
+		units = bt.equity() * fraction * sizing.KellyFraction
+	case SizingScore:
+		if bt.scorer == nil {
+			break
+		}
+		scoreBuy, scoreSell, boundary, ok := bt.scorer.GetScores(curr, bt.collector.GetAllCurrVals(), bt.id)
+		if !ok || boundary <= 0 {
+			break
+		}
+		score := scoreBuy
+		if typeOper == "sell" {
+			score = scoreSell
+		}
+		// the entries that just cross the boundary use the base units
+		units *= math.Min(math.Max(score/boundary, 1), sizing.MaxScoreMult)
+	}
+
+	return sizing.round(units)
+}
@@ -0,0 +1,185 @@
+package hermes
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alonsovidales/v/charont"
+)
+
+type scorerTest struct {
+	scoreBuy  float64
+	scoreSell float64
+}
+
+func (sc *scorerTest) ShouldIOperate(curr string, vals map[string][]*charont.CurrVal, traderID int) (bool, string) {
+	return false, ""
+}
+
+func (sc *scorerTest) ShouldIClose(curr string, askVal *charont.CurrVal, vals map[string][]*charont.CurrVal, traderID int, ord *charont.Order) bool {
+	return false
+}
+
+func (sc *scorerTest) GetScores(curr string, vals map[string][]*charont.CurrVal, traderID int) (float64, float64, float64, bool) {
+	return sc.scoreBuy, sc.scoreSell, 0.5, true
+}
+
+func TestSizing(t *testing.T) {
+	collector := getCollectorTest()
+	bt := newBaseTrader("test", &TraderConf{
+		ID:        1,
+		Curr:      "EURUSD",
+		Collector: collector,
+		Units:     1000,
+		Trainer:   &scorerTest{scoreBuy: 0.75, scoreSell: 5},
+	}, nil)
+	lastVal := &charont.CurrVal{Ask: 1.25, Bid: 1.25}
+	collector.vals["EURUSD"] = []*charont.CurrVal{lastVal}
+
+	bt.sizing.UnitsIncrement = 100
+	if units := bt.entryUnits("EURUSD", "buy", lastVal); units != 1000 {
+		t.Error("Fixed units expected, Units:", units)
+	}
+
+	bt.sizing.Mode = SizingFractional
+	bt.sizing.Equity = 10000
+	bt.sizing.RiskFraction = 0.1
+	bt.sizing.RiskFraction = 0.105
+	if units := bt.entryUnits("EURUSD", "buy", lastVal); units != 1000 {
+		t.Error("Fractional units rounded to the increment expected, Units:", units)
+	}
+	bt.sizing.RiskFraction = 0.1
+
+	bt.sizing.Mode = SizingScore
+	bt.sizing.MaxScoreMult = 2
+	if units := bt.entryUnits("EURUSD", "buy", lastVal); units != 1500 {
+		t.Error("Units proportional to the score over the boundary expected, Units:", units)
+	}
+	bt.scorer = &scorerTest{scoreBuy: 0.55, scoreSell: 5}
+	if units := bt.entryUnits("EURUSD", "buy", lastVal); units != 1100 {
+		t.Error("Units proportional to the score over the boundary expected, Units:", units)
+	}
+	bt.scorer = &scorerTest{scoreBuy: 0.2, scoreSell: 5}
+	if units := bt.entryUnits("EURUSD", "buy", lastVal); units != 1000 {
+		t.Error("The fixed units should be the min of the score sizing, Units:", units)
+	}
+	if units := bt.entryUnits("EURUSD", "sell", lastVal); units != 2000 {
+		t.Error("The score multiplier should be limited, Units:", units)
+	}
+
+	bt.sizing.Mode = SizingKelly
+	bt.sizing.KellyMinOps = 4
+	bt.sizing.KellyFraction = 1
+	bt.ops = []*charont.Order{{Profit: 0.02}, {Profit: 0.02}, {Profit: 0.02}, {Profit: -0.02}}
+	// Win rate of 0.75 with a payoff of 1, Kelly fraction of 0.5
+	if units := bt.entryUnits("EURUSD", "buy", lastVal); units != 5000 {
+		t.Error("Units from the Kelly criterion expected, Units:", units)
+	}
+	bt.ops = []*charont.Order{{Profit: 0.02}, {Profit: 0.02}, {Profit: 0.02}, {Profit: 0.02}}
+	if units := bt.entryUnits("EURUSD", "buy", lastVal); units != 1000 {
+		t.Error("The fixed units should be used until the first loss, Units:", units)
+	}
+	bt.ops = []*charont.Order{{Profit: -0.02}, {Profit: -0.02}, {Profit: 0.02}, {Profit: -0.02}}
+	if units := bt.entryUnits("EURUSD", "buy", lastVal); units != 1000 {
+		t.Error("The fixed units should be used by the simulated ops without edge, Units:", units)
+	}
+	bt.realOps = true
+	if units := bt.entryUnits("EURUSD", "buy", lastVal); units != 0 {
+		t.Error("No real entry expected with a negative Kelly fraction, Units:", units)
+	}
+	bt.sizing.KellyWindow = 4
+	bt.ops = []*charont.Order{{Profit: -0.02}, {Profit: -0.02}, {Profit: 0.02}, {Profit: 0.02}, {Profit: 0.02}, {Profit: -0.02}}
+	if units := bt.entryUnits("EURUSD", "buy", lastVal); units != 5000 {
+		t.Error("Only the ops on the Kelly window should be considered, Units:", units)
+	}
+	bt.realOps = false
+
+	bt.SetAllocation(2000)
+	bt.sizing.Mode = SizingFractional
+	if units := bt.entryUnits("EURUSD", "buy", lastVal); units != 200 {
+		t.Error("The allocated capital should replace the equity, Units:", units)
+	}
+	bt.sizing.Mode = SizingFixed
+	if units := bt.entryUnits("EURUSD", "buy", lastVal); units != 2000 {
+		t.Error("The allocated capital should replace the fixed units, Units:", units)
+	}
+	bt.SetAllocation(0)
+	if units := bt.entryUnits("EURUSD", "buy", lastVal); units != 0 {
+		t.Error("No entry expected without capital allocated, Units:", units)
+	}
+	bt.SetAllocation(NoAllocation)
+	if units := bt.entryUnits("EURUSD", "buy", lastVal); units != 1000 {
+		t.Error("The fixed units should be used after release the allocation, Units:", units)
+	}
+}
+
+func TestVolatilitySizing(t *testing.T) {
+	collector := getCollectorTest()
+	bt := newBaseTrader("test", &TraderConf{ID: 1, Curr: "EURUSD", Collector: collector, Units: 1000}, nil)
+	for i, mid := range []float64{1.25, 1.26, 1.25, 1.26, 1.25} {
+		collector.vals["EURUSD"] = append(collector.vals["EURUSD"], &charont.CurrVal{Ask: mid, Bid: mid, Ts: int64(i)})
+	}
+	lastVal := collector.vals["EURUSD"][4]
+
+	bt.sizing.Mode = SizingVolatility
+	bt.sizing.VolMode = VolRealized
+	bt.sizing.VolSamples = 4
+	bt.sizing.VolMult = 1
+	bt.sizing.Equity = 10000
+	bt.sizing.RiskFraction = 0.01
+	// a realized volatility of 0.01 over a price of 1.25 risks the fraction
+	// of the equity
+	if units := bt.entryUnits("EURUSD", "buy", lastVal); units < 12499 || units > 12500 {
+		t.Error("The units should take the price into account, Units:", units)
+	}
+}
+
+type accountTest struct {
+	*collectorTest
+
+	mutex  sync.Mutex
+	calls  int
+	equity float64
+}
+
+func (at *accountTest) GetEquity() (float64, error) {
+	at.mutex.Lock()
+	defer at.mutex.Unlock()
+
+	at.calls++
+	return at.equity, nil
+}
+
+func TestAccountEquity(t *testing.T) {
+	account := &accountTest{collectorTest: getCollectorTest(), equity: 5000}
+	bt := newBaseTrader("test", &TraderConf{ID: 1, Curr: "EURUSD", Collector: account, Units: 1000}, nil)
+	bt.sizing.Equity = 100
+	bt.sizing.EquityRefreshSecs = 3600
+	equity := func() (equity float64, refreshing bool) {
+		bt.mutex.Lock()
+		defer bt.mutex.Unlock()
+
+		return bt.equity(), bt.refreshingEquity
+	}
+
+	if eq, refreshing := equity(); eq != 100 || !refreshing {
+		t.Fatal("The configured equity should be used while the equity of the account is obtained, Equity:", eq)
+	}
+	for i := 0; i < 100; i++ {
+		if eq, refreshing := equity(); !refreshing && eq == 5000 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if eq, _ := equity(); eq != 5000 {
+		t.Fatal("The equity of the account should be used once obtained, Equity:", eq)
+	}
+
+	account.mutex.Lock()
+	account.equity = 6000
+	account.mutex.Unlock()
+	if eq, refreshing := equity(); eq != 5000 || refreshing || account.calls != 1 {
+		t.Error("The equity of the account should be refreshed only after the refresh period, Equity:", eq, "Calls:", account.calls)
+	}
+}
@@ -0,0 +1,203 @@
+package hermes
+
+import (
+	"fmt"
+)
+
+const (
+	CooldownByCurrency = "currency"
+	CooldownByTrader   = "trader"
+
+	ReasonCooldown     = "cooldown"
+	ReasonLossCooldown = "loss-cooldown"
+	ReasonOverTrading  = "max-entries-per-window"
+	ReasonOpsSpacing   = "ops-spacing"
+	ReasonPaused       = "paused"
+
+	// traderScope is the key of the cooldowns that apply to all the
+	// currencies of the trader
+	traderScope = "*"
+)
+
+// throttleParams are the parameters of the overtrading controls, shared by
+// all the trader types
+var throttleParams = []Param{
+	{Name: "cooldown-secs", Default: "0", Desc: "Seconds without new entries after a close"},
+	{Name: "loss-cooldown-secs", Default: "0", Desc: "Seconds without new entries after a close with losses"},
+	{Name: "cooldown-scope", Default: CooldownByCurrency, Desc: "Scope of the cooldowns: currency, only the currency of the closed position, or trader"},
+	{Name: "max-entries-per-window", Default: "0", Desc: "Max entries on the rolling window, zero for no limit"},
+	{Name: "entries-window-secs", Default: "3600", Desc: "Seconds of the rolling window used to count the entries"},
+	{Name: "min-secs-between-ops", Default: "0", Desc: "Min seconds between two consecutive orders, opened or closed"},
+}
+
+// ThrottleLimits are the overtrading controls of a trader, all of them are
+// disabled with the zero value
+type ThrottleLimits struct {
+	CooldownSecs        int
+	LossCooldownSecs    int
+	CooldownScope       string
+	MaxEntriesPerWindow int
+	EntriesWindowSecs   int
+	MinSecsBetweenOps   int
+}
+
+// ThrottleState is the current state of the overtrading controls of a trader,
+// CooldownUntil contains the time until the entries are blocked by currency,
+// or for all the currencies with the "*" key
+type ThrottleState struct {
+	CooldownUntil  map[string]int64  `json:"cooldown_until"`
+	CooldownReason map[string]string `json:"cooldown_reason"`
+	Entries        []int64           `json:"entries"`
+	LastOpTs       int64             `json:"last_op_ts"`
+	Throttled      int               `json:"throttled"`
+	LastReason     string            `json:"last_reason,omitempty"`
+}
+
+// ThrottledError is returned when a new entry is blocked by the overtrading
+// controls
+type ThrottledError struct {
+	Reason string
+}
+
+func (err *ThrottledError) Error() string {
+	return fmt.Sprintf("hermes: entry blocked by %s", err.Reason)
+}
+
+type throttle struct {
+	limits ThrottleLimits
+	state  ThrottleState
+	// paused are the currencies on which the entries were paused manually
+	paused map[string]bool
+}
+
+func newThrottle(limits *ThrottleLimits) *throttle {
+	th := &throttle{
+		state: ThrottleState{
+			CooldownUntil:  make(map[string]int64),
+			CooldownReason: make(map[string]string),
+		},
+		paused: make(map[string]bool),
+	}
+	if limits != nil {
+		th.limits = *limits
+	}
+
+	return th
+}
+
+func getThrottleLimits(conf *TraderConf) (limits *ThrottleLimits, err error) {
+	limits = &ThrottleLimits{
+		CooldownScope: conf.Params["cooldown-scope"],
+	}
+	if limits.CooldownSecs, err = conf.GetInt("cooldown-secs"); err != nil {
+		return
+	}
+	if limits.LossCooldownSecs, err = conf.GetInt("loss-cooldown-secs"); err != nil {
+		return
+	}
+	if limits.MaxEntriesPerWindow, err = conf.GetInt("max-entries-per-window"); err != nil {
+		return
+	}
+	if limits.EntriesWindowSecs, err = conf.GetInt("entries-window-secs"); err != nil {
+		return
+	}
+	if limits.MinSecsBetweenOps, err = conf.GetInt("min-secs-between-ops"); err != nil {
+		return
+	}
+
+	return limits, limits.Validate()
+}
+
+// Validate checks that the limits are consistent
+func (limits *ThrottleLimits) Validate() error {
+	if limits.CooldownScope != "" && limits.CooldownScope != CooldownByCurrency && limits.CooldownScope != CooldownByTrader {
+		return fmt.Errorf("hermes: unknown cooldown scope: %s", limits.CooldownScope)
+	}
+	if limits.MaxEntriesPerWindow > 0 && limits.EntriesWindowSecs <= 0 {
+		return fmt.Errorf("hermes: the window to count the entries has to be positive")
+	}
+
+	return nil
+}
+
+// pruneEntries removes the entries out of the rolling window
+func (th *throttle) pruneEntries(ts int64) {
+	from := ts - int64(th.limits.EntriesWindowSecs)*tsMultToSecs
+	for len(th.state.Entries) > 0 && th.state.Entries[0] <= from {
+		th.state.Entries = th.state.Entries[1:]
+	}
+}
+
+// blocked returns the reason why a new entry on the currency can't be opened
+// at the given time, or an empty string if it can be opened
+func (th *throttle) blocked(curr string, ts int64) (reason string) {
+	if th.paused[curr] {
+		return ReasonPaused
+	}
+	for _, scope := range []string{traderScope, curr} {
+		if ts < th.state.CooldownUntil[scope] {
+			reason = th.state.CooldownReason[scope]
+		}
+	}
+	if reason == "" && th.limits.MinSecsBetweenOps > 0 && th.state.LastOpTs != 0 &&
+		ts-th.state.LastOpTs < int64(th.limits.MinSecsBetweenOps)*tsMultToSecs {
+		reason = ReasonOpsSpacing
+	}
+	if reason == "" && th.limits.MaxEntriesPerWindow > 0 {
+		th.pruneEntries(ts)
+		if len(th.state.Entries) >= th.limits.MaxEntriesPerWindow {
+			reason = ReasonOverTrading
+		}
+	}
+
+	if reason != "" {
+		th.state.Throttled++
+		th.state.LastReason = reason
+	}
+
+	return
+}
+
+func (th *throttle) entryOpened(ts int64) {
+	th.state.LastOpTs = ts
+	if th.limits.MaxEntriesPerWindow > 0 {
+		th.pruneEntries(ts)
+		th.state.Entries = append(th.state.Entries, ts)
+	}
+}
+
+// opClosed starts the cooldowns after the close of an op
+func (th *throttle) opClosed(curr string, profit float64, ts int64) {
+	th.state.LastOpTs = ts
+
+	secs, reason := th.limits.CooldownSecs, ReasonCooldown
+	if profit < 0 && th.limits.LossCooldownSecs > secs {
+		secs, reason = th.limits.LossCooldownSecs, ReasonLossCooldown
+	}
+	if secs <= 0 {
+		return
+	}
+
+	scope := curr
+	if th.limits.CooldownScope == CooldownByTrader {
+		scope = traderScope
+	}
+	if until := ts + int64(secs)*tsMultToSecs; until > th.state.CooldownUntil[scope] {
+		th.state.CooldownUntil[scope] = until
+		th.state.CooldownReason[scope] = reason
+	}
+}
+
+// getState returns a copy of the state
+func (th *throttle) getState() (state ThrottleState) {
+	state = th.state
+	state.CooldownUntil = make(map[string]int64)
+	state.CooldownReason = make(map[string]string)
+	for scope, until := range th.state.CooldownUntil {
+		state.CooldownUntil[scope] = until
+		state.CooldownReason[scope] = th.state.CooldownReason[scope]
+	}
+	state.Entries = append([]int64{}, th.state.Entries...)
+
+	return
+}
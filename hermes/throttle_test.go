@@ -0,0 +1,62 @@
+package hermes
+
+import (
+	"testing"
+
+	"github.com/alonsovidales/v/charont"
+)
+
+func TestThrottle(t *testing.T) {
+	collector := getCollectorTest()
+	bt := newBaseTrader("test", &TraderConf{ID: 1, Curr: "USD", Collector: collector, Units: 1}, nil)
+	bt.throttle = newThrottle(&ThrottleLimits{
+		CooldownSecs:        10,
+		LossCooldownSecs:    60,
+		MaxEntriesPerWindow: 2,
+		EntriesWindowSecs:   300,
+		MinSecsBetweenOps:   5,
+	})
+
+	at := func(secs int64, price float64) *charont.CurrVal {
+		val := &charont.CurrVal{Ts: secs * tsMultToSecs, Bid: price, Ask: price}
+		collector.vals["USD"] = append(collector.vals["USD"], val)
+		return val
+	}
+
+	entry, err := bt.openPosition("USD", "buy", at(1, 1))
+	if err != nil || len(entry) != 1 {
+		t.Fatal("The first entry should be opened:", err)
+	}
+	bt.closePosition(entry[0], at(2, 1.1), CloseTrainer)
+
+	if _, err = bt.openPosition("USD", "buy", at(5, 1.1)); err == nil || err.(*ThrottledError).Reason != ReasonCooldown {
+		t.Error("The entry should be blocked by the cooldown after a close:", err)
+	}
+	if entry, err = bt.openPosition("USD", "buy", at(13, 1.1)); err != nil {
+		t.Fatal("The cooldown should have expired:", err)
+	}
+	bt.closePosition(entry[0], at(20, 1), CloseTrainer)
+
+	if _, err = bt.openPosition("USD", "buy", at(40, 1)); err == nil || err.(*ThrottledError).Reason != ReasonLossCooldown {
+		t.Error("The entry should be blocked by the cooldown after a loss:", err)
+	}
+	if _, err = bt.openPosition("USD", "buy", at(90, 1)); err == nil || err.(*ThrottledError).Reason != ReasonOverTrading {
+		t.Error("The entry should be blocked by the max entries per window:", err)
+	}
+	if _, err = bt.openPosition("USD", "buy", at(302, 1)); err != nil {
+		t.Error("The first entry should be out of the window:", err)
+	}
+
+	state := bt.GetThrottleState()
+	if state.Throttled != 3 || state.LastReason != ReasonOverTrading || len(state.Entries) != 2 {
+		t.Error("Unexpected throttle state:", state)
+	}
+
+	bt.SetPaused("USD", true)
+	if _, err = bt.openPosition("USD", "buy", at(900, 1)); err == nil || err.(*ThrottledError).Reason != ReasonPaused {
+		t.Error("The entry should be blocked on a paused currency:", err)
+	}
+	if closed, err := bt.CloseAllPositions(CloseManual); closed != 1 || err != nil || len(bt.GetOpenOrders()) != 0 {
+		t.Error("All the positions should be closed manually, closed:", closed, "Error:", err)
+	}
+}
@@ -0,0 +1,257 @@
+package hermes
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/alonsovidales/pit/log"
+	"github.com/alonsovidales/v/charont"
+)
+
+const (
+	ActionHold  = "hold"
+	ActionOpen  = "open"
+	ActionClose = "close"
+
+	ReasonSuspended    = "suspended"
+	ReasonNoSignal     = "no-signal"
+	ReasonSignal       = "signal"
+	ReasonMaxEntries   = "max-entries"
+	ReasonEntrySpacing = "entry-spacing"
+	ReasonSide         = "side-not-allowed"
+	ReasonSizing       = "sizing"
+	ReasonOrderFailed  = "order-failed"
+	ReasonGridLevel    = "grid-level"
+	ReasonHedge        = "hedge"
+
+	traceFlushSecs = 1
+)
+
+// Decision is the trace of a trader evaluation after a new price, it contains
+// the data used by the trader and the trainer, the action taken and the
+// reason code of the action
+type Decision struct {
+	TraderID  int       `json:"trader"`
+	Type      string    `json:"type"`
+	Curr      string    `json:"curr"`
+	Ts        int64     `json:"ts"`
+	Real      bool      `json:"real"`
+	Bid       float64   `json:"bid"`
+	Ask       float64   `json:"ask"`
+	Features  []float64 `json:"features,omitempty"`
+	ScoreBuy  float64   `json:"score_buy,omitempty"`
+	ScoreSell float64   `json:"score_sell,omitempty"`
+	Boundary  float64   `json:"boundary,omitempty"`
+	Positions int       `json:"positions"`
+	Action    string    `json:"action"`
+	Side      string    `json:"side,omitempty"`
+	Reason    string    `json:"reason"`
+	Orders    []int64   `json:"orders,omitempty"`
+}
+
+// TraceFilter selects the decisions returned by ReadTraces, the zero value
+// of each field matches all the decisions
+type TraceFilter struct {
+	TraderID *int
+	Curr     string
+	Action   string
+	From     int64
+	To       int64
+}
+
+// Tracer writes the decisions of the traders to a file, one JSON document by
+// line. The decisions that hold the positions are the most of them, only one
+// of each holdEvery is traced, none if holdEvery is zero
+type Tracer struct {
+	mutex     sync.Mutex
+	file      *os.File
+	writer    *bufio.Writer
+	closed    bool
+	holdEvery int
+	holds     int
+}
+
+// GetTracer opens the traces file appending the new decisions to the existing
+// ones, one of each holdEvery decisions that hold the positions is traced
+func GetTracer(path string, holdEvery int) (tracer *Tracer, err error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return
+	}
+
+	tracer = &Tracer{
+		file:      file,
+		writer:    bufio.NewWriter(file),
+		holdEvery: holdEvery,
+	}
+	go tracer.flusher()
+
+	return
+}
+
+func (tracer *Tracer) flusher() {
+	c := time.Tick(traceFlushSecs * time.Second)
+	for _ = range c {
+		tracer.mutex.Lock()
+		if tracer.closed {
+			tracer.mutex.Unlock()
+			return
+		}
+		if err := tracer.writer.Flush(); err != nil {
+			log.Error("The decision traces can't be written:", err)
+		}
+		tracer.mutex.Unlock()
+	}
+}
+
+func (tracer *Tracer) Write(decision *Decision) {
+	b, err := json.Marshal(decision)
+	if err != nil {
+		log.Error("The decision can't be encoded:", err)
+		return
+	}
+
+	tracer.mutex.Lock()
+	defer tracer.mutex.Unlock()
+	if tracer.closed {
+		return
+	}
+	tracer.writer.Write(append(b, '\n'))
+}
+
+// traceHold returns true if the decision that holds the positions has to be
+// traced
+func (tracer *Tracer) traceHold() bool {
+	if tracer.holdEvery < 1 {
+		return false
+	}
+
+	tracer.mutex.Lock()
+	defer tracer.mutex.Unlock()
+
+	traced := tracer.holds%tracer.holdEvery == 0
+	tracer.holds++
+
+	return traced
+}
+
+func (tracer *Tracer) Close() (err error) {
+	tracer.mutex.Lock()
+	defer tracer.mutex.Unlock()
+
+	tracer.closed = true
+	if err = tracer.writer.Flush(); err != nil {
+		tracer.file.Close()
+		return
+	}
+
+	return tracer.file.Close()
+}
+
+// ReadTraces returns all the decisions stored on the traces file that match
+// the filter
+func ReadTraces(path string, filter *TraceFilter) (decisions []*Decision, err error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+
+	dec := json.NewDecoder(file)
+	for dec.More() {
+		decision := &Decision{}
+		if err = dec.Decode(decision); err != nil {
+			return
+		}
+		if filter.match(decision) {
+			decisions = append(decisions, decision)
+		}
+	}
+
+	return
+}
+
+func (filter *TraceFilter) match(decision *Decision) bool {
+	if filter == nil {
+		return true
+	}
+
+	return (filter.TraderID == nil || *filter.TraderID == decision.TraderID) &&
+		(filter.Curr == "" || filter.Curr == decision.Curr) &&
+		(filter.Action == "" || filter.Action == decision.Action) &&
+		(filter.From == 0 || decision.Ts >= filter.From) &&
+		(filter.To == 0 || decision.Ts <= filter.To)
+}
+
+// newDecision returns the decision to be traced for the evaluation of the
+// new price, by default the trader holds its positions
+func (bt *baseTrader) newDecision(curr string, lastVal *charont.CurrVal) *Decision {
+	return &Decision{
+		TraderID: bt.id,
+		Type:     bt.typeName,
+		Curr:     curr,
+		Ts:       lastVal.Ts,
+		Real:     bt.realOps,
+		Bid:      lastVal.Bid,
+		Ask:      lastVal.Ask,
+		Action:   ActionHold,
+	}
+}
+
+// trace completes the decision with the data of the trainer and writes it if
+// the trader has a tracer, the decisions that hold the positions are sampled
+// by the tracer. The mutex has to be locked
+func (bt *baseTrader) trace(decision *Decision, currVals map[string][]*charont.CurrVal) {
+	if bt.tracer == nil || (decision.Action == ActionHold && !bt.tracer.traceHold()) {
+		return
+	}
+
+	decision.Positions = len(bt.positions)
+	if bt.scorer != nil && len(currVals[decision.Curr]) > 0 {
+		if scoreBuy, scoreSell, boundary, ok := bt.scorer.GetScores(decision.Curr, currVals, bt.id); ok {
+			decision.ScoreBuy = scoreBuy
+			decision.ScoreSell = scoreSell
+			decision.Boundary = boundary
+		}
+	}
+	if bt.explainer != nil && len(currVals[decision.Curr]) > 0 {
+		if features, ok := bt.explainer.GetFeatures(decision.Curr, currVals); ok {
+			decision.Features = features
+		}
+	}
+
+	bt.tracer.Write(decision)
+}
+
+// closed records on the decision a position closed with the given reason
+func (decision *Decision) closed(pos *position, reason string) {
+	decision.Action = ActionClose
+	decision.Side = pos.ord.Type
+	decision.Reason = reason
+	decision.Orders = append(decision.Orders, pos.ord.Id)
+}
+
+// opened records on the decision the result of trying to open a new entry
+func (decision *Decision) opened(typeOper string, entry []*position, err error) {
+	decision.Side = typeOper
+	if len(entry) > 0 {
+		decision.Action = ActionOpen
+	}
+	throttled, isThrottled := err.(*ThrottledError)
+	switch {
+	case isThrottled:
+		decision.Reason = throttled.Reason
+	case err != nil:
+		decision.Reason = ReasonOrderFailed
+	case len(entry) == 0:
+		decision.Reason = ReasonSizing
+	case decision.Reason == "":
+		decision.Reason = ReasonSignal
+	}
+	for _, pos := range entry {
+		decision.Orders = append(decision.Orders, pos.ord.Id)
+	}
+}
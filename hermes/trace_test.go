@@ -0,0 +1,83 @@
+package hermes
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/alonsovidales/v/charont"
+)
+
+func TestDecisionTraces(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hermes-traces")
+	if err != nil {
+		t.Fatal("Problem creating the temp dir:", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "traces.log")
+	tracer, err := GetTracer(path, 1)
+	if err != nil {
+		t.Fatal("Problem opening the traces file:", err)
+	}
+
+	collector := getCollectorTest()
+	GetTrader(GridTraderType, &TraderConf{
+		ID:        3,
+		Curr:      "USD",
+		Collector: collector,
+		Units:     1,
+		Tracer:    tracer,
+		Params: map[string]string{
+			"step":   "0.01",
+			"levels": "2",
+		},
+	})
+
+	collector.addVal("USD", &charont.CurrVal{Ts: 1, Bid: 1.00, Ask: 1.00})
+	collector.addVal("USD", &charont.CurrVal{Ts: 2, Bid: 0.99, Ask: 0.99})
+	collector.addVal("USD", &charont.CurrVal{Ts: 3, Bid: 0.98, Ask: 0.98})
+	collector.addVal("USD", &charont.CurrVal{Ts: 4, Bid: 1.00, Ask: 1.00})
+	if err = tracer.Close(); err != nil {
+		t.Fatal("Problem closing the traces file:", err)
+	}
+
+	decisions, err := ReadTraces(path, nil)
+	if err != nil || len(decisions) != 4 {
+		t.Fatal("A decision by evaluation was expected, Decisions:", len(decisions), "Error:", err)
+	}
+	if decisions[0].Action != ActionOpen || decisions[0].Reason != ReasonGridLevel || len(decisions[0].Orders) != 1 {
+		t.Error("Unexpected open decision:", decisions[0])
+	}
+	if decisions[2].Action != ActionHold || decisions[2].Positions != 2 {
+		t.Error("Unexpected hold decision:", decisions[2])
+	}
+
+	traderID := 3
+	decisions, err = ReadTraces(path, &TraceFilter{TraderID: &traderID, Action: ActionClose})
+	if err != nil || len(decisions) != 1 {
+		t.Fatal("One close decision was expected, Decisions:", len(decisions), "Error:", err)
+	}
+	if decisions[0].Reason != CloseTakeProfit || decisions[0].Ts != 4 || decisions[0].Side != "buy" {
+		t.Error("Unexpected close decision:", decisions[0])
+	}
+}
+
+func TestTraceHoldSample(t *testing.T) {
+	tracer := &Tracer{holdEvery: 3}
+	traced := 0
+	for i := 0; i < 7; i++ {
+		if tracer.traceHold() {
+			traced++
+		}
+	}
+	if traced != 3 {
+		t.Error("One of each three hold decisions should be traced, Traced:", traced)
+	}
+
+	tracer.holdEvery = 0
+	if tracer.traceHold() {
+		t.Error("The hold decisions shouldn't be traced without sample")
+	}
+}
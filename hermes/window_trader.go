@@ -1,10 +1,6 @@
 package hermes
 
 import (
-	//"github.com/alonsovidales/pit/log"
-
-	"sync"
-
 	"github.com/alonsovidales/pit/log"
 	"github.com/alonsovidales/v/charont"
 	"github.com/alonsovidales/v/philoctetes"
@@ -12,36 +8,128 @@ import (
 
 const (
 	tsMultToSecs = 1000000000
+
+	WindowTraderType = "window"
+	MultiTraderType  = "multi"
 )
 
+func init() {
+	Register(&TraderType{
+		Name: WindowTraderType,
+		Desc: "Holds a single position, opening and closing it when the trainer says so",
+		Params: withParams([]Param{
+			{Name: "samples-to-considerer", Default: "0", Desc: "Samples to considerer by the trader"},
+			{Name: "max-secs-to-wait", Default: "0", Desc: "Max seconds to wait before close a position"},
+		}, exitParams, sizingParams, throttleParams),
+		Build: func(conf *TraderConf) (Int, error) {
+			return buildWindowTrader(WindowTraderType, conf, nil)
+		},
+	})
+
+	// The multi-position example of the registry, the scale in, hedge and lots
+	// params are the limits of the position manager, see PositionLimits
+	Register(&TraderType{
+		Name: MultiTraderType,
+		Desc: "Window trader that scales in while the trainer keeps the signal, each entry is evaluated and closed independently",
+		Params: withParams([]Param{
+			{Name: "samples-to-considerer", Default: "0", Desc: "Samples to considerer by the trader"},
+			{Name: "max-secs-to-wait", Default: "0", Desc: "Max seconds to wait before close a position"},
+			{Name: "max-positions", Default: "3", Desc: "Max number of entries open at the same time"},
+			{Name: "min-secs-between-entries", Default: "60", Desc: "Min seconds between the opening of two entries"},
+			{Name: "allow-hedge", Default: "false", Desc: "Allow to open entries on the opposite side of the open ones"},
+			{Name: "lots", Default: "1", Desc: "Number of orders in which the units of each entry are split"},
+			{Name: "scale-out-lots", Default: "0", Desc: "Lots to close on each close signal, zero to close the whole entry"},
+			{Name: "close-mode", Default: CloseByEntry, Desc: "Lots to close on a close signal: entry for the lots of the entry, fifo for the oldest lots"},
+		}, exitParams, sizingParams, throttleParams),
+		Build: func(conf *TraderConf) (Int, error) {
+			limits := &PositionLimits{
+				ScaleIn:   true,
+				CloseMode: conf.Params["close-mode"],
+			}
+			var err error
+			if limits.MaxEntries, err = conf.GetInt("max-positions"); err != nil {
+				return nil, err
+			}
+			if limits.MinSecsBetweenEntries, err = conf.GetInt("min-secs-between-entries"); err != nil {
+				return nil, err
+			}
+			if limits.AllowHedge, err = conf.GetBool("allow-hedge"); err != nil {
+				return nil, err
+			}
+			if limits.Lots, err = conf.GetInt("lots"); err != nil {
+				return nil, err
+			}
+			if limits.ScaleOutLots, err = conf.GetInt("scale-out-lots"); err != nil {
+				return nil, err
+			}
+			if err = limits.Validate(); err != nil {
+				return nil, err
+			}
+
+			return buildWindowTrader(MultiTraderType, conf, limits)
+		},
+	})
+}
+
 type windowTrader struct {
-	Int
-
-	collector           charont.Int
-	curr                string
-	ops                 []*charont.Order
-	realOps             bool
-	opRunning           *charont.Order
-	unitsToUse          int
+	*baseTrader
+
 	samplesToConsiderer int
 	maxSecToWait        int
 	trainer             philoctetes.TrainerInt
-	askVal              *charont.CurrVal
-	id                  int
-	mutex               *sync.Mutex
+}
+
+func buildWindowTrader(typeName string, conf *TraderConf, limits *PositionLimits) (Int, error) {
+	samplesToConsiderer, err := conf.GetInt("samples-to-considerer")
+	if err != nil {
+		return nil, err
+	}
+	maxSecToWait, err := conf.GetInt("max-secs-to-wait")
+	if err != nil {
+		return nil, err
+	}
+	exits, err := getExitPolicies(conf)
+	if err != nil {
+		return nil, err
+	}
+	lots := 1
+	if limits != nil {
+		lots = limits.Lots
+	}
+	if err = exits.validateLots(lots); err != nil {
+		return nil, err
+	}
+	sizing, err := getSizing(conf)
+	if err != nil {
+		return nil, err
+	}
+	throttleLimits, err := getThrottleLimits(conf)
+	if err != nil {
+		return nil, err
+	}
+
+	wt := GetWindowTrader(conf.ID, conf.Trainer, conf.Curr, conf.Collector, conf.Units, samplesToConsiderer, maxSecToWait)
+	wt.typeName = typeName
+	wt.positionManager = newPositionManager(limits)
+	wt.exits = exits
+	wt.sizing = sizing
+	wt.throttle = newThrottle(throttleLimits)
+
+	return wt, nil
 }
 
 func GetWindowTrader(id int, trainer philoctetes.TrainerInt, curr string, collector charont.Int, unitsToUse, samplesToConsiderer, maxSecToWait int) (wt *windowTrader) {
 	wt = &windowTrader{
-		collector:           collector,
+		baseTrader: newBaseTrader(WindowTraderType, &TraderConf{
+			ID:        id,
+			Curr:      curr,
+			Trainer:   trainer,
+			Collector: collector,
+			Units:     unitsToUse,
+		}, nil),
 		trainer:             trainer,
-		realOps:             false,
-		curr:                curr,
-		unitsToUse:          unitsToUse,
 		samplesToConsiderer: samplesToConsiderer,
 		maxSecToWait:        maxSecToWait,
-		id:                  id,
-		mutex:               new(sync.Mutex),
 	}
 
 	collector.AddListerner(curr, wt.NewPrices)
@@ -49,112 +137,70 @@ func GetWindowTrader(id int, trainer philoctetes.TrainerInt, curr string, collec
 	return
 }
 
-func (wt *windowTrader) GetID() int {
-	return wt.id
-}
-
 func (wt *windowTrader) NewPrices(curr string, ts int64) {
-	var realOpsStr string
-
 	wt.mutex.Lock()
 	defer wt.mutex.Unlock()
 
-	if wt.realOps {
-		realOpsStr = "Real"
-	} else {
-		realOpsStr = "Simulation"
+	if wt.retired {
+		return
 	}
 	currVals := wt.collector.GetAllCurrVals()
 	lastVal := currVals[curr][len(currVals[curr])-1]
-	if wt.opRunning == nil {
-		// Check if we can buy
-		if should, typeOper := wt.trainer.ShouldIOperate(curr, currVals, wt.id); should {
-			log.Debug("Buy:", curr, "ID:", wt.id, "Price:", lastVal.Ask, "Type:", realOpsStr)
-			if typeOper == "buy" {
-				wt.opRunning, _ = wt.collector.Buy(curr, wt.unitsToUse, lastVal.Ask, wt.realOps, lastVal.Ts)
-			} else {
-				wt.opRunning, _ = wt.collector.Sell(curr, wt.unitsToUse, lastVal.Bid, wt.realOps, lastVal.Ts)
+	decision := wt.newDecision(curr, lastVal)
+	defer wt.trace(decision, currVals)
+	defer wt.exportPositions(currVals, lastVal.Ts)
+	if wt.checkRisk(currVals, lastVal.Ts, decision) {
+		return
+	}
+
+	// Check if we can sell, the exit policies and the trainer evaluate each
+	// entry on its own
+	closed := false
+	for _, entry := range wt.entryPositions() {
+		pos := entry[0]
+		reason, lots := wt.checkExits(entry, currVals[curr])
+		if reason == "" {
+			if !wt.trainer.ShouldIClose(curr, pos.openVal, currVals, wt.id, pos.ord) {
+				continue
 			}
-			wt.askVal = lastVal
+			reason, lots = CloseTrainer, wt.toClose(pos.entry)
 		}
-	} else {
-		// Check if we can sell
-		if wt.trainer.ShouldIClose(curr, wt.askVal, currVals, wt.id, wt.opRunning) {
-			scoreBefSell := wt.GetScore(3)
-			totalProfitBefSell := wt.GetTotalProfit()
-			if err := wt.collector.CloseOrder(wt.opRunning, lastVal.Ts); err == nil {
-				wt.ops = append(wt.ops, wt.opRunning)
-				log.Debug("Selling:", curr, "Trader:", wt.id, "Profit:", wt.ops[len(wt.ops)-1].Profit, "Time:", float64(lastVal.Ts-wt.askVal.Ts)/tsMultToSecs, "TotalProfit:", wt.GetTotalProfit(), "Score:", wt.GetScore(3), "scoreBefSell:", scoreBefSell, "totalProfitBefSell:", totalProfitBefSell, "Real:", realOpsStr)
-				wt.opRunning = nil
+		lotsClosed := 0
+		for _, lot := range lots {
+			scoreBefSell := wt.score(3)
+			totalProfitBefSell := wt.totalProfit()
+			if err := wt.closePosition(lot, lastVal, reason); err == nil {
+				log.Debug("Selling:", curr, "Trader:", wt.id, "Entry:", lot.entry, "Reason:", reason, "Profit:", lot.ord.Profit, "Time:", float64(lastVal.Ts-lot.openVal.Ts)/tsMultToSecs, "TotalProfit:", wt.totalProfit(), "Score:", wt.score(3), "scoreBefSell:", scoreBefSell, "totalProfitBefSell:", totalProfitBefSell, "Real:", wt.realOpsStr())
+				decision.closed(lot, reason)
+				lotsClosed++
 			}
 		}
-	}
-}
-
-func (wt *windowTrader) GetNumOps() int {
-	return len(wt.ops)
-}
-
-func (wt *windowTrader) IsPlaying() bool {
-	return wt.realOps
-}
-
-func (wt *windowTrader) StartPlaying() {
-	wt.realOps = true
-}
-
-func (wt *windowTrader) StopPlaying() bool {
-	if wt.opRunning != nil {
-		return false
-	}
-
-	wt.realOps = false
-	return true
-}
-
-func (wt *windowTrader) GetMicsecsBetweenOps(lastOps int) float64 {
-	var toStudy []*charont.Order
-
-	if len(wt.ops) < lastOps {
-		toStudy = wt.ops
-	} else {
-		toStudy = wt.ops[len(wt.ops)-lastOps:]
+		// The take profit level is kept until its lots can be closed
+		if reason == CloseTakeProfit && lotsClosed > 0 {
+			wt.exits.nextTakeProfit(entry)
+		}
+		closed = closed || lotsClosed > 0
 	}
 
-	fromTs := toStudy[0].SellTs
-	distance := int64(0)
-	for _, op := range toStudy[1:] {
-		distance += op.SellTs - fromTs
-		fromTs = op.SellTs
+	if closed {
+		return
 	}
-
-	return (float64(distance) / float64(len(toStudy)-1))
-}
-
-func (wt *windowTrader) GetTotalProfit() (profit float64) {
-	profit = 1
-	for _, op := range wt.ops {
-		if op != nil {
-			profit *= op.Profit + 1
-		}
+	if decision.Reason = wt.openBlocked("", lastVal.Ts); decision.Reason != "" {
+		return
 	}
 
-	return
-}
-
-func (wt *windowTrader) GetScore(lastOps int) (score float64) {
-	var toStudy []*charont.Order
-
-	if len(wt.ops) < lastOps {
-		toStudy = wt.ops
-	} else {
-		toStudy = wt.ops[len(wt.ops)-lastOps:]
+	// Check if we can buy
+	should, typeOper := wt.trainer.ShouldIOperate(curr, currVals, wt.id)
+	if !should {
+		decision.Reason = ReasonNoSignal
+		return
 	}
-
-	score = 1
-	for _, op := range toStudy {
-		score *= op.Profit + 1
+	if decision.Reason = wt.openBlocked(typeOper, lastVal.Ts); decision.Reason != "" {
+		decision.Side = typeOper
+		return
 	}
 
-	return
+	log.Debug("Buy:", curr, "ID:", wt.id, "Price:", lastVal.Ask, "Type:", wt.realOpsStr(), "Positions:", len(wt.positions))
+	entry, err := wt.openPosition(curr, typeOper, lastVal)
+	decision.opened(typeOper, entry, err)
 }
@@ -0,0 +1,94 @@
+package iris
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/alonsovidales/pit/log"
+)
+
+// subscriptionMsg is the message that the WebSocket clients can send in order
+// to modify the currencies they are subscribed to, a snapshot of each new
+// currency is sent before its deltas
+type subscriptionMsg struct {
+	Subscribe   []string `json:"subscribe"`
+	Unsubscribe []string `json:"unsubscribe"`
+}
+
+// serveWebSocket streams the events using WebSocket, the initial currencies
+// can be specified as a comma separated list on the curr param
+func (ir *Iris) serveWebSocket(w http.ResponseWriter, r *http.Request) {
+	ws, err := wsUpgrade(w, r)
+	if err != nil {
+		if err == ErrWsNotUpgrade || err == ErrWsNotHijack {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		}
+		return
+	}
+	defer ws.Close()
+
+	cl := ir.subscribe(parseCurrs(r.FormValue("curr")))
+	log.Debug("New WebSocket streaming client:", cl.id, "From:", r.RemoteAddr)
+
+	go func() {
+		defer ir.unsubscribe(cl)
+		for {
+			msg, err := ws.readMessage()
+			if err != nil {
+				return
+			}
+
+			var subs subscriptionMsg
+			if err = json.Unmarshal(msg, &subs); err != nil {
+				log.Debug("Invalid subscription message from client:", cl.id, "Error:", err)
+				continue
+			}
+			ir.updateSubscription(cl, subs.Subscribe, subs.Unsubscribe)
+		}
+	}()
+
+	for ev := range cl.events {
+		b, _ := json.Marshal(ev)
+		if err = ws.writeText(b); err != nil {
+			ir.unsubscribe(cl)
+			return
+		}
+	}
+}
+
+// serveSSE streams the events as Server-Sent Events, since the clients can't
+// send messages, the currencies are specified on the curr param and a new
+// connection is required to modify them
+func (ir *Iris) serveSSE(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+
+	cl := ir.subscribe(parseCurrs(r.FormValue("curr")))
+	defer ir.unsubscribe(cl)
+	log.Debug("New SSE streaming client:", cl.id, "From:", r.RemoteAddr)
+
+	for {
+		select {
+		case ev, ok := <-cl.events:
+			if !ok {
+				return
+			}
+			b, _ := json.Marshal(ev)
+			if _, err := fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", ev.Seq, ev.Type, b); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,404 @@
+package iris
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/alonsovidales/pit/log"
+	"github.com/alonsovidales/v/charont"
+)
+
+const (
+	tsMultToSecs = 1000000000
+
+	EventSnapshot = "snapshot"
+	EventTick     = "tick"
+	EventCandle   = "candle"
+	EventOrder    = "order"
+
+	OrderOpened = "open"
+	OrderClosed = "close"
+
+	ticksInSnapshot   = 500
+	candlesInSnapshot = 200
+	clientBufferSize  = 1000
+)
+
+// Candle contains the OHLC values of the bid price for a period of time, Ticks
+// is the number of prices received during the period
+type Candle struct {
+	Curr   string  `json:"curr"`
+	From   int64   `json:"from"`
+	Open   float64 `json:"o"`
+	High   float64 `json:"h"`
+	Low    float64 `json:"l"`
+	Close  float64 `json:"c"`
+	Ticks  int     `json:"n"`
+	Closed bool    `json:"closed"`
+}
+
+// Snapshot contains the current state of the subscribed currencies, all the
+// events received after it are deltas over this state
+type Snapshot struct {
+	Ticks   map[string][]*charont.CurrVal `json:"ticks"`
+	Candles map[string][]*Candle          `json:"candles"`
+	Orders  []*charont.Order              `json:"orders"`
+}
+
+type Event struct {
+	Seq        int64            `json:"seq"`
+	Type       string           `json:"type"`
+	Curr       string           `json:"curr,omitempty"`
+	Tick       *charont.CurrVal `json:"tick,omitempty"`
+	Candle     *Candle          `json:"candle,omitempty"`
+	Order      *charont.Order   `json:"order,omitempty"`
+	OrderEvent string           `json:"order_event,omitempty"`
+	Snapshot   *Snapshot        `json:"snapshot,omitempty"`
+}
+
+// Iris wraps any collector and pushes all the ticks, candles and order events
+// to the clients connected by WebSocket or Server-Sent Events
+type Iris struct {
+	charont.Int
+
+	mutex      sync.Mutex
+	candleSecs int64
+	seq        int64
+	clientsSeq int64
+	clients    map[int64]*client
+	candles    map[string][]*Candle
+	openOrders map[int64]*charont.Order
+}
+
+// client is a connected client, all is true while it is subscribed to all
+// the currencies, otherwise it receives only the ones on currs
+type client struct {
+	id     int64
+	all    bool
+	currs  map[string]bool
+	events chan *Event
+	closed bool
+}
+
+func GetIris(collector charont.Int, httpPort int, candleSecs int) (ir *Iris) {
+	ir = &Iris{
+		Int:        collector,
+		candleSecs: int64(candleSecs),
+		clients:    make(map[int64]*client),
+		candles:    make(map[string][]*Candle),
+		openOrders: make(map[int64]*charont.Order),
+	}
+
+	for _, curr := range collector.GetCurrencies() {
+		collector.AddListerner(curr, ir.newPrice)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/stream/ws", ir.serveWebSocket)
+	mux.HandleFunc("/stream/sse", ir.serveSSE)
+	go func() {
+		if err := http.ListenAndServe(fmt.Sprintf(":%d", httpPort), mux); err != nil {
+			log.Error("The streaming server can't be started, Error:", err)
+		}
+	}()
+	log.Info("Streaming server listening on:", httpPort)
+
+	return
+}
+
+func (ir *Iris) Buy(currency string, units int, bound float64, realOps bool, ts int64) (order *charont.Order, err error) {
+	order, err = ir.Int.Buy(currency, units, bound, realOps, ts)
+	if err == nil && order != nil {
+		ir.orderEvent(currency, order, OrderOpened)
+	}
+
+	return
+}
+
+func (ir *Iris) Sell(currency string, units int, bound float64, realOps bool, ts int64) (order *charont.Order, err error) {
+	order, err = ir.Int.Sell(currency, units, bound, realOps, ts)
+	if err == nil && order != nil {
+		ir.orderEvent(currency, order, OrderOpened)
+	}
+
+	return
+}
+
+func (ir *Iris) CloseOrder(ord *charont.Order, ts int64) (err error) {
+	if err = ir.Int.CloseOrder(ord, ts); err == nil {
+		ir.orderEvent(ir.orderCurr(ord), ord, OrderClosed)
+	}
+
+	return
+}
+
+func (ir *Iris) CloseAllOpenOrders() {
+	ir.Int.CloseAllOpenOrders()
+
+	ir.mutex.Lock()
+	toClose := []*charont.Order{}
+	for _, ord := range ir.openOrders {
+		toClose = append(toClose, ord)
+	}
+	ir.mutex.Unlock()
+
+	for _, ord := range toClose {
+		ir.orderEvent(ir.orderCurr(ord), ord, OrderClosed)
+	}
+}
+
+// orderCurr returns the currency of the order, the brokers can use the
+// instrument name, as EUR_USD, on the orders
+func (ir *Iris) orderCurr(ord *charont.Order) string {
+	if pos := strings.Index(ord.Curr, "_"); pos != -1 {
+		return ord.Curr[pos+1:]
+	}
+
+	return ord.Curr
+}
+
+func (ir *Iris) orderEvent(curr string, ord *charont.Order, orderEvent string) {
+	ordCopy := *ord
+
+	ir.mutex.Lock()
+	defer ir.mutex.Unlock()
+
+	if orderEvent == OrderOpened {
+		ir.openOrders[ord.Id] = ord
+	} else {
+		delete(ir.openOrders, ord.Id)
+	}
+	ir.publish(&Event{
+		Type:       EventOrder,
+		Curr:       curr,
+		Order:      &ordCopy,
+		OrderEvent: orderEvent,
+	})
+}
+
+func (ir *Iris) newPrice(curr string, ts int64) {
+	ir.mutex.Lock()
+	defer ir.mutex.Unlock()
+
+	vals := ir.GetAllCurrVals()[curr]
+	if len(vals) == 0 {
+		return
+	}
+	tick := *vals[len(vals)-1]
+
+	ir.publish(&Event{
+		Type: EventTick,
+		Curr: curr,
+		Tick: &tick,
+	})
+
+	if ir.candleSecs <= 0 {
+		return
+	}
+	from := tick.Ts - (tick.Ts % (ir.candleSecs * tsMultToSecs))
+	candles := ir.candles[curr]
+	if len(candles) > 0 && candles[len(candles)-1].From == from {
+		candle := candles[len(candles)-1]
+		if tick.Bid > candle.High {
+			candle.High = tick.Bid
+		}
+		if tick.Bid < candle.Low {
+			candle.Low = tick.Bid
+		}
+		candle.Close = tick.Bid
+		candle.Ticks++
+
+		return
+	}
+
+	if len(candles) > 0 {
+		closedCandle := *candles[len(candles)-1]
+		closedCandle.Closed = true
+		candles[len(candles)-1].Closed = true
+		ir.publish(&Event{
+			Type:   EventCandle,
+			Curr:   curr,
+			Candle: &closedCandle,
+		})
+	}
+
+	candles = append(candles, &Candle{
+		Curr:  curr,
+		From:  from,
+		Open:  tick.Bid,
+		High:  tick.Bid,
+		Low:   tick.Bid,
+		Close: tick.Bid,
+		Ticks: 1,
+	})
+	if len(candles) > candlesInSnapshot {
+		candles = candles[1:]
+	}
+	ir.candles[curr] = candles
+}
+
+// publish sends the event to all the clients subscribed to the currency, the
+// clients that can't keep up are disconnected since they lost the state and
+// have to start again from a new snapshot. The mutex has to be locked
+func (ir *Iris) publish(ev *Event) {
+	ir.seq++
+	ev.Seq = ir.seq
+
+	for id, cl := range ir.clients {
+		if !cl.all && !cl.currs[ev.Curr] {
+			continue
+		}
+
+		select {
+		case cl.events <- ev:
+		default:
+			log.Info("Streaming client:", id, "can't keep up, disconnecting")
+			ir.removeClient(cl)
+		}
+	}
+}
+
+// subscribe registers a new client for the given currencies, all the
+// currencies if none is specified, and sends it the initial snapshot
+func (ir *Iris) subscribe(currs []string) (cl *client) {
+	ir.mutex.Lock()
+	defer ir.mutex.Unlock()
+
+	ir.clientsSeq++
+	cl = &client{
+		id:     ir.clientsSeq,
+		all:    len(currs) == 0,
+		currs:  make(map[string]bool),
+		events: make(chan *Event, clientBufferSize),
+	}
+	ir.clients[cl.id] = cl
+	ir.addCurrencies(cl, currs)
+
+	return
+}
+
+// addCurrencies adds the currencies to the subscription of the client sending
+// it the snapshot of the new ones, the snapshot of all the currencies if none
+// is specified. The mutex has to be locked
+func (ir *Iris) addCurrencies(cl *client, currs []string) {
+	for _, curr := range currs {
+		cl.currs[curr] = true
+	}
+
+	snapshot := &Snapshot{
+		Ticks:   make(map[string][]*charont.CurrVal),
+		Candles: make(map[string][]*Candle),
+		Orders:  []*charont.Order{},
+	}
+	allVals := ir.GetAllCurrVals()
+	for _, curr := range ir.GetCurrencies() {
+		if len(currs) > 0 && !inSlice(curr, currs) {
+			continue
+		}
+
+		vals := allVals[curr]
+		if len(vals) > ticksInSnapshot {
+			vals = vals[len(vals)-ticksInSnapshot:]
+		}
+		snapshot.Ticks[curr] = make([]*charont.CurrVal, len(vals))
+		for i, val := range vals {
+			tick := *val
+			snapshot.Ticks[curr][i] = &tick
+		}
+
+		snapshot.Candles[curr] = make([]*Candle, len(ir.candles[curr]))
+		for i, candle := range ir.candles[curr] {
+			candleCopy := *candle
+			snapshot.Candles[curr][i] = &candleCopy
+		}
+	}
+	for _, ord := range ir.openOrders {
+		if len(currs) > 0 && !inSlice(ir.orderCurr(ord), currs) {
+			continue
+		}
+		ordCopy := *ord
+		snapshot.Orders = append(snapshot.Orders, &ordCopy)
+	}
+
+	ir.seq++
+	select {
+	case cl.events <- &Event{
+		Seq:      ir.seq,
+		Type:     EventSnapshot,
+		Snapshot: snapshot,
+	}:
+	default:
+		ir.removeClient(cl)
+	}
+}
+
+func (ir *Iris) updateSubscription(cl *client, subscribe, unsubscribe []string) {
+	ir.mutex.Lock()
+	defer ir.mutex.Unlock()
+
+	if cl.closed {
+		return
+	}
+	if cl.all && len(unsubscribe) > 0 {
+		// the subscription to all the currencies becomes a subscription to
+		// the remaining ones
+		cl.all = false
+		for _, curr := range ir.GetCurrencies() {
+			cl.currs[curr] = true
+		}
+	}
+	for _, curr := range unsubscribe {
+		delete(cl.currs, curr)
+	}
+
+	newCurrs := []string{}
+	for _, curr := range subscribe {
+		if !cl.all && !cl.currs[curr] {
+			newCurrs = append(newCurrs, curr)
+		}
+	}
+	if len(newCurrs) > 0 {
+		ir.addCurrencies(cl, newCurrs)
+	}
+}
+
+func (ir *Iris) unsubscribe(cl *client) {
+	ir.mutex.Lock()
+	defer ir.mutex.Unlock()
+
+	ir.removeClient(cl)
+}
+
+// removeClient The mutex has to be locked
+func (ir *Iris) removeClient(cl *client) {
+	if cl.closed {
+		return
+	}
+
+	cl.closed = true
+	delete(ir.clients, cl.id)
+	close(cl.events)
+}
+
+func parseCurrs(param string) (currs []string) {
+	currs = []string{}
+	for _, curr := range strings.Split(param, ",") {
+		if curr = strings.TrimSpace(curr); curr != "" {
+			currs = append(currs, curr)
+		}
+	}
+
+	return
+}
+
+func inSlice(str string, list []string) bool {
+	for _, s := range list {
+		if s == str {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,156 @@
+package iris
+
+import (
+	"bufio"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/alonsovidales/v/charont"
+)
+
+type collectorTest struct {
+	charont.Int
+
+	vals map[string][]*charont.CurrVal
+}
+
+func (ct *collectorTest) GetCurrencies() []string {
+	return []string{"USD", "GBP"}
+}
+
+func (ct *collectorTest) GetAllCurrVals() map[string][]*charont.CurrVal {
+	return ct.vals
+}
+
+func (ct *collectorTest) AddListerner(currency string, fn func(currency string, ts int64)) {
+}
+
+func (ct *collectorTest) addVal(ir *Iris, curr string, val *charont.CurrVal) {
+	ct.vals[curr] = append(ct.vals[curr], val)
+	ir.newPrice(curr, val.Ts)
+}
+
+func getIrisTest() (ir *Iris, ct *collectorTest) {
+	ct = &collectorTest{
+		vals: make(map[string][]*charont.CurrVal),
+	}
+	ir = &Iris{
+		Int:        ct,
+		candleSecs: 60,
+		clients:    make(map[int64]*client),
+		candles:    make(map[string][]*Candle),
+		openOrders: make(map[int64]*charont.Order),
+	}
+
+	return
+}
+
+func TestSnapshotThenDelta(t *testing.T) {
+	ir, ct := getIrisTest()
+	ct.addVal(ir, "USD", &charont.CurrVal{Ts: 1, Bid: 1.1, Ask: 1.2})
+	ct.addVal(ir, "GBP", &charont.CurrVal{Ts: 2, Bid: 0.8, Ask: 0.9})
+
+	cl := ir.subscribe([]string{"USD"})
+	ct.addVal(ir, "GBP", &charont.CurrVal{Ts: 3, Bid: 0.8, Ask: 0.9})
+	ct.addVal(ir, "USD", &charont.CurrVal{Ts: 61 * tsMultToSecs, Bid: 1.3, Ask: 1.4})
+
+	snapshot := <-cl.events
+	if snapshot.Type != EventSnapshot || len(snapshot.Snapshot.Ticks["USD"]) != 1 || len(snapshot.Snapshot.Ticks["GBP"]) != 0 {
+		t.Fatal("Unexpected snapshot:", snapshot)
+	}
+
+	tick := <-cl.events
+	if tick.Type != EventTick || tick.Curr != "USD" || tick.Seq <= snapshot.Seq {
+		t.Error("The USD tick was expected after the snapshot, but:", tick, "was received")
+	}
+	candle := <-cl.events
+	if candle.Type != EventCandle || !candle.Candle.Closed || candle.Candle.Close != 1.1 {
+		t.Error("The closed USD candle was expected, but:", candle, "was received")
+	}
+	if len(cl.events) != 0 {
+		t.Error("Events for non subscribed currencies were received")
+	}
+
+	ir.updateSubscription(cl, []string{"GBP"}, []string{"USD"})
+	snapshot = <-cl.events
+	if snapshot.Type != EventSnapshot || len(snapshot.Snapshot.Ticks["GBP"]) != 2 || len(snapshot.Snapshot.Ticks["USD"]) != 0 {
+		t.Error("Unexpected snapshot after the subscription change:", snapshot)
+	}
+}
+
+func TestSubscriptionToAll(t *testing.T) {
+	ir, ct := getIrisTest()
+	cl := ir.subscribe([]string{})
+	<-cl.events
+
+	ct.addVal(ir, "GBP", &charont.CurrVal{Ts: 1, Bid: 0.8, Ask: 0.9})
+	if ev := <-cl.events; ev.Type != EventTick || ev.Curr != "GBP" {
+		t.Error("The client subscribed to all the currencies should receive the GBP tick, but:", ev, "was received")
+	}
+
+	ir.updateSubscription(cl, nil, []string{"USD", "GBP"})
+	ct.addVal(ir, "GBP", &charont.CurrVal{Ts: 2, Bid: 0.8, Ask: 0.9})
+	ct.addVal(ir, "USD", &charont.CurrVal{Ts: 2, Bid: 1.1, Ask: 1.2})
+	if len(cl.events) != 0 {
+		t.Error("The client unsubscribed from all the currencies shouldn't receive events, events:", len(cl.events))
+	}
+}
+
+func TestWebSocket(t *testing.T) {
+	ir, ct := getIrisTest()
+	ct.addVal(ir, "USD", &charont.CurrVal{Ts: 1, Bid: 1.1, Ask: 1.2})
+
+	server := httptest.NewServer(http.HandlerFunc(ir.serveWebSocket))
+	defer server.Close()
+
+	conn, err := net.Dial("tcp", strings.TrimPrefix(server.URL, "http://"))
+	if err != nil {
+		t.Fatal("Problem connecting to the server, Error:", err)
+	}
+	defer conn.Close()
+
+	conn.Write([]byte("GET /?curr=USD HTTP/1.1\r\nHost: localhost\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\nSec-WebSocket-Version: 13\r\n\r\n"))
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, nil)
+	if err != nil {
+		t.Fatal("Problem reading the handshake, Error:", err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols || resp.Header.Get("Sec-WebSocket-Accept") != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Fatal("Unexpected handshake response:", resp.Status, resp.Header)
+	}
+
+	ws := &wsConn{conn: conn, rw: bufio.NewReadWriter(reader, bufio.NewWriter(conn))}
+	msg, err := ws.readMessage()
+	if err != nil {
+		t.Fatal("Problem reading the snapshot, Error:", err)
+	}
+	var ev Event
+	if err = json.Unmarshal(msg, &ev); err != nil || ev.Type != EventSnapshot || len(ev.Snapshot.Ticks["USD"]) != 1 {
+		t.Fatal("Unexpected snapshot:", string(msg), "Error:", err)
+	}
+
+	// The clients have to send masked frames
+	payload := []byte(`{"subscribe":["GBP"]}`)
+	mask := []byte{1, 2, 3, 4}
+	frame := []byte{0x80 | wsOpText, 0x80 | byte(len(payload))}
+	frame = append(frame, mask...)
+	for i, b := range payload {
+		frame = append(frame, b^mask[i%4])
+	}
+	conn.Write(frame)
+
+	msg, err = ws.readMessage()
+	if err != nil {
+		t.Fatal("Problem reading the GBP snapshot, Error:", err)
+	}
+	if err = json.Unmarshal(msg, &ev); err != nil || ev.Type != EventSnapshot {
+		t.Error("A new snapshot was expected after the subscription, but:", string(msg), "was received")
+	}
+	if _, ok := ev.Snapshot.Ticks["GBP"]; !ok {
+		t.Error("The snapshot doesn't contain the GBP currency:", string(msg))
+	}
+}
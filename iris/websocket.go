@@ -0,0 +1,168 @@
+package iris
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+const (
+	wsGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+	wsOpText  = 0x1
+	wsOpClose = 0x8
+	wsOpPing  = 0x9
+	wsOpPong  = 0xA
+
+	wsMaxClientPayload = 64 * 1024
+)
+
+var (
+	ErrWsNotUpgrade   = errors.New("websocket: the request is not a websocket upgrade")
+	ErrWsNotHijack    = errors.New("websocket: the connection can't be hijacked")
+	ErrWsPayloadLarge = errors.New("websocket: the client payload is too large")
+)
+
+// wsConn is a minimal server side implementation of the RFC 6455, only
+// non fragmented frames are supported since the clients only send short
+// subscription messages
+type wsConn struct {
+	conn       net.Conn
+	rw         *bufio.ReadWriter
+	writeMutex sync.Mutex
+}
+
+func wsUpgrade(w http.ResponseWriter, r *http.Request) (ws *wsConn, err error) {
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if key == "" || !strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+		return nil, ErrWsNotUpgrade
+	}
+
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		return nil, ErrWsNotHijack
+	}
+	conn, rw, err := hijacker.Hijack()
+	if err != nil {
+		return
+	}
+
+	h := sha1.New()
+	h.Write([]byte(key + wsGUID))
+	accept := base64.StdEncoding.EncodeToString(h.Sum(nil))
+
+	rw.WriteString("HTTP/1.1 101 Switching Protocols\r\n")
+	rw.WriteString("Upgrade: websocket\r\n")
+	rw.WriteString("Connection: Upgrade\r\n")
+	rw.WriteString("Sec-WebSocket-Accept: " + accept + "\r\n\r\n")
+	if err = rw.Flush(); err != nil {
+		conn.Close()
+		return
+	}
+
+	return &wsConn{
+		conn: conn,
+		rw:   rw,
+	}, nil
+}
+
+func (ws *wsConn) writeFrame(opCode byte, payload []byte) (err error) {
+	ws.writeMutex.Lock()
+	defer ws.writeMutex.Unlock()
+
+	header := []byte{0x80 | opCode}
+	switch {
+	case len(payload) < 126:
+		header = append(header, byte(len(payload)))
+	case len(payload) <= 0xFFFF:
+		header = append(header, 126, 0, 0)
+		binary.BigEndian.PutUint16(header[2:], uint16(len(payload)))
+	default:
+		header = append(header, 127, 0, 0, 0, 0, 0, 0, 0, 0)
+		binary.BigEndian.PutUint64(header[2:], uint64(len(payload)))
+	}
+
+	if _, err = ws.rw.Write(header); err != nil {
+		return
+	}
+	if _, err = ws.rw.Write(payload); err != nil {
+		return
+	}
+
+	return ws.rw.Flush()
+}
+
+func (ws *wsConn) writeText(payload []byte) error {
+	return ws.writeFrame(wsOpText, payload)
+}
+
+// readMessage returns the next text message sent by the client, the control
+// frames are processed internally
+func (ws *wsConn) readMessage() (payload []byte, err error) {
+	for {
+		header := make([]byte, 2)
+		if _, err = io.ReadFull(ws.rw, header); err != nil {
+			return
+		}
+
+		opCode := header[0] & 0x0F
+		masked := header[1]&0x80 != 0
+		length := uint64(header[1] & 0x7F)
+		switch length {
+		case 126:
+			ext := make([]byte, 2)
+			if _, err = io.ReadFull(ws.rw, ext); err != nil {
+				return
+			}
+			length = uint64(binary.BigEndian.Uint16(ext))
+		case 127:
+			ext := make([]byte, 8)
+			if _, err = io.ReadFull(ws.rw, ext); err != nil {
+				return
+			}
+			length = binary.BigEndian.Uint64(ext)
+		}
+		if length > wsMaxClientPayload {
+			return nil, ErrWsPayloadLarge
+		}
+
+		mask := make([]byte, 4)
+		if masked {
+			if _, err = io.ReadFull(ws.rw, mask); err != nil {
+				return
+			}
+		}
+		payload = make([]byte, length)
+		if _, err = io.ReadFull(ws.rw, payload); err != nil {
+			return
+		}
+		if masked {
+			for i := range payload {
+				payload[i] ^= mask[i%4]
+			}
+		}
+
+		switch opCode {
+		case wsOpClose:
+			ws.writeFrame(wsOpClose, nil)
+			return nil, io.EOF
+		case wsOpPing:
+			if err = ws.writeFrame(wsOpPong, payload); err != nil {
+				return
+			}
+		case wsOpText:
+			return
+		}
+	}
+}
+
+func (ws *wsConn) Close() error {
+	return ws.conn.Close()
+}
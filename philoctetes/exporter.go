@@ -0,0 +1,7 @@
+package philoctetes
+
+import (
+	"github.com/alonsovidales/v/argos"
+)
+
+var inferenceLatency = argos.GetHistogram("v_philoctetes_inference_seconds", "Seconds spent by the trainers deciding to open or close", argos.LatencyBuckets, "trainer", "method")
@@ -0,0 +1,184 @@
+package philoctetes
+
+import (
+	"math"
+	"sort"
+
+	"github.com/alonsovidales/v/charont"
+)
+
+// Relation is the relation between the prices of two currencies. Correlation
+// is the one of the returns and Beta the move of the returns of the currency
+// for each move of the other one, HedgeRatio is the ratio between the log
+// prices and AdfStat the Dickey Fuller statistic of the spread between them,
+// the more negative the more cointegrated are the currencies
+type Relation struct {
+	Correlation float64
+	Beta        float64
+	HedgeRatio  float64
+	AdfStat     float64
+}
+
+// RelationsInt is implemented by the trainers that measure the relations
+// between the currencies, the traders use them to hedge the positions
+type RelationsInt interface {
+	GetRelation(curr, other string, vals map[string][]*charont.CurrVal, from, to int64, samples int) (rel Relation, ok bool)
+}
+
+// midSeries resamples the mid price of the currency on samples points equally
+// spaced between from and to using the last known value of each point,
+// returns nil if there are no values before from
+func midSeries(vals []*charont.CurrVal, from, to int64, samples int) (series []float64) {
+	if samples < 2 || to <= from {
+		return nil
+	}
+
+	series = make([]float64, samples)
+	step := (to - from) / int64(samples-1)
+	for i := range series {
+		ts := from + int64(i)*step
+		pos := sort.Search(len(vals), func(j int) bool { return vals[j].Ts > ts }) - 1
+		if pos < 0 {
+			return nil
+		}
+		series[i] = (vals[pos].Ask + vals[pos].Bid) / 2
+	}
+
+	return
+}
+
+func logSeries(series []float64) (logs []float64) {
+	logs = make([]float64, len(series))
+	for i, v := range series {
+		logs[i] = math.Log(v)
+	}
+
+	return
+}
+
+func logReturns(series []float64) (returns []float64) {
+	for i := 1; i < len(series); i++ {
+		returns = append(returns, math.Log(series[i]/series[i-1]))
+	}
+
+	return
+}
+
+func mean(x []float64) (m float64) {
+	for _, v := range x {
+		m += v
+	}
+
+	return m / float64(len(x))
+}
+
+// correlation returns the Pearson correlation of the two series and the beta
+// of x over y, zero if any of the series is constant
+func correlation(x, y []float64) (corr, beta float64) {
+	mx, my := mean(x), mean(y)
+
+	var cov, varX, varY float64
+	for i := range x {
+		cov += (x[i] - mx) * (y[i] - my)
+		varX += (x[i] - mx) * (x[i] - mx)
+		varY += (y[i] - my) * (y[i] - my)
+	}
+	if varX == 0 || varY == 0 {
+		return 0, 0
+	}
+
+	return cov / math.Sqrt(varX*varY), cov / varY
+}
+
+// adfStat returns the t statistic of the Dickey Fuller test, without lags, of
+// the series. The more negative, the more mean reverting is the series
+func adfStat(series []float64) float64 {
+	n := len(series) - 1
+	if n < 3 {
+		return 0
+	}
+
+	x := series[:n]
+	y := make([]float64, n)
+	for i := range y {
+		y[i] = series[i+1] - series[i]
+	}
+
+	mx, my := mean(x), mean(y)
+	var cov, varX float64
+	for i := range x {
+		cov += (x[i] - mx) * (y[i] - my)
+		varX += (x[i] - mx) * (x[i] - mx)
+	}
+	if varX == 0 {
+		return 0
+	}
+	phi := cov / varX
+	alpha := my - phi*mx
+
+	var rss float64
+	for i := range x {
+		res := y[i] - alpha - phi*x[i]
+		rss += res * res
+	}
+	se := math.Sqrt(rss / float64(n-2) / varX)
+	if se == 0 {
+		return math.Inf(-1)
+	}
+
+	return phi / se
+}
+
+// cointegration returns the hedge ratio between the log prices of the two
+// series and the Dickey Fuller statistic of the spread between them
+func cointegration(x, y []float64) (beta, stat float64) {
+	logX, logY := logSeries(x), logSeries(y)
+	_, beta = correlation(logX, logY)
+
+	spread := make([]float64, len(logX))
+	for i := range spread {
+		spread[i] = logX[i] - beta*logY[i]
+	}
+
+	return beta, adfStat(spread)
+}
+
+// MeasureRelation returns the relation between the prices of the two currencies
+// resampled on the given window, ok is false if any of them doesn't have
+// enough history
+func MeasureRelation(x, y []*charont.CurrVal, from, to int64, samples int) (rel Relation, ok bool) {
+	seriesX := midSeries(x, from, to, samples)
+	seriesY := midSeries(y, from, to, samples)
+	if seriesX == nil || seriesY == nil {
+		return rel, false
+	}
+	rel.Correlation, rel.Beta = correlation(logReturns(seriesX), logReturns(seriesY))
+	rel.HedgeRatio, rel.AdfStat = cointegration(seriesX, seriesY)
+
+	return rel, true
+}
+
+// ReturnsCorrelation returns the correlation of the returns of the two
+// currencies resampled on the given window, ok is false if any of them
+// doesn't have enough history
+func ReturnsCorrelation(x, y []*charont.CurrVal, from, to int64, samples int) (corr float64, ok bool) {
+	seriesX := midSeries(x, from, to, samples)
+	seriesY := midSeries(y, from, to, samples)
+	if seriesX == nil || seriesY == nil {
+		return 0, false
+	}
+	corr, _ = correlation(logReturns(seriesX), logReturns(seriesY))
+
+	return corr, true
+}
+
+// Returns returns the log returns of the mid price of the currency resampled
+// on the given window, ok is false if it doesn't have enough history
+func Returns(vals []*charont.CurrVal, from, to int64, samples int) (returns []float64, ok bool) {
+	series := midSeries(vals, from, to, samples)
+	if series == nil {
+		return nil, false
+	}
+
+	return logReturns(series), true
+}
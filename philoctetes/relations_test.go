@@ -0,0 +1,28 @@
+package philoctetes
+
+import (
+	"math"
+	"testing"
+)
+
+func TestCorrelation(t *testing.T) {
+	x := []float64{1, 2, 3, 4, 5}
+	y := []float64{2, 4, 6, 8, 10}
+	if corr, beta := correlation(x, y); math.Abs(corr-1) > 1e-9 || math.Abs(beta-0.5) > 1e-9 {
+		t.Error("Unexpected correlation:", corr, "Beta:", beta)
+	}
+
+	// A mean reverting spread against a random walk
+	reverting := make([]float64, 200)
+	walk := make([]float64, 200)
+	for i := 1; i < 200; i++ {
+		reverting[i] = -0.5*reverting[i-1] + math.Sin(float64(i*i))
+		walk[i] = walk[i-1] + 0.1 + math.Sin(float64(i*i))*0.01
+	}
+	if stat := adfStat(reverting); stat > -2.86 {
+		t.Error("The series should be mean reverting, ADF:", stat)
+	}
+	if stat := adfStat(walk); stat < -2.86 {
+		t.Error("The random walk shouldn't be mean reverting, ADF:", stat)
+	}
+}
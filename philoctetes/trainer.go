@@ -6,3 +6,41 @@ type TrainerInt interface {
 	ShouldIOperate(curr string, vals map[string][]*charont.CurrVal, traderID int) (operate bool, typeOper string)
 	ShouldIClose(curr string, askVal *charont.CurrVal, vals map[string][]*charont.CurrVal, traderID int, ord *charont.Order) bool
 }
+
+// ScorerInt is implemented by the trainers that decide comparing scores
+// against a boundary, the traders use it to measure the confidence of the
+// signals
+type ScorerInt interface {
+	GetScores(curr string, vals map[string][]*charont.CurrVal, traderID int) (scoreBuy, scoreSell, boundary float64, ok bool)
+}
+
+// ExplainerInt is implemented by the trainers that can provide the features
+// used to take the decisions
+type ExplainerInt interface {
+	GetFeatures(curr string, vals map[string][]*charont.CurrVal) (features []float64, ok bool)
+}
+
+// Boundaries are the scores over which a trader opens a position, Entry, and
+// under which it closes it, Exit
+type Boundaries struct {
+	Entry float64 `json:"entry"`
+	Exit  float64 `json:"exit"`
+}
+
+// BoundariesInt is implemented by the trainers that decide comparing the
+// scores against the boundaries of each trader, by default they are obtained
+// from the trader ID, see GridBoundaries
+type BoundariesInt interface {
+	SetBoundaries(traderID int, boundaries Boundaries)
+	GetBoundaries(traderID int) Boundaries
+}
+
+// GridBoundaries returns the boundaries encoded on the trader ID, the units
+// are the entry boundary and the tens the exit one of each group of
+// TrainersToRun traders
+func GridBoundaries(traderID int) Boundaries {
+	return Boundaries{
+		Entry: float64((traderID%TrainersToRun)%10) / 10,
+		Exit:  float64((traderID%TrainersToRun)/10) / 10,
+	}
+}
@@ -4,7 +4,6 @@ import (
 	"bufio"
 	"encoding/json"
 	"math"
-	"os"
 	"sort"
 	"strings"
 	"sync"
@@ -64,7 +63,7 @@ func GetTrainerCorrelations(trainingFile string, TimeRangeToStudySecs int64) Tra
 	log.Debug("Initializing trainer...")
 
 	TimeRangeToStudySecs *= tsMultToSecs
-	feedsFile, err := os.Open(trainingFile)
+	feedsFile, err := charont.OpenFeeds(trainingFile)
 	log.Debug("File:", trainingFile)
 	if err != nil {
 		log.Fatal("Problem reading the logs file")
@@ -524,6 +523,8 @@ func (tr *TrainerCorrelations) getClosestCentroid(score *ScoreCounter, centroids
 }
 
 func (tr *TrainerCorrelations) ShouldIOperate(curr string, vals map[string][]*charont.CurrVal, traderID int) (operate bool, typeOper string) {
+	defer inferenceLatency.Since(time.Now(), "correlations", "operate")
+
 	val := vals[curr][len(vals[curr])-1]
 	vals[curr] = vals[curr][1:]
 	charAskMin, charAskMax, charAskMean, charAskMode, noPossibleToStudy, _ := tr.getPointCharacteristics(val, vals[curr])
@@ -565,6 +566,8 @@ func (tr *TrainerCorrelations) ShouldIOperate(curr string, vals map[string][]*ch
 }
 
 func (tr *TrainerCorrelations) ShouldIClose(curr string, askVal *charont.CurrVal, vals map[string][]*charont.CurrVal, traderID int, ord *charont.Order) bool {
+	defer inferenceLatency.Since(time.Now(), "correlations", "close")
+
 	var centroid, traderCentroid int
 	var currentWin float64
 
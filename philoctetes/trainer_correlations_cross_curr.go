@@ -6,9 +6,9 @@ import (
 	"fmt"
 	"io/ioutil"
 	"math"
-	"os"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/alonsovidales/go_matrix"
 	"github.com/alonsovidales/pit/log"
@@ -43,23 +43,35 @@ type charsByCurr struct {
 	ts         int64
 }
 
+// featuresByCurr are the normalized characteristics of a currency at ts, the
+// traders of the currency request them for the same prices
+type featuresByCurr struct {
+	features   []float64
+	noPossible bool
+	ts         int64
+}
+
 type TrainerCorrelationsCrossCurr struct {
 	TrainerInt
 
 	feeds map[string][]*charont.CurrVal
 
-	charsByCurr   map[string]*charsByCurr
-	locksByCurr   *sync.Mutex
-	thetasBuy     map[string][][]float64
-	thetasSell    map[string][][]float64
-	avgCurrMaxWin map[string]float64
-	normalization map[string][][3]float64 // Max Min AVG
-	currsPos      []string
+	charsByCurr    map[string]*charsByCurr
+	featuresByCurr map[string]*featuresByCurr
+	locksByCurr    *sync.Mutex
+	thetasBuy      map[string][][]float64
+	thetasSell     map[string][][]float64
+	avgCurrMaxWin  map[string]float64
+	normalization  map[string][][3]float64 // Max Min AVG
+	currsPos       []string
 
 	lastPostByCurr          map[string]int
 	lasKnownScoreBuyByCurr  map[string]float64
 	lasKnownScoreSellByCurr map[string]float64
 	lasKnownTsByCurr        map[string]int64
+
+	boundaries      map[int]Boundaries
+	boundariesMutex *sync.Mutex
 }
 
 type score struct {
@@ -73,7 +85,7 @@ func GetTrainerCorrelationsCrossCurr(trainingFile string, TimeRangeToStudySecs i
 	log.Debug("Initializing trainer...")
 
 	TimeRangeToStudySecs *= tsMultToSecsCrossCurr
-	feedsFile, err := os.Open(trainingFile)
+	feedsFile, err := charont.OpenFeeds(trainingFile)
 	log.Debug("File:", trainingFile)
 	if err != nil {
 		log.Fatal("Problem reading the logs file")
@@ -93,7 +105,10 @@ func GetTrainerCorrelationsCrossCurr(trainingFile string, TimeRangeToStudySecs i
 		lasKnownScoreSellByCurr: make(map[string]float64),
 		lasKnownTsByCurr:        make(map[string]int64),
 		charsByCurr:             make(map[string]*charsByCurr),
+		featuresByCurr:          make(map[string]*featuresByCurr),
 		avgCurrMaxWin:           make(map[string]float64),
+		boundaries:              make(map[int]Boundaries),
+		boundariesMutex:         new(sync.Mutex),
 	}
 
 	i := 0
@@ -286,13 +301,82 @@ func (tr *TrainerCorrelationsCrossCurr) getValScore(curr string, vals map[string
 	return scoreBuy, scoreSell, scoreBuy == noPossibleScore
 }
 
+// GetScores returns the current scores to buy and sell of the currency and
+// the boundary used by the trader to operate
+func (tr *TrainerCorrelationsCrossCurr) GetScores(curr string, vals map[string][]*charont.CurrVal, traderID int) (scoreBuy, scoreSell, boundary float64, ok bool) {
+	scoreBuy, scoreSell, noPossible := tr.getValScore(curr, vals)
+
+	return scoreBuy, scoreSell, tr.GetBoundaries(traderID).Entry, !noPossible
+}
+
+// GetRelation returns the relation between the prices of the currency and the
+// other one during the window, the same currencies compared by the
+// characteristics of the trainer
+func (tr *TrainerCorrelationsCrossCurr) GetRelation(curr, other string, vals map[string][]*charont.CurrVal, from, to int64, samples int) (rel Relation, ok bool) {
+	return MeasureRelation(vals[curr], vals[other], from, to, samples)
+}
+
+// SetBoundaries replaces the boundaries obtained from the ID of the trader
+func (tr *TrainerCorrelationsCrossCurr) SetBoundaries(traderID int, boundaries Boundaries) {
+	tr.boundariesMutex.Lock()
+	tr.boundaries[traderID] = boundaries
+	tr.boundariesMutex.Unlock()
+}
+
+// GetBoundaries returns the boundaries of the trader, the ones encoded on its
+// ID if they were not replaced
+func (tr *TrainerCorrelationsCrossCurr) GetBoundaries(traderID int) Boundaries {
+	tr.boundariesMutex.Lock()
+	defer tr.boundariesMutex.Unlock()
+
+	if boundaries, ok := tr.boundaries[traderID]; ok {
+		return boundaries
+	}
+
+	return GridBoundaries(traderID)
+}
+
+// GetFeatures returns the normalized characteristics used to calculate the
+// scores of the currency, they are calculated once for each price
+func (tr *TrainerCorrelationsCrossCurr) GetFeatures(curr string, vals map[string][]*charont.CurrVal) (features []float64, ok bool) {
+	if len(vals[curr]) == 0 {
+		return nil, false
+	}
+	ts := vals[curr][len(vals[curr])-1].Ts
+
+	tr.locksByCurr.Lock()
+	cached, found := tr.featuresByCurr[curr]
+	tr.locksByCurr.Unlock()
+	if found && cached.ts == ts {
+		return cached.features, !cached.noPossible
+	}
+
+	chars, noPossible := tr.getCharacteristics(vals, curr, false)
+	if !noPossible {
+		tr.normalizeScoreCharacteristics(chars, curr)
+		features = chars.chars
+	}
+
+	tr.locksByCurr.Lock()
+	tr.featuresByCurr[curr] = &featuresByCurr{
+		features:   features,
+		noPossible: noPossible,
+		ts:         ts,
+	}
+	tr.locksByCurr.Unlock()
+
+	return features, !noPossible
+}
+
 func (tr *TrainerCorrelationsCrossCurr) ShouldIOperate(curr string, vals map[string][]*charont.CurrVal, traderID int) (operate bool, typeOper string) {
+	defer inferenceLatency.Since(time.Now(), "correlations-cross-curr", "operate")
+
 	scoreBuy, scoreSell, noPossible := tr.getValScore(curr, vals)
 	if noPossible {
 		return false, ""
 	}
 
-	boundary := float64((traderID%TrainersToRun)%10) / 10
+	boundary := tr.GetBoundaries(traderID).Entry
 
 	if scoreBuy > scoreSell {
 		buy := scoreBuy > boundary
@@ -312,6 +396,8 @@ func (tr *TrainerCorrelationsCrossCurr) ShouldIOperate(curr string, vals map[str
 }
 
 func (tr *TrainerCorrelationsCrossCurr) ShouldIClose(curr string, askVal *charont.CurrVal, vals map[string][]*charont.CurrVal, traderID int, ord *charont.Order) bool {
+	defer inferenceLatency.Since(time.Now(), "correlations-cross-curr", "close")
+
 	var score, currentWin float64
 
 	closeOrder := false
@@ -329,7 +415,7 @@ func (tr *TrainerCorrelationsCrossCurr) ShouldIClose(curr string, askVal *charon
 	}
 
 	if !noPossible {
-		boundary := float64((traderID%TrainersToRun)/10) / 10
+		boundary := tr.GetBoundaries(traderID).Exit
 
 		closeOrder = (currentWin > 0 && score < boundary) ||
 			(currentWin > tr.avgCurrMaxWin[curr]) ||
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"os"
+	"time"
+
+	"github.com/alonsovidales/pit/cfg"
+	"github.com/alonsovidales/pit/log"
+	"github.com/alonsovidales/v/hades"
+	"github.com/alonsovidales/v/hermes"
+)
+
+const (
+	defaultWatchSecs = 5
+)
+
+var riskKeys = []string{"stop-loss", "max-drawdown", "daily-loss-limit", "max-consecutive-losses"}
+
+// restartKeys are the config values that are only read on startup, the
+// changes on them are reported but not applied until the next restart
+var restartKeys = map[string][]string{
+	"logger":         {"log_file", "max_log_size_mb"},
+	"oanda":          {"endpoint", "token", "account-id", "exanges-log", "exanges-log-max-size-mb", "exanges-log-rotate-daily"},
+	"traders":        {"types"},
+	"traders-window": {"last-ops-to-considerer", "min-samples-to-consider", "max-time-to-wait-sec"},
+	"trainer":        {"training-set", "time-range-to-study"},
+	"persistence":    {"snapshots-dir", "snapshot-every-secs", "reconciliation-report"},
+	"traces":         {"file", "hold-every"},
+	"stream":         {"http-port", "candle-secs"},
+	"admin":          {"http-port", "token", "audit-file"},
+	"metrics":        {"http-port"},
+	"books":          {"names", "status-secs"},
+	"evolution":      {"enabled", "population-size", "generation-secs", "genes", "min-ops", "window", "retire-ratio", "bad-generations", "elite", "mutation-rate", "mutation-scale", "lineage-file", "seed"},
+	"allocation":     {"scheme", "budget", "max-trader-ratio", "max-trader-capital", "window", "vol-window-secs", "vol-samples"},
+	"breaker":        {"enabled", "max-daily-loss", "max-drawdown", "max-consecutive-losses", "max-error-rate", "error-window-secs", "min-requests", "max-feed-stale-secs", "flatten", "trip-file", "check-secs"},
+	"portfolio":      {"enabled", "max-open-trades", "max-net-exposure", "max-gross-exposure", "max-total-notional", "max-correlated-exposure", "min-correlation", "correlation-window-secs", "correlation-samples"},
+	"selection":      {"policy", "window", "min-ops", "ucb-exploration", "epsilon", "epsilon-decay", "min-epsilon", "seed"},
+}
+
+// configKey is a value of the config, the live ones are applied without
+// restarting
+type configKey struct {
+	section string
+	key     string
+	live    bool
+}
+
+func (k configKey) String() string {
+	return k.section + "." + k.key
+}
+
+// configReloader reads again the config of a book and applies the changes
+// that can be applied while running
+type configReloader struct {
+	book    *bookConf
+	logging bool
+	manager *hades.Hades
+	// sections contains the config section of each trader type
+	sections map[string]string
+	keys     []configKey
+	applied  map[string]string
+}
+
+func getConfigReloader(book *bookConf, logging bool, manager *hades.Hades, groups []*hades.TradersGroup) (cr *configReloader) {
+	cr = &configReloader{
+		book:     book,
+		logging:  logging,
+		manager:  manager,
+		sections: make(map[string]string),
+		keys: []configKey{
+			{"traders-window", "max-traders-that-can-play", true},
+			{"traders-window", "units-to-use", true},
+			{"logger", "level", true},
+			{"oanda", "currencies", true},
+		},
+	}
+	for section, keys := range restartKeys {
+		for _, key := range keys {
+			cr.keys = append(cr.keys, configKey{section, key, false})
+		}
+	}
+	for _, key := range riskKeys {
+		cr.keys = append(cr.keys, configKey{"risk", key, true})
+	}
+
+	for _, group := range groups {
+		section := "traders-window"
+		if book.GetStr("traders", "types") != "" {
+			section = "trader-" + group.Type
+		}
+		cr.sections[group.Type] = section
+		for _, key := range riskKeys {
+			cr.keys = append(cr.keys, configKey{section, key, true})
+		}
+		if section == "traders-window" {
+			continue
+		}
+		cr.keys = append(cr.keys, configKey{section, "traders", false}, configKey{section, "currencies", false})
+		for param := range group.Params {
+			cr.keys = append(cr.keys, configKey{section, param, false})
+		}
+	}
+	cr.applied = cr.read()
+
+	return
+}
+
+func (cr *configReloader) read() (values map[string]string) {
+	values = make(map[string]string)
+	for _, k := range cr.keys {
+		values[k.String()] = cr.book.GetStr(k.section, k.key)
+	}
+
+	return
+}
+
+// reloadBooks reads the config and applies the live changes to all the books
+func reloadBooks(env string, reloaders []*configReloader) {
+	cfg.Init("v", env)
+	for _, cr := range reloaders {
+		cr.reload()
+	}
+}
+
+// reload applies the live changes of the config already read, the changes
+// that require a restart are reported on each reload until the restart
+func (cr *configReloader) reload() {
+	values := cr.read()
+
+	live := []string{}
+	pending := []string{}
+	for _, k := range cr.keys {
+		if values[k.String()] == cr.applied[k.String()] {
+			continue
+		}
+		if k.live {
+			live = append(live, k.String())
+			cr.applied[k.String()] = values[k.String()]
+		} else {
+			pending = append(pending, k.String())
+		}
+	}
+
+	log.Info("Config reloaded, Book:", cr.book.name, "Changed values:", live, "Values that require a restart:", pending)
+	if len(live) == 0 {
+		return
+	}
+
+	for _, key := range live {
+		if key == "logger.level" && cr.logging {
+			log.SetLogger(
+				log.Levels[values[key]],
+				cr.applied["logger.log_file"],
+				cr.book.GetInt("logger", "max_log_size_mb"),
+			)
+			log.Info("Log level changed to:", values[key])
+		}
+	}
+
+	changes, err := cr.manager.ApplyConf(cr.runtimeConf(live))
+	if err != nil {
+		log.Error("Some config changes can't be applied:", err)
+	}
+	log.Info("Config changes applied, Book:", cr.book.name, "Changes:", changes)
+}
+
+// runtimeConf returns the runtime config with only the values affected by
+// the changed keys, the rest keep the values that are running, including the
+// ones changed by the admin API
+func (cr *configReloader) runtimeConf(live []string) (conf *hades.RuntimeConf) {
+	changed := make(map[string]bool)
+	for _, key := range live {
+		changed[key] = true
+	}
+
+	conf = &hades.RuntimeConf{}
+	if changed["traders-window.max-traders-that-can-play"] {
+		tradesThatCanPlay := int(cr.book.GetInt("traders-window", "max-traders-that-can-play"))
+		conf.TradesThatCanPlay = &tradesThatCanPlay
+	}
+	if changed["traders-window.units-to-use"] {
+		units := int(cr.book.GetInt("traders-window", "units-to-use"))
+		conf.Units = &units
+	}
+	if changed["oanda.currencies"] {
+		conf.Currencies = cr.book.currencies()
+	}
+	for typeName, section := range cr.sections {
+		for _, key := range riskKeys {
+			if changed["risk."+key] || changed[section+"."+key] {
+				if conf.Risk == nil {
+					conf.Risk = make(map[string]*hermes.RiskLimits)
+				}
+				conf.Risk[typeName] = cr.book.getRiskLimits(section)
+				break
+			}
+		}
+	}
+
+	return
+}
+
+// watchConfig sends a reload each time that the modification time of the
+// config file changes
+func watchConfig(path string, every time.Duration, changed chan<- bool) {
+	var lastMod time.Time
+	if info, err := os.Stat(path); err == nil {
+		lastMod = info.ModTime()
+	}
+
+	for _ = range time.Tick(every) {
+		info, err := os.Stat(path)
+		if err != nil {
+			log.Error("The config file can't be watched:", err)
+			continue
+		}
+		if info.ModTime() != lastMod {
+			lastMod = info.ModTime()
+			changed <- true
+		}
+	}
+}
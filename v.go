@@ -5,19 +5,24 @@ import (
 	"os"
 	"os/signal"
 	"runtime"
+	"strconv"
 	"strings"
 	"syscall"
+	"time"
 
 	"github.com/alonsovidales/pit/cfg"
 	"github.com/alonsovidales/pit/log"
+	"github.com/alonsovidales/v/argos"
 	"github.com/alonsovidales/v/charont"
 	"github.com/alonsovidales/v/hades"
+	"github.com/alonsovidales/v/hermes"
+	"github.com/alonsovidales/v/iris"
 	"github.com/alonsovidales/v/philoctetes"
 )
 
 func main() {
 	if len(os.Args) < 4 {
-		fmt.Println("Execute: v <env> [log|nolog] [collect|train|play] <train_file>")
+		fmt.Println("Execute: v <env> [log|nolog] [collect|train|play] <train_file|train_dir|manifest>")
 		return
 	}
 
@@ -33,7 +38,11 @@ func main() {
 		)
 	}
 
-	var collector charont.Int
+	books := getBooks()
+	checkBooks(books)
+	var collectors []charont.Int
+	var recorders []*charont.Recorder
+	var mock *charont.Mock
 	var err error
 
 	/*trainer := philoctetes.GetTrainerCuda(
@@ -46,59 +55,329 @@ func main() {
 		cfg.GetInt("trainer", "time-range-to-study"),
 	)*/
 	if runningMode != "train" {
-		collector, err = charont.InitOandaApi(
-			cfg.GetStr("oanda", "endpoint"),
-			cfg.GetStr("oanda", "token"),
-			int(cfg.GetInt("oanda", "account-id")),
-			strings.Split(cfg.GetStr("oanda", "currencies"), ","),
-			cfg.GetStr("oanda", "exanges-log"),
-		)
+		collectors, recorders, err = getOandaCollectors(books, cfg.GetStr("oanda", "exanges-log"))
 		if err != nil {
-			log.Fatal("The API connection can't be loaded:", err)
+			log.Fatal("The API connection or the currencies recorder can't be loaded:", err)
 		}
 	} else {
 		if len(os.Args) < 4 {
 			fmt.Println("<train_file> not specified")
 		}
-		collector = charont.GetMock(
+		mock = charont.GetMock(
 			os.Args[4],
 			1000,
-			strings.Split(cfg.GetStr("oanda", "currencies"), ","),
+			allCurrencies(books),
 			int(cfg.GetInt("mock", "http-port")),
 		)
+		if cfg.GetInt("mock-chaos", "enabled") != 0 {
+			mock.SetChaos(&charont.Chaos{
+				Seed:              cfg.GetInt("mock-chaos", "seed"),
+				RejectOrderProb:   getCfgFloat("mock-chaos", "reject-order-prob"),
+				DelayFillProb:     getCfgFloat("mock-chaos", "delay-fill-prob"),
+				MaxFillDelayTicks: int(cfg.GetInt("mock-chaos", "max-fill-delay-ticks")),
+				CloseFailProb:     getCfgFloat("mock-chaos", "close-fail-prob"),
+				DropTickProb:      getCfgFloat("mock-chaos", "drop-tick-prob"),
+				DupTickProb:       getCfgFloat("mock-chaos", "dup-tick-prob"),
+				OutOfOrderProb:    getCfgFloat("mock-chaos", "out-of-order-prob"),
+				MaxOutOfOrderSecs: int(cfg.GetInt("mock-chaos", "max-out-of-order-secs")),
+				OutageProb:        getCfgFloat("mock-chaos", "outage-prob"),
+				MaxOutageTicks:    int(cfg.GetInt("mock-chaos", "max-outage-ticks")),
+			})
+		}
+		if len(books) == 1 {
+			collectors = []charont.Int{mock}
+		} else {
+			// all the books replay the same prices, the mock is started
+			// once all of them are listening
+			for _, book := range books {
+				collectors = append(collectors, charont.GetShared(mock, book.currencies()))
+			}
+		}
 	}
 
-	if runningMode != "collect" {
-		trainer := philoctetes.GetTrainerCorrelationsCrossCurr(
-			cfg.GetStr("trainer", "training-set"),
-			cfg.GetInt("trainer", "time-range-to-study"),
+	if metricsPort := int(cfg.GetInt("metrics", "http-port")); metricsPort != 0 {
+		argos.Serve(metricsPort)
+	}
+
+	if streamPort := int(cfg.GetInt("stream", "http-port")); streamPort != 0 {
+		// only the prices of the first book are streamed
+		collectors[0] = iris.GetIris(
+			collectors[0],
+			streamPort,
+			int(cfg.GetInt("stream", "candle-secs")),
 		)
+	}
 
-		manager := hades.GetHades(
-			trainer,
-			int(cfg.GetInt("traders-window", "total")),
-			int(cfg.GetInt("traders-window", "from-size")),
-			collector,
-			int(cfg.GetInt("traders-window", "units-to-use")),
-			int(cfg.GetInt("traders-window", "min-samples-to-consider")),
-			int(cfg.GetInt("traders-window", "last-ops-to-considerer")),
-			int(cfg.GetInt("traders-window", "max-traders-that-can-play")),
-			int(cfg.GetInt("traders-window", "max-time-to-wait-sec")))
+	if runningMode != "collect" {
+		var tracer *hermes.Tracer
+		if tracesFile := cfg.GetStr("traces", "file"); tracesFile != "" {
+			if tracer, err = hermes.GetTracer(tracesFile, int(cfg.GetInt("traces", "hold-every"))); err != nil {
+				log.Fatal("The decision traces file can't be opened:", err)
+			}
+		}
+
+		managers := []*hades.Hades{}
+		reloaders := []*configReloader{}
+		for i, book := range books {
+			manager, groups, err := book.launchBook(i, collectors[i], tracer)
+			if err != nil {
+				log.Fatal("The traders of the book:", book.name, "can't be launched:", err)
+			}
+			managers = append(managers, manager)
+			// the logger is reloaded only once for all the books
+			reloaders = append(reloaders, getConfigReloader(book, i == 0 && os.Args[2] == "log", manager, groups))
+		}
+		if mock != nil && len(books) > 1 {
+			mock.Run()
+		}
+		if statusSecs := cfg.GetInt("books", "status-secs"); statusSecs > 0 {
+			go reportBooks(managers, time.Duration(statusSecs)*time.Second)
+		}
+
+		// the config is reloaded on SIGHUP or when the config file changes
+		hup := make(chan os.Signal, 1)
+		signal.Notify(hup, syscall.SIGHUP)
+		changed := make(chan bool)
+		if configFile := cfg.GetStr("reload", "config-file"); configFile != "" {
+			watchSecs := cfg.GetInt("reload", "watch-secs")
+			if watchSecs <= 0 {
+				watchSecs = defaultWatchSecs
+			}
+			go watchConfig(configFile, time.Duration(watchSecs)*time.Second, changed)
+		}
 
 		log.Info("System started...")
 		c := make(chan os.Signal, 1)
 		signal.Notify(c, os.Interrupt, os.Kill, syscall.SIGTERM)
 		// Block until a signal is received.
-		<-c
+	waitLoop:
+		for {
+			select {
+			case <-hup:
+				reloadBooks(os.Args[1], reloaders)
+			case <-changed:
+				reloadBooks(os.Args[1], reloaders)
+			case <-c:
+				break waitLoop
+			}
+		}
 
 		log.Info("Stopping all the services")
-		manager.CloseAllOpenOrdersAndFinish()
+		stopBooks(managers, &hades.ShutdownConf{
+			GraceSecs:      int(cfg.GetInt("shutdown", "grace-secs")),
+			ForceCloseSecs: int(cfg.GetInt("shutdown", "force-close-secs")),
+			CloseRetries:   int(cfg.GetInt("shutdown", "close-retries")),
+			RetryWaitSecs:  int(cfg.GetInt("shutdown", "retry-wait-secs")),
+		})
+		for i, book := range books {
+			if reportFile := book.GetStr("persistence", "reconciliation-report"); reportFile != "" {
+				if err = managers[i].SaveReconciliation(reportFile); err != nil {
+					log.Error("The reconciliation report of the book:", book.name, "can't be stored:", err)
+				}
+			}
+		}
+		if tracer != nil {
+			if err = tracer.Close(); err != nil {
+				log.Error("The decision traces file can't be closed:", err)
+			}
+		}
 	} else {
-		collector.Run()
+		for _, collector := range collectors {
+			collector.Run()
+		}
 		log.Info("System started...")
 		c := make(chan os.Signal, 1)
 		signal.Notify(c, os.Interrupt, os.Kill, syscall.SIGTERM)
 		// Block until a signal is received.
 		<-c
 	}
+
+	for _, recorder := range recorders {
+		if err = recorder.Close(); err != nil {
+			log.Error("The currencies recorder can't be closed:", err)
+		}
+	}
+}
+
+func getCfgFloat(section, key string) float64 {
+	val, _ := strconv.ParseFloat(cfg.GetStr(section, key), 64)
+
+	return val
+}
+
+// getTradersGroups returns the groups of traders defined on the "types" key of
+// the "traders" section, each type is configured on its own "trader-<type>"
+// section. By default a group of window traders is launched
+func (bc *bookConf) getTradersGroups() (groups []*hades.TradersGroup) {
+	types := bc.GetStr("traders", "types")
+	if types == "" {
+		return []*hades.TradersGroup{
+			{
+				Type:    hermes.WindowTraderType,
+				Traders: philoctetes.TrainersToRun,
+				Risk:    bc.getRiskLimits("traders-window"),
+				Params: map[string]string{
+					"samples-to-considerer": bc.GetStr("traders-window", "min-samples-to-consider"),
+					"max-secs-to-wait":      bc.GetStr("traders-window", "max-time-to-wait-sec"),
+				},
+			},
+		}
+	}
+
+	for _, typeName := range strings.Split(types, ",") {
+		typeName = strings.TrimSpace(typeName)
+		tt, ok := hermes.GetTraderType(typeName)
+		if !ok {
+			log.Fatal("Unknown trader type:", typeName, "Available types:", hermes.GetTraderTypes())
+		}
+
+		section := "trader-" + typeName
+		group := &hades.TradersGroup{
+			Type:    typeName,
+			Traders: int(bc.GetInt(section, "traders")),
+			Risk:    bc.getRiskLimits(section),
+			Params:  make(map[string]string),
+		}
+		if currs := bc.GetStr(section, "currencies"); currs != "" {
+			group.Currencies = strings.Split(currs, ",")
+		}
+		for _, param := range tt.Params {
+			group.Params[param.Name] = bc.GetStr(section, param.Name)
+		}
+		groups = append(groups, group)
+	}
+
+	return
+}
+
+// getPortfolioLimits returns the limits applied to the real orders of all
+// the traders together, defined on the "portfolio" section, or nil if the
+// section is not enabled
+func (bc *bookConf) getPortfolioLimits() *hades.PortfolioLimits {
+	if bc.GetInt("portfolio", "enabled") == 0 {
+		return nil
+	}
+
+	return &hades.PortfolioLimits{
+		MaxOpenTrades:         int(bc.GetInt("portfolio", "max-open-trades")),
+		MaxNetExposure:        bc.getFloat("portfolio", "max-net-exposure"),
+		MaxGrossExposure:      bc.getFloat("portfolio", "max-gross-exposure"),
+		MaxTotalNotional:      bc.getFloat("portfolio", "max-total-notional"),
+		MaxCorrelatedExposure: bc.getFloat("portfolio", "max-correlated-exposure"),
+		MinCorrelation:        bc.getFloat("portfolio", "min-correlation"),
+		CorrelationWindowSecs: int(bc.GetInt("portfolio", "correlation-window-secs")),
+		CorrelationSamples:    int(bc.GetInt("portfolio", "correlation-samples")),
+	}
+}
+
+func (bc *bookConf) getAllocationConf() *hades.AllocationConf {
+	scheme := bc.GetStr("allocation", "scheme")
+	if scheme == "" {
+		return nil
+	}
+
+	return &hades.AllocationConf{
+		Scheme:           scheme,
+		Budget:           bc.getFloat("allocation", "budget"),
+		MaxTraderRatio:   bc.getFloat("allocation", "max-trader-ratio"),
+		MaxTraderCapital: bc.getFloat("allocation", "max-trader-capital"),
+		Window:           int(bc.GetInt("allocation", "window")),
+		VolWindowSecs:    int(bc.GetInt("allocation", "vol-window-secs")),
+		VolSamples:       int(bc.GetInt("allocation", "vol-samples")),
+	}
+}
+
+func (bc *bookConf) getBreakerConf() *hades.BreakerConf {
+	if bc.GetInt("breaker", "enabled") == 0 {
+		return nil
+	}
+
+	return &hades.BreakerConf{
+		MaxDailyLoss:         bc.getFloat("breaker", "max-daily-loss"),
+		MaxDrawdown:          bc.getFloat("breaker", "max-drawdown"),
+		MaxConsecutiveLosses: int(bc.GetInt("breaker", "max-consecutive-losses")),
+		MaxErrorRate:         bc.getFloat("breaker", "max-error-rate"),
+		ErrorWindowSecs:      int(bc.GetInt("breaker", "error-window-secs")),
+		MinRequests:          int(bc.GetInt("breaker", "min-requests")),
+		MaxFeedStaleSecs:     int(bc.GetInt("breaker", "max-feed-stale-secs")),
+		Flatten:              bc.GetInt("breaker", "flatten") != 0,
+		TripFile:             bc.GetStr("breaker", "trip-file"),
+		CheckSecs:            int(bc.GetInt("breaker", "check-secs")),
+	}
+}
+
+// getEvolutionConf returns the evolution of the traders defined on the
+// "evolution" section, the genes are defined as a comma separated list of
+// name:min:max with an optional :int suffix for the integer params
+func (bc *bookConf) getEvolutionConf() *hades.EvolutionConf {
+	if bc.GetInt("evolution", "enabled") == 0 {
+		return nil
+	}
+
+	conf := &hades.EvolutionConf{
+		PopulationSize: int(bc.GetInt("evolution", "population-size")),
+		GenerationSecs: int(bc.GetInt("evolution", "generation-secs")),
+		MinOps:         int(bc.GetInt("evolution", "min-ops")),
+		Window:         int(bc.GetInt("evolution", "window")),
+		RetireRatio:    bc.getFloat("evolution", "retire-ratio"),
+		BadGenerations: int(bc.GetInt("evolution", "bad-generations")),
+		Elite:          int(bc.GetInt("evolution", "elite")),
+		MutationRate:   bc.getFloat("evolution", "mutation-rate"),
+		MutationScale:  bc.getFloat("evolution", "mutation-scale"),
+		LineageFile:    bc.GetStr("evolution", "lineage-file"),
+		Seed:           bc.GetInt("evolution", "seed"),
+	}
+	for _, def := range strings.Split(bc.GetStr("evolution", "genes"), ",") {
+		parts := strings.Split(strings.TrimSpace(def), ":")
+		if len(parts) < 3 || len(parts) > 4 || (len(parts) == 4 && parts[3] != "int") {
+			log.Fatal("Invalid gene, it has to be defined as name:min:max[:int]:", def)
+		}
+		gene := hades.GeneRange{Name: parts[0], Int: len(parts) == 4}
+		var errMin, errMax error
+		gene.Min, errMin = strconv.ParseFloat(parts[1], 64)
+		gene.Max, errMax = strconv.ParseFloat(parts[2], 64)
+		if errMin != nil || errMax != nil {
+			log.Fatal("Invalid range of the gene:", def)
+		}
+		conf.Genes = append(conf.Genes, gene)
+	}
+
+	return conf
+}
+
+// getRiskLimits returns the risk limits for the traders configured on the
+// section, the limits not defined on it are taken from the "risk" section
+func (bc *bookConf) getRiskLimits(section string) *hermes.RiskLimits {
+	getFloat := func(key string) float64 {
+		if bc.GetStr(section, key) != "" {
+			return bc.getFloat(section, key)
+		}
+		return bc.getFloat("risk", key)
+	}
+	getInt := func(key string) int {
+		if bc.GetStr(section, key) != "" {
+			return int(bc.GetInt(section, key))
+		}
+		return int(bc.GetInt("risk", key))
+	}
+
+	return &hermes.RiskLimits{
+		StopLoss:             getFloat("stop-loss"),
+		MaxDrawdown:          getFloat("max-drawdown"),
+		DailyLossLimit:       getFloat("daily-loss-limit"),
+		MaxConsecutiveLosses: getInt("max-consecutive-losses"),
+	}
+}
+
+func (bc *bookConf) getSelectionConf() *hades.SelectionConf {
+	return &hades.SelectionConf{
+		Policy:         bc.GetStr("selection", "policy"),
+		Window:         int(bc.GetInt("selection", "window")),
+		MinOps:         int(bc.GetInt("selection", "min-ops")),
+		UCBExploration: bc.getFloat("selection", "ucb-exploration"),
+		Epsilon:        bc.getFloat("selection", "epsilon"),
+		EpsilonDecay:   bc.getFloat("selection", "epsilon-decay"),
+		MinEpsilon:     bc.getFloat("selection", "min-epsilon"),
+		Seed:           bc.GetInt("selection", "seed"),
+	}
 }